@@ -0,0 +1,21 @@
+// Package backoff computes retry delays.
+package backoff
+
+import "time"
+
+// Exponential returns the delay before retry number attempt (starting at 1):
+// initial doubled for every earlier failure, capped at max
+func Exponential(attempt int, initial, max time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+
+	if delay > max {
+		return max
+	}
+	return delay
+}
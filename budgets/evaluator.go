@@ -0,0 +1,171 @@
+package budgets
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/notify"
+	"subscription-service/repository"
+)
+
+// Store is what the evaluator needs from storage: the budgets and the cost of
+// the subscriptions they cover
+type Store interface {
+	repository.BudgetStore
+	CalculateTotalCost(ctx context.Context, req *models.CalculateCostRequest) (*models.CalculateCostResponse, error)
+}
+
+// Evaluator compares budgets with the spend of a month and alerts users whose
+// spend reaches a threshold. Every replica may run it: each alert is claimed in
+// the store before it is sent, so it goes out once per budget, month and threshold.
+type Evaluator struct {
+	store    Store
+	notifier notify.Notifier
+	cfg      config.BudgetsConfig
+	logger   *logger.Logger
+}
+
+// NewEvaluator creates a new budget evaluator
+func NewEvaluator(store Store, notifier notify.Notifier, cfg config.BudgetsConfig, logger *logger.Logger) *Evaluator {
+	return &Evaluator{
+		store:    store,
+		notifier: notifier,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// Payload is the JSON body of a budget alert sent through the webhook channel
+type Payload struct {
+	Threshold int                  `json:"threshold"`
+	Status    *models.BudgetStatus `json:"status"`
+}
+
+// CurrentMonth returns the month budgets are evaluated for, in MM-YYYY format
+func CurrentMonth() string {
+	return time.Now().Format("01-2006")
+}
+
+// Status compares a budget with the projected spend of a month
+func (e *Evaluator) Status(ctx context.Context, budget *models.Budget, month string) (*models.BudgetStatus, error) {
+	cost, err := e.store.CalculateTotalCost(ctx, budget.CostRequest(month))
+	if err != nil {
+		return nil, err
+	}
+
+	thresholds := budget.Thresholds
+	if len(thresholds) == 0 {
+		thresholds = e.cfg.Thresholds
+	}
+
+	status := &models.BudgetStatus{
+		Budget:      budget,
+		Month:       month,
+		Spend:       cost.TotalCost,
+		Remaining:   budget.Amount - cost.TotalCost,
+		PercentUsed: cost.TotalCost * 100 / budget.Amount,
+		Exceeded:    cost.TotalCost > budget.Amount,
+		Thresholds:  append([]int{}, thresholds...),
+		Reached:     []int{},
+	}
+	for _, threshold := range thresholds {
+		// Compared in whole numbers so that 80% of 999 is not rounded down
+		if cost.TotalCost*100 >= threshold*budget.Amount {
+			status.Reached = append(status.Reached, threshold)
+		}
+	}
+
+	return status, nil
+}
+
+// Run evaluates every budget for the current month
+func (e *Evaluator) Run(ctx context.Context) error {
+	budgets, err := e.store.ListBudgets(ctx, &models.ListBudgetsRequest{})
+	if err != nil {
+		return err
+	}
+
+	month := CurrentMonth()
+	for _, budget := range budgets {
+		if err := e.Evaluate(ctx, budget, month); err != nil {
+			e.logger.Errorf("Failed to evaluate budget %d: %v", budget.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate alerts the owner of a budget once the spend of a month reaches
+// thresholds that have not been alerted yet. The reached thresholds make up a
+// single alert about the highest of them; if it cannot be sent they are released
+// so that the next evaluation tries again.
+func (e *Evaluator) Evaluate(ctx context.Context, budget *models.Budget, month string) error {
+	status, err := e.Status(ctx, budget, month)
+	if err != nil {
+		return err
+	}
+
+	var claimed []int
+	for _, threshold := range status.Reached {
+		ok, err := e.store.ClaimBudgetAlert(ctx, budget.ID, month, threshold)
+		if err != nil {
+			e.release(ctx, budget.ID, month, claimed)
+			return err
+		}
+		if ok {
+			claimed = append(claimed, threshold)
+		}
+	}
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	if err := e.notifier.Notify(ctx, message(status, claimed[len(claimed)-1])); err != nil {
+		e.release(ctx, budget.ID, month, claimed)
+		return fmt.Errorf("failed to send budget alert: %w", err)
+	}
+
+	e.logger.Infof("Sent %d%% alert for budget %d in %s", claimed[len(claimed)-1], budget.ID, month)
+	return nil
+}
+
+// release forgets the claims of an alert that was not sent
+func (e *Evaluator) release(ctx context.Context, budgetID int, month string, thresholds []int) {
+	for _, threshold := range thresholds {
+		if err := e.store.ReleaseBudgetAlert(ctx, budgetID, month, threshold); err != nil {
+			e.logger.Errorf("Failed to release %d%% alert for budget %d: %v", threshold, budgetID, err)
+		}
+	}
+}
+
+// message renders a budget alert as a notification
+func message(status *models.BudgetStatus, threshold int) *notify.Message {
+	budget := status.Budget
+
+	scope := "your subscriptions"
+	switch budget.Scope {
+	case models.BudgetScopeCategory:
+		scope = fmt.Sprintf("%s subscriptions", *budget.Category)
+	case models.BudgetScopeService:
+		scope = fmt.Sprintf("service %d", *budget.ServiceID)
+	}
+
+	subject := fmt.Sprintf("Budget for %s at %d%% in %s", scope, status.PercentUsed, status.Month)
+	body := fmt.Sprintf("Spending on %s in %s is %d of your %d budget (%d%%).",
+		scope, status.Month, status.Spend, budget.Amount, status.PercentUsed)
+	if status.Exceeded {
+		subject = fmt.Sprintf("Budget for %s exceeded in %s", scope, status.Month)
+	}
+
+	return &notify.Message{
+		Channel: budget.Channel,
+		Target:  budget.Target,
+		Subject: subject,
+		Body:    body,
+		Payload: Payload{Threshold: threshold, Status: status},
+	}
+}
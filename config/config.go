@@ -1,9 +1,11 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v3"
@@ -11,58 +13,408 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Purge       PurgeConfig       `yaml:"purge"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Webhooks    WebhookConfig     `yaml:"webhooks"`
+	Outbox      OutboxConfig      `yaml:"outbox"`
+	Reminders   RemindersConfig   `yaml:"reminders"`
+	Budgets     BudgetsConfig     `yaml:"budgets"`
+	SMTP        SMTPConfig        `yaml:"smtp"`
+	Stream      StreamConfig      `yaml:"stream"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Health      HealthConfig      `yaml:"health"`
+	Log         LogConfig         `yaml:"log"`
+	Features    FeaturesConfig    `yaml:"features"`
+	Reload      ReloadConfig      `yaml:"reload"`
 }
 
 // ServerConfig represents the server configuration
 type ServerConfig struct {
-	Host string `yaml:"host"`
-	Port string `yaml:"port"`
+	Host              string        `yaml:"host"`
+	Port              string        `yaml:"port"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`        // Time to read a whole request including the body
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"` // Time to read the request headers
+	WriteTimeout      time.Duration `yaml:"write_timeout"`       // Time from the end of the request headers to the end of the response
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`        // How long a keep-alive connection waits for the next request
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`    // How long in-flight requests and workers get to finish on shutdown
 }
 
 // DatabaseConfig represents the database configuration
 type DatabaseConfig struct {
+	URL      string `yaml:"url"` // Full DSN, as a postgres:// URL or key=value pairs; overrides the fields below
 	Host     string `yaml:"host"`
 	Port     string `yaml:"port"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	DBName   string `yaml:"dbname"`
 	SSLMode  string `yaml:"sslmode"`
+
+	Replicas []string `yaml:"replicas"` // DSNs of read replicas that take reads which may lag behind writes
+
+	MaxOpenConns    int           `yaml:"max_open_conns"`     // Upper bound of open connections; 0 means unlimited
+	MaxIdleConns    int           `yaml:"max_idle_conns"`     // Idle connections kept for reuse
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`  // Connections are closed after this age; 0 keeps them
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"` // Idle connections are closed after this long; 0 keeps them
+	ConnectTimeout  time.Duration `yaml:"connect_timeout"`    // How long startup retries before the database counts as unreachable
+
+	QueryTimeouts QueryTimeoutConfig `yaml:"query_timeouts"`
+
+	TxIsolation  string `yaml:"tx_isolation"`   // Isolation level of transactions: read_committed, repeatable_read or serializable
+	TxMaxRetries int    `yaml:"tx_max_retries"` // How often a transaction aborted by a serialization failure or deadlock is run again
 }
 
-// LoadConfig loads the application configuration from environment variables and config file
-func LoadConfig() (*Config, error) {
-	// Load .env file if it exists
-	_ = godotenv.Load()
+// QueryTimeoutConfig bounds each database operation by its kind; 0 leaves a
+// kind unbounded. A request that is cancelled or times out earlier still stops
+// its queries.
+type QueryTimeoutConfig struct {
+	Read   time.Duration `yaml:"read"`   // Lookups and lists
+	Write  time.Duration `yaml:"write"`  // Changes, including their audit and outbox rows
+	Report time.Duration `yaml:"report"` // Aggregates such as the total cost
+	Batch  time.Duration `yaml:"batch"`  // One run of a background worker, e.g. a purge or an outbox batch
+}
 
-	// Default configuration
-	cfg := &Config{
-		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "localhost"),
-			Port: getEnv("SERVER_PORT", "8081"),
-		},
-		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "postgres"),
-			DBName:   getEnv("DB_NAME", "subscriptions"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
-		},
+// PurgeConfig represents the configuration of the soft-deleted subscription purge
+type PurgeConfig struct {
+	Retention time.Duration `yaml:"retention"` // How long deleted rows are kept; 0 disables purging
+	Interval  time.Duration `yaml:"interval"`  // How often the purge runs
+}
+
+// IdempotencyConfig represents the configuration of Idempotency-Key handling
+type IdempotencyConfig struct {
+	TTL             time.Duration `yaml:"ttl"`              // How long a stored response is replayed
+	CleanupInterval time.Duration `yaml:"cleanup_interval"` // How often expired keys are removed
+}
+
+// WebhookConfig represents the configuration of outgoing webhook delivery
+type WebhookConfig struct {
+	PollInterval   time.Duration `yaml:"poll_interval"`   // How often due deliveries are sent
+	Timeout        time.Duration `yaml:"timeout"`         // Timeout of a single delivery request
+	BatchSize      int           `yaml:"batch_size"`      // Deliveries sent per poll
+	MaxAttempts    int           `yaml:"max_attempts"`    // Attempts before a delivery is dead-lettered
+	InitialBackoff time.Duration `yaml:"initial_backoff"` // Delay before the first retry; doubled for each further one
+	MaxBackoff     time.Duration `yaml:"max_backoff"`     // Upper bound of the retry delay
+}
+
+// OutboxConfig represents the configuration of the outbox relay
+type OutboxConfig struct {
+	PollInterval   time.Duration `yaml:"poll_interval"`   // How often the outbox is checked for new events
+	BatchSize      int           `yaml:"batch_size"`      // Events claimed per batch
+	InitialBackoff time.Duration `yaml:"initial_backoff"` // Delay before an event that failed to publish is retried; doubled for each further failure
+	MaxBackoff     time.Duration `yaml:"max_backoff"`     // Upper bound of the retry delay
+	Retention      time.Duration `yaml:"retention"`       // How long published events are kept
+	HTTPURL        string        `yaml:"http_url"`        // Optional URL every event is POSTed to
+	NATSURL        string        `yaml:"nats_url"`        // Optional NATS server every event is published to
+	NATSSubject    string        `yaml:"nats_subject"`    // Prefix of the NATS subjects; the event type is appended
+	Timeout        time.Duration `yaml:"timeout"`         // Timeout of publishing to HTTP or NATS
+}
+
+// RemindersConfig represents the configuration of the renewal and end reminder scheduler
+type RemindersConfig struct {
+	Interval        time.Duration `yaml:"interval"`          // How often reminders are planned and due ones sent
+	BatchSize       int           `yaml:"batch_size"`        // Reminders sent per run
+	RenewalLeadDays []int         `yaml:"renewal_lead_days"` // Lead times of users without preferences
+	EndLeadDays     []int         `yaml:"end_lead_days"`     // Lead times of users without preferences
+	MaxAttempts     int           `yaml:"max_attempts"`      // Attempts before a reminder is marked failed
+	InitialBackoff  time.Duration `yaml:"initial_backoff"`   // Delay before the first retry; doubled for each further one
+	MaxBackoff      time.Duration `yaml:"max_backoff"`       // Upper bound of the retry delay
+	Timeout         time.Duration `yaml:"timeout"`           // Timeout of a webhook notification
+}
+
+// BudgetsConfig represents the configuration of the budget evaluator
+type BudgetsConfig struct {
+	Interval   time.Duration `yaml:"interval"`   // How often budgets are evaluated and alerts sent
+	Thresholds []int         `yaml:"thresholds"` // Percentages of a budget that raise an alert, for budgets without their own
+}
+
+// SMTPConfig represents the mail server used by the email notification channel
+type SMTPConfig struct {
+	Host     string `yaml:"host"` // Email notifications are disabled when empty
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// StreamConfig represents the configuration of the Server-Sent Events stream
+type StreamConfig struct {
+	BufferSize int           `yaml:"buffer_size"` // Events kept for resuming with Last-Event-ID
+	Heartbeat  time.Duration `yaml:"heartbeat"`   // How often an idle stream sends a heartbeat
+}
+
+// TracingConfig represents the configuration of OpenTelemetry tracing
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"`      // none, stdout or otlp
+	OTLPEndpoint string  `yaml:"otlp_endpoint"` // host:port of the OTLP/HTTP collector
+	OTLPInsecure bool    `yaml:"otlp_insecure"` // Send spans over plain HTTP instead of HTTPS
+	ServiceName  string  `yaml:"service_name"`  // service.name resource attribute of every span
+	SampleRatio  float64 `yaml:"sample_ratio"`  // Share of new traces that are recorded, from 0 to 1
+}
+
+// HealthConfig represents the configuration of the readiness probe
+type HealthConfig struct {
+	Timeout       time.Duration `yaml:"timeout"`        // How long all readiness checks together may take
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"` // How long readiness fails before the server stops accepting requests
+}
+
+// LogConfig represents the logging configuration; reloadable
+type LogConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // text or json
+}
+
+// FeaturesConfig switches optional features on and off; reloadable
+type FeaturesConfig struct {
+	Search      bool `yaml:"search"`       // Fuzzy search of subscriptions by service name
+	EventStream bool `yaml:"event_stream"` // Server-sent events of subscription changes; open streams are not closed
+}
+
+// ReloadConfig represents how configuration changes are picked up at runtime
+type ReloadConfig struct {
+	Interval time.Duration `yaml:"interval"` // How often the config file is checked for changes; 0 reloads on SIGHUP only
+}
+
+// LoadConfig loads the application configuration. Later sources override
+// earlier ones: built-in defaults, the YAML file, environment variables (also
+// from a .env file), and finally command-line flags. The result is validated.
+func LoadConfig(flags *Flags) (*Config, error) {
+	if flags == nil {
+		flags = &Flags{}
 	}
 
-	// Try to load config from YAML file
-	configPath := getEnv("CONFIG_PATH", "config.yaml")
+	// Load .env file if it exists; variables already set take precedence
+	_ = godotenv.Load()
+
+	cfg := Default()
+
+	configPath := flags.ConfigPath
+	if configPath == "" {
+		configPath = getEnv("CONFIG_PATH", "config.yaml")
+	}
 	if _, err := os.Stat(configPath); err == nil {
 		if err := loadYAMLConfig(configPath, cfg); err != nil {
 			return nil, fmt.Errorf("failed to load YAML config: %w", err)
 		}
+	} else if flags.ConfigPath != "" {
+		return nil, fmt.Errorf("failed to load YAML config: %w", err)
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, fmt.Errorf("invalid environment variables:\n%w", err)
+	}
+
+	flags.apply(cfg)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
 	}
 
 	return cfg, nil
 }
 
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Host:              "localhost",
+			Port:              "8081",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Host:     "localhost",
+			Port:     "5432",
+			User:     "postgres",
+			Password: "postgres",
+			DBName:   "subscriptions",
+			SSLMode:  "disable",
+
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectTimeout:  time.Minute,
+
+			QueryTimeouts: QueryTimeoutConfig{
+				Read:   5 * time.Second,
+				Write:  10 * time.Second,
+				Report: 30 * time.Second,
+				Batch:  time.Minute,
+			},
+
+			TxIsolation:  "read_committed",
+			TxMaxRetries: 3,
+		},
+		Purge: PurgeConfig{
+			Retention: 30 * 24 * time.Hour,
+			Interval:  time.Hour,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:             24 * time.Hour,
+			CleanupInterval: time.Hour,
+		},
+		Webhooks: WebhookConfig{
+			PollInterval:   5 * time.Second,
+			Timeout:        10 * time.Second,
+			BatchSize:      50,
+			MaxAttempts:    8,
+			InitialBackoff: 30 * time.Second,
+			MaxBackoff:     6 * time.Hour,
+		},
+		Outbox: OutboxConfig{
+			PollInterval:   time.Second,
+			BatchSize:      100,
+			InitialBackoff: time.Second,
+			MaxBackoff:     5 * time.Minute,
+			Retention:      7 * 24 * time.Hour,
+			NATSSubject:    "events",
+			Timeout:        10 * time.Second,
+		},
+		Reminders: RemindersConfig{
+			Interval:        time.Minute,
+			BatchSize:       100,
+			RenewalLeadDays: []int{3},
+			EndLeadDays:     []int{7, 1},
+			MaxAttempts:     5,
+			InitialBackoff:  time.Minute,
+			MaxBackoff:      time.Hour,
+			Timeout:         10 * time.Second,
+		},
+		Budgets: BudgetsConfig{
+			Interval:   time.Hour,
+			Thresholds: []int{80, 100},
+		},
+		SMTP: SMTPConfig{
+			Port: "587",
+			From: "noreply@localhost",
+		},
+		Stream: StreamConfig{
+			BufferSize: 1024,
+			Heartbeat:  15 * time.Second,
+		},
+		Tracing: TracingConfig{
+			Exporter:     "none",
+			OTLPEndpoint: "localhost:4318",
+			ServiceName:  "subscription-service",
+			SampleRatio:  1,
+		},
+		Health: HealthConfig{
+			Timeout: 2 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Features: FeaturesConfig{
+			Search:      true,
+			EventStream: true,
+		},
+		Reload: ReloadConfig{
+			Interval: 10 * time.Second,
+		},
+	}
+}
+
+// applyEnv overrides cfg with the environment variables that are set
+func applyEnv(cfg *Config) error {
+	env := &envReader{}
+
+	env.String("SERVER_HOST", &cfg.Server.Host)
+	env.String("SERVER_PORT", &cfg.Server.Port)
+	env.Duration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	env.Duration("SERVER_READ_HEADER_TIMEOUT", &cfg.Server.ReadHeaderTimeout)
+	env.Duration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	env.Duration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	env.Duration("SERVER_SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+
+	env.Secret("DATABASE_URL", &cfg.Database.URL)
+	env.String("DB_HOST", &cfg.Database.Host)
+	env.String("DB_PORT", &cfg.Database.Port)
+	env.String("DB_USER", &cfg.Database.User)
+	env.Secret("DB_PASSWORD", &cfg.Database.Password)
+	env.String("DB_NAME", &cfg.Database.DBName)
+	env.String("DB_SSLMODE", &cfg.Database.SSLMode)
+	env.Strings("DB_REPLICAS", &cfg.Database.Replicas)
+	env.Int("DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns)
+	env.Int("DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns)
+	env.Duration("DB_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime)
+	env.Duration("DB_CONN_MAX_IDLE_TIME", &cfg.Database.ConnMaxIdleTime)
+	env.Duration("DB_CONNECT_TIMEOUT", &cfg.Database.ConnectTimeout)
+	env.Duration("DB_READ_TIMEOUT", &cfg.Database.QueryTimeouts.Read)
+	env.Duration("DB_WRITE_TIMEOUT", &cfg.Database.QueryTimeouts.Write)
+	env.Duration("DB_REPORT_TIMEOUT", &cfg.Database.QueryTimeouts.Report)
+	env.Duration("DB_BATCH_TIMEOUT", &cfg.Database.QueryTimeouts.Batch)
+	env.String("DB_TX_ISOLATION", &cfg.Database.TxIsolation)
+	env.Int("DB_TX_MAX_RETRIES", &cfg.Database.TxMaxRetries)
+
+	env.Duration("PURGE_RETENTION", &cfg.Purge.Retention)
+	env.Duration("PURGE_INTERVAL", &cfg.Purge.Interval)
+
+	env.Duration("IDEMPOTENCY_TTL", &cfg.Idempotency.TTL)
+	env.Duration("IDEMPOTENCY_CLEANUP_INTERVAL", &cfg.Idempotency.CleanupInterval)
+
+	env.Duration("WEBHOOK_POLL_INTERVAL", &cfg.Webhooks.PollInterval)
+	env.Duration("WEBHOOK_TIMEOUT", &cfg.Webhooks.Timeout)
+	env.Int("WEBHOOK_BATCH_SIZE", &cfg.Webhooks.BatchSize)
+	env.Int("WEBHOOK_MAX_ATTEMPTS", &cfg.Webhooks.MaxAttempts)
+	env.Duration("WEBHOOK_INITIAL_BACKOFF", &cfg.Webhooks.InitialBackoff)
+	env.Duration("WEBHOOK_MAX_BACKOFF", &cfg.Webhooks.MaxBackoff)
+
+	env.Duration("OUTBOX_POLL_INTERVAL", &cfg.Outbox.PollInterval)
+	env.Int("OUTBOX_BATCH_SIZE", &cfg.Outbox.BatchSize)
+	env.Duration("OUTBOX_INITIAL_BACKOFF", &cfg.Outbox.InitialBackoff)
+	env.Duration("OUTBOX_MAX_BACKOFF", &cfg.Outbox.MaxBackoff)
+	env.Duration("OUTBOX_RETENTION", &cfg.Outbox.Retention)
+	env.String("OUTBOX_HTTP_URL", &cfg.Outbox.HTTPURL)
+	env.String("OUTBOX_NATS_URL", &cfg.Outbox.NATSURL)
+	env.String("OUTBOX_NATS_SUBJECT", &cfg.Outbox.NATSSubject)
+	env.Duration("OUTBOX_TIMEOUT", &cfg.Outbox.Timeout)
+
+	env.Duration("REMINDER_INTERVAL", &cfg.Reminders.Interval)
+	env.Int("REMINDER_BATCH_SIZE", &cfg.Reminders.BatchSize)
+	env.Ints("REMINDER_RENEWAL_LEAD_DAYS", &cfg.Reminders.RenewalLeadDays)
+	env.Ints("REMINDER_END_LEAD_DAYS", &cfg.Reminders.EndLeadDays)
+	env.Int("REMINDER_MAX_ATTEMPTS", &cfg.Reminders.MaxAttempts)
+	env.Duration("REMINDER_INITIAL_BACKOFF", &cfg.Reminders.InitialBackoff)
+	env.Duration("REMINDER_MAX_BACKOFF", &cfg.Reminders.MaxBackoff)
+	env.Duration("REMINDER_TIMEOUT", &cfg.Reminders.Timeout)
+
+	env.Duration("BUDGET_INTERVAL", &cfg.Budgets.Interval)
+	env.Ints("BUDGET_THRESHOLDS", &cfg.Budgets.Thresholds)
+
+	env.String("SMTP_HOST", &cfg.SMTP.Host)
+	env.String("SMTP_PORT", &cfg.SMTP.Port)
+	env.String("SMTP_USERNAME", &cfg.SMTP.Username)
+	env.Secret("SMTP_PASSWORD", &cfg.SMTP.Password)
+	env.String("SMTP_FROM", &cfg.SMTP.From)
+
+	env.Int("STREAM_BUFFER_SIZE", &cfg.Stream.BufferSize)
+	env.Duration("STREAM_HEARTBEAT", &cfg.Stream.Heartbeat)
+
+	env.String("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	env.String("TRACING_OTLP_ENDPOINT", &cfg.Tracing.OTLPEndpoint)
+	env.Bool("TRACING_OTLP_INSECURE", &cfg.Tracing.OTLPInsecure)
+	env.String("TRACING_SERVICE_NAME", &cfg.Tracing.ServiceName)
+	env.Float("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+
+	env.Duration("HEALTH_TIMEOUT", &cfg.Health.Timeout)
+	env.Duration("HEALTH_SHUTDOWN_DELAY", &cfg.Health.ShutdownDelay)
+
+	env.String("LOG_LEVEL", &cfg.Log.Level)
+	env.String("LOG_FORMAT", &cfg.Log.Format)
+
+	env.Bool("FEATURE_SEARCH", &cfg.Features.Search)
+	env.Bool("FEATURE_EVENT_STREAM", &cfg.Features.EventStream)
+
+	env.Duration("CONFIG_RELOAD_INTERVAL", &cfg.Reload.Interval)
+
+	return errors.Join(env.errs...)
+}
+
 // loadYAMLConfig loads configuration from a YAML file
 func loadYAMLConfig(path string, cfg *Config) error {
 	absPath, err := filepath.Abs(path)
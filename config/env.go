@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileSuffix marks a variable naming a file that holds the value of a secret,
+// e.g. DB_PASSWORD_FILE=/run/secrets/db_password
+const fileSuffix = "_FILE"
+
+// envReader overrides configuration values with the environment variables
+// that are set, collecting an error for every value it cannot parse
+type envReader struct {
+	errs []error
+}
+
+// lookup returns the value of a variable that is set and not empty
+func (e *envReader) lookup(key string) (string, bool) {
+	value := os.Getenv(key)
+	return value, value != ""
+}
+
+// fail records a value that could not be parsed
+func (e *envReader) fail(key, value, expected string) {
+	e.errs = append(e.errs, fmt.Errorf("%s: %q is not %s", key, value, expected))
+}
+
+// String reads a string variable
+func (e *envReader) String(key string, target *string) {
+	if value, ok := e.lookup(key); ok {
+		*target = value
+	}
+}
+
+// Secret reads a string variable, or the file named by the variable with the
+// _FILE suffix; trailing newlines of the file are dropped
+func (e *envReader) Secret(key string, target *string) {
+	path, fromFile := e.lookup(key + fileSuffix)
+	if !fromFile {
+		e.String(key, target)
+		return
+	}
+
+	if _, ok := e.lookup(key); ok {
+		e.errs = append(e.errs, fmt.Errorf("%s and %s are both set", key, key+fileSuffix))
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %w", key+fileSuffix, err))
+		return
+	}
+	*target = strings.TrimRight(string(data), "\r\n")
+}
+
+// Strings reads a comma-separated list such as "https://a.example,https://b.example"
+func (e *envReader) Strings(key string, target *[]string) {
+	value, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	*target = values
+}
+
+// Int reads an integer variable
+func (e *envReader) Int(key string, target *int) {
+	if value, ok := e.lookup(key); ok {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			e.fail(key, value, "an integer")
+			return
+		}
+		*target = number
+	}
+}
+
+// Ints reads a comma-separated list of integers such as "7,1"
+func (e *envReader) Ints(key string, target *[]int) {
+	value, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+
+	var numbers []int
+	for _, part := range strings.Split(value, ",") {
+		number, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			e.fail(key, value, "a comma-separated list of integers")
+			return
+		}
+		numbers = append(numbers, number)
+	}
+	*target = numbers
+}
+
+// Bool reads a boolean variable such as "true"
+func (e *envReader) Bool(key string, target *bool) {
+	if value, ok := e.lookup(key); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			e.fail(key, value, "a boolean")
+			return
+		}
+		*target = parsed
+	}
+}
+
+// Float reads a floating-point variable
+func (e *envReader) Float(key string, target *float64) {
+	if value, ok := e.lookup(key); ok {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			e.fail(key, value, "a number")
+			return
+		}
+		*target = parsed
+	}
+}
+
+// Duration reads a duration variable such as "90m"
+func (e *envReader) Duration(key string, target *time.Duration) {
+	if value, ok := e.lookup(key); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			e.fail(key, value, "a duration such as 30s or 5m")
+			return
+		}
+		*target = parsed
+	}
+}
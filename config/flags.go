@@ -0,0 +1,48 @@
+package config
+
+import (
+	"flag"
+	"io"
+)
+
+// Flags are the command-line flags; the ones given override every other source
+type Flags struct {
+	ConfigPath  string
+	Host        string
+	Port        string
+	LogFormat   string
+	PrintConfig bool
+}
+
+// ParseFlags parses the command-line arguments without the program name.
+// Usage is written to output on -h or an unknown flag.
+func ParseFlags(args []string, output io.Writer) (*Flags, error) {
+	flags := &Flags{}
+
+	set := flag.NewFlagSet("subscription-service", flag.ContinueOnError)
+	set.SetOutput(output)
+	set.StringVar(&flags.ConfigPath, "config", "", "path of the YAML config file (default $CONFIG_PATH or config.yaml)")
+	set.StringVar(&flags.Host, "host", "", "address to listen on, overriding SERVER_HOST")
+	set.StringVar(&flags.Port, "port", "", "port to listen on, overriding SERVER_PORT")
+	set.StringVar(&flags.LogFormat, "log-format", "", "log format, text or json, overriding LOG_FORMAT")
+	set.BoolVar(&flags.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+
+	if err := set.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return flags, nil
+}
+
+// apply overrides cfg with the flags that were given
+func (f *Flags) apply(cfg *Config) {
+	if f.Host != "" {
+		cfg.Server.Host = f.Host
+	}
+	if f.Port != "" {
+		cfg.Server.Port = f.Port
+	}
+	if f.LogFormat != "" {
+		cfg.Log.Format = f.LogFormat
+	}
+}
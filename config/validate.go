@@ -0,0 +1,142 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in printed configuration
+const redacted = "[REDACTED]"
+
+// sslModes are the sslmode values understood by lib/pq
+var sslModes = map[string]bool{
+	"disable":     true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// txIsolations are the supported values of database.tx_isolation
+var txIsolations = map[string]bool{"read_committed": true, "repeatable_read": true, "serializable": true}
+
+// logLevels are the supported values of log.level
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+
+// logFormats are the supported values of log.format
+var logFormats = map[string]bool{"text": true, "json": true}
+
+// traceExporters are the supported values of tracing.exporter
+var traceExporters = map[string]bool{"none": true, "stdout": true, "otlp": true}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validPort(c.Server.Port), "server.port: %q is not a port between 1 and 65535", c.Server.Port)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+
+	// The discrete fields are only used without a full DSN
+	if c.Database.URL == "" {
+		check(c.Database.Host != "", "database.host: is required")
+		check(validPort(c.Database.Port), "database.port: %q is not a port between 1 and 65535", c.Database.Port)
+		check(c.Database.User != "", "database.user: is required")
+		check(c.Database.Password != "", "database.password: is required; set DB_PASSWORD or DB_PASSWORD_FILE")
+		check(c.Database.DBName != "", "database.dbname: is required")
+		check(sslModes[c.Database.SSLMode], "database.sslmode: %q is not one of disable, require, verify-ca or verify-full", c.Database.SSLMode)
+	}
+	for i, dsn := range c.Database.Replicas {
+		check(dsn != "", "database.replicas[%d]: must not be empty", i)
+	}
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns: must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns: must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns: %d exceeds max_open_conns %d", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	check(c.Database.ConnectTimeout > 0, "database.connect_timeout: must be positive")
+	timeouts := c.Database.QueryTimeouts
+	check(timeouts.Read >= 0, "database.query_timeouts.read: must not be negative")
+	check(timeouts.Write >= 0, "database.query_timeouts.write: must not be negative")
+	check(timeouts.Report >= 0, "database.query_timeouts.report: must not be negative")
+	check(timeouts.Batch >= 0, "database.query_timeouts.batch: must not be negative")
+	check(txIsolations[c.Database.TxIsolation], "database.tx_isolation: %q is not one of read_committed, repeatable_read or serializable", c.Database.TxIsolation)
+	check(c.Database.TxMaxRetries >= 0, "database.tx_max_retries: must not be negative")
+
+	check(c.Budgets.Interval >= 0, "budgets.interval: must not be negative")
+	check(len(c.Budgets.Thresholds) > 0, "budgets.thresholds: at least one is required")
+	for i, threshold := range c.Budgets.Thresholds {
+		check(threshold >= 1 && threshold <= 1000, "budgets.thresholds[%d]: %d is not a percentage between 1 and 1000", i, threshold)
+		check(i == 0 || threshold > c.Budgets.Thresholds[i-1], "budgets.thresholds[%d]: must be greater than the one before", i)
+	}
+
+	if c.SMTP.Host != "" {
+		check(validPort(c.SMTP.Port), "smtp.port: %q is not a port between 1 and 65535", c.SMTP.Port)
+		check(c.SMTP.From != "", "smtp.from: is required when smtp.host is set")
+		check(c.SMTP.Username == "" || c.SMTP.Password != "", "smtp.password: is required when smtp.username is set; set SMTP_PASSWORD or SMTP_PASSWORD_FILE")
+	}
+
+	check(traceExporters[c.Tracing.Exporter], "tracing.exporter: %q is not one of none, stdout or otlp", c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio: %v is not between 0 and 1", c.Tracing.SampleRatio)
+
+	check(logLevels[c.Log.Level], "log.level: %q is not one of debug, info, warn or error", c.Log.Level)
+	check(logFormats[c.Log.Format], "log.format: %q is not one of text or json", c.Log.Format)
+
+	check(c.Reload.Interval >= 0, "reload.interval: must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// redactDSN hides the password of a URL DSN and keeps the rest readable;
+// key=value DSNs are hidden entirely
+func redactDSN(dsn string) string {
+	if parsed, err := url.Parse(dsn); err == nil && parsed.Scheme != "" {
+		return parsed.Redacted()
+	}
+	return redacted
+}
+
+// validPort reports whether port is a TCP port number
+func validPort(port string) bool {
+	number, err := strconv.Atoi(port)
+	return err == nil && number >= 1 && number <= 65535
+}
+
+// Redacted returns a copy of the configuration with its secrets replaced
+func (c *Config) Redacted() *Config {
+	copied := *c
+	for _, secret := range []*string{&copied.Database.Password, &copied.SMTP.Password} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+
+	if copied.Database.URL != "" {
+		copied.Database.URL = redactDSN(copied.Database.URL)
+	}
+	if len(c.Database.Replicas) > 0 {
+		copied.Database.Replicas = make([]string, len(c.Database.Replicas))
+		for i, dsn := range c.Database.Replicas {
+			copied.Database.Replicas[i] = redactDSN(dsn)
+		}
+	}
+
+	return &copied
+}
+
+// Print writes the configuration as YAML with its secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	return encoder.Close()
+}
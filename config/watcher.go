@@ -0,0 +1,180 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"subscription-service/logger"
+)
+
+// Watcher reloads the configuration when the config file changes or the
+// process receives SIGHUP. Only the reloadable sections (log and features)
+// take effect; changes to anything else are logged and ignored until the
+// next restart.
+type Watcher struct {
+	flags    *Flags
+	current  atomic.Pointer[Config]
+	checksum []byte // Of the config file as last loaded
+	mutex    sync.Mutex
+	onReload []func(*Config)
+	logger   *logger.Logger
+}
+
+// NewWatcher creates a watcher starting from the configuration loaded with flags
+func NewWatcher(cfg *Config, flags *Flags, logger *logger.Logger) *Watcher {
+	if flags == nil {
+		flags = &Flags{}
+	}
+
+	w := &Watcher{flags: flags, logger: logger}
+	w.current.Store(cfg)
+	w.checksum, _ = w.fileChecksum()
+	return w
+}
+
+// Current returns the configuration in effect; it must not be modified
+func (w *Watcher) Current() *Config {
+	return w.current.Load()
+}
+
+// OnReload registers fn to be called with the new configuration after every
+// reload that changed a reloadable setting
+func (w *Watcher) OnReload(fn func(*Config)) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.onReload = append(w.onReload, fn)
+}
+
+// Run reloads on SIGHUP and whenever the file changes, checking every
+// reload.interval, until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var poll <-chan time.Time
+	if interval := w.Current().Reload.Interval; interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			w.logger.Info("Reloading configuration on SIGHUP")
+			w.Reload()
+		case <-poll:
+			if w.fileChanged() {
+				w.logger.Info("Reloading configuration after the config file changed")
+				w.Reload()
+			}
+		}
+	}
+}
+
+// Reload loads the configuration again and swaps in its reloadable sections.
+// An invalid configuration is logged and leaves the current one in place.
+func (w *Watcher) Reload() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// Remember the file even if it turns out invalid, so it is not retried until it changes
+	w.checksum, _ = w.fileChecksum()
+
+	loaded, err := LoadConfig(w.flags)
+	if err != nil {
+		w.logger.Errorf("Keeping the current configuration: %v", err)
+		return err
+	}
+
+	current := w.Current()
+	if ignored := diff(current.static(), loaded.static(), ""); len(ignored) > 0 {
+		w.logger.Warnf("Ignoring changes to %s; they take effect after a restart", strings.Join(ignored, ", "))
+	}
+
+	next := *current
+	next.Log, next.Features = loaded.Log, loaded.Features
+	if reflect.DeepEqual(&next, current) {
+		return nil
+	}
+
+	w.current.Store(&next)
+	for _, fn := range w.onReload {
+		fn(&next)
+	}
+	w.logger.Infof("Applied reloaded configuration: log level %s, log format %s, features %+v", next.Log.Level, next.Log.Format, next.Features)
+
+	return nil
+}
+
+// static returns a copy of the configuration without its reloadable sections
+func (c *Config) static() *Config {
+	copied := *c
+	copied.Log, copied.Features = LogConfig{}, FeaturesConfig{}
+	return &copied
+}
+
+// fileChanged reports whether the config file differs from the one last loaded
+func (w *Watcher) fileChanged() bool {
+	checksum, err := w.fileChecksum()
+	if err != nil {
+		return false
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return !bytes.Equal(checksum, w.checksum)
+}
+
+// fileChecksum hashes the config file so that changes are noticed even when
+// the modification time is kept, as with Kubernetes ConfigMap updates
+func (w *Watcher) fileChecksum() ([]byte, error) {
+	path := w.flags.ConfigPath
+	if path == "" {
+		path = getEnv("CONFIG_PATH", "config.yaml")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// diff lists the YAML paths of the settings that differ between a and b
+func diff(a, b interface{}, prefix string) []string {
+	va, vb := reflect.Indirect(reflect.ValueOf(a)), reflect.Indirect(reflect.ValueOf(b))
+	if va.Kind() != reflect.Struct {
+		if reflect.DeepEqual(va.Interface(), vb.Interface()) {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	var changed []string
+	for i := 0; i < va.NumField(); i++ {
+		name := strings.Split(va.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if prefix != "" {
+			name = fmt.Sprintf("%s.%s", prefix, name)
+		}
+		changed = append(changed, diff(va.Field(i).Interface(), vb.Field(i).Interface(), name)...)
+	}
+	return changed
+}
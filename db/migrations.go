@@ -0,0 +1,397 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// migrationLockID is the advisory lock key that serializes migrations across replicas
+const migrationLockID = 72340172838076673
+
+// migration represents a single versioned schema change
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+// migrations lists every schema change in the order it must be applied.
+// Append new entries at the end; never edit an entry that has already shipped.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create subscriptions table",
+		statements: []string{`
+			CREATE TABLE IF NOT EXISTS subscriptions (
+				id SERIAL PRIMARY KEY,
+				service_name VARCHAR(255) NOT NULL,
+				price INTEGER NOT NULL,
+				user_id UUID NOT NULL,
+				start_date VARCHAR(7) NOT NULL,
+				end_date VARCHAR(7),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)
+		`},
+	},
+	{
+		version:     2,
+		description: "add soft delete to subscriptions",
+		statements: []string{
+			`ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`,
+			`CREATE INDEX IF NOT EXISTS idx_subscriptions_deleted_at ON subscriptions (deleted_at) WHERE deleted_at IS NOT NULL`,
+		},
+	},
+	{
+		version:     3,
+		description: "create append-only audit log",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id BIGSERIAL PRIMARY KEY,
+				actor VARCHAR(255) NOT NULL,
+				request_id VARCHAR(255),
+				entity_type VARCHAR(64) NOT NULL,
+				entity_id INTEGER NOT NULL,
+				action VARCHAR(32) NOT NULL,
+				before JSONB,
+				after JSONB,
+				changes JSONB,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity_type, entity_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at)`,
+			`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'audit_log is append-only';
+			END;
+			$$ LANGUAGE plpgsql`,
+			`CREATE TRIGGER audit_log_append_only
+				BEFORE UPDATE OR DELETE ON audit_log
+				FOR EACH ROW EXECUTE FUNCTION audit_log_append_only()`,
+		},
+	},
+	{
+		version:     4,
+		description: "add optimistic concurrency version to subscriptions",
+		statements: []string{
+			`ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		version:     5,
+		description: "create idempotency keys",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS idempotency_keys (
+				key VARCHAR(255) PRIMARY KEY,
+				fingerprint VARCHAR(64) NOT NULL,
+				status_code INTEGER,
+				response_headers JSONB,
+				response_body BYTEA,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				expires_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at)`,
+		},
+	},
+	{
+		version:     6,
+		description: "create webhook endpoints and deliveries",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS webhook_endpoints (
+				id SERIAL PRIMARY KEY,
+				url TEXT NOT NULL,
+				events TEXT[] NOT NULL DEFAULT '{}',
+				secret VARCHAR(255) NOT NULL,
+				active BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+				id BIGSERIAL PRIMARY KEY,
+				endpoint_id INTEGER NOT NULL REFERENCES webhook_endpoints (id) ON DELETE CASCADE,
+				event_id UUID NOT NULL,
+				event_type VARCHAR(64) NOT NULL,
+				payload JSONB NOT NULL,
+				status VARCHAR(16) NOT NULL DEFAULT 'pending',
+				attempts INTEGER NOT NULL DEFAULT 0,
+				next_attempt_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				last_status_code INTEGER,
+				last_error TEXT,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending'`,
+			`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries (endpoint_id, id)`,
+		},
+	},
+	{
+		version:     7,
+		description: "create outbox",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS outbox (
+				id BIGSERIAL PRIMARY KEY,
+				aggregate_type VARCHAR(64) NOT NULL,
+				aggregate_id VARCHAR(64) NOT NULL,
+				event_id UUID NOT NULL UNIQUE,
+				event_type VARCHAR(64) NOT NULL,
+				payload JSONB NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				last_error TEXT,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				published_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox (aggregate_type, aggregate_id, id) WHERE published_at IS NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox (published_at) WHERE published_at IS NOT NULL`,
+			// The relay publishes at least once, so webhook deliveries are deduplicated by event
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries (endpoint_id, event_id)`,
+		},
+	},
+	{
+		version:     8,
+		description: "create reminder preferences and jobs",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS reminder_preferences (
+				user_id UUID PRIMARY KEY,
+				enabled BOOLEAN NOT NULL DEFAULT TRUE,
+				renewal_lead_days INTEGER[] NOT NULL DEFAULT '{}',
+				end_lead_days INTEGER[] NOT NULL DEFAULT '{}',
+				channel VARCHAR(16) NOT NULL,
+				target TEXT,
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS reminder_jobs (
+				id BIGSERIAL PRIMARY KEY,
+				subscription_id INTEGER NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+				user_id UUID NOT NULL,
+				kind VARCHAR(16) NOT NULL,
+				due_on TIMESTAMPTZ NOT NULL,
+				lead_days INTEGER NOT NULL,
+				send_at TIMESTAMPTZ NOT NULL,
+				channel VARCHAR(16) NOT NULL,
+				target TEXT,
+				status VARCHAR(16) NOT NULL DEFAULT 'pending',
+				attempts INTEGER NOT NULL DEFAULT 0,
+				next_attempt_at TIMESTAMPTZ NOT NULL,
+				last_error TEXT,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				sent_at TIMESTAMPTZ,
+				-- Every replica plans the same jobs; only the first insert of each wins
+				UNIQUE (subscription_id, kind, due_on, lead_days)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_reminder_jobs_due ON reminder_jobs (next_attempt_at) WHERE status = 'pending'`,
+			`CREATE INDEX IF NOT EXISTS idx_reminder_jobs_user_id ON reminder_jobs (user_id, id)`,
+		},
+	},
+	{
+		version:     9,
+		description: "index the sort keys and service name prefix of subscription lists",
+		statements: []string{
+			`CREATE INDEX IF NOT EXISTS idx_subscriptions_price ON subscriptions (price, id) WHERE deleted_at IS NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_subscriptions_created_at ON subscriptions (created_at, id) WHERE deleted_at IS NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_subscriptions_service_name ON subscriptions (service_name, id) WHERE deleted_at IS NULL`,
+			// Must match the expression the repository orders start dates by
+			`CREATE INDEX IF NOT EXISTS idx_subscriptions_start_month ON subscriptions
+				((substring(start_date from 4) || substring(start_date for 2)), id) WHERE deleted_at IS NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_subscriptions_service_name_prefix ON subscriptions
+				(lower(service_name) text_pattern_ops) WHERE deleted_at IS NULL`,
+		},
+	},
+	{
+		version:     10,
+		description: "search service names by trigrams and full text",
+		statements: []string{
+			`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+			// Must spell names like search.Normalize: Cyrillic in Latin letters,
+			// "x" as "ks", and words of letters and digits separated by single
+			// spaces. Capitals are folded by translate as lower may leave
+			// Cyrillic ones alone depending on the locale.
+			`CREATE OR REPLACE FUNCTION translit(name TEXT) RETURNS TEXT AS $$
+				SELECT btrim(regexp_replace(
+					replace(translate(
+						replace(replace(replace(replace(replace(replace(replace(replace(replace(replace(
+							lower(translate(name,
+								'АБВГДЕЁЖЗИЙКЛМНОПРСТУФХЦЧШЩЪЫЬЭЮЯ',
+								'абвгдеёжзийклмнопрстуфхцчшщъыьэюя')),
+							'щ', 'shch'), 'ж', 'zh'), 'х', 'kh'), 'ц', 'ts'), 'ч', 'ch'),
+							'ш', 'sh'), 'ю', 'yu'), 'я', 'ya'), 'ъ', ''), 'ь', ''),
+						'абвгдеёзийклмнопрстуфыэ',
+						'abvgdeeziyklmnoprstufye'),
+					'x', 'ks'),
+					'[^a-z0-9]+', ' ', 'g'))
+			$$ LANGUAGE SQL IMMUTABLE STRICT PARALLEL SAFE`,
+			`ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS search_name TEXT
+				GENERATED ALWAYS AS (translit(service_name)) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_subscriptions_search_name_trgm ON subscriptions
+				USING GIN (search_name gin_trgm_ops) WHERE deleted_at IS NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_subscriptions_search_name_fts ON subscriptions
+				USING GIN (to_tsvector('simple', search_name)) WHERE deleted_at IS NULL`,
+		},
+	},
+	{
+		version:     11,
+		description: "catalog services and refer to them from subscriptions",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS services (
+				id SERIAL PRIMARY KEY,
+				name VARCHAR(255) NOT NULL UNIQUE,
+				category VARCHAR(64),
+				logo_url TEXT,
+				default_price INTEGER CHECK (default_price > 0),
+				created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+			)`,
+			// Aliases are keyed like models.ServiceKey: lowercased, trimmed and
+			// with inner whitespace collapsed
+			`CREATE TABLE IF NOT EXISTS service_aliases (
+				alias VARCHAR(255) PRIMARY KEY,
+				service_id INTEGER NOT NULL REFERENCES services (id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_service_aliases_service_id ON service_aliases (service_id)`,
+			`ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS service_id INTEGER REFERENCES services (id)`,
+			// The spelling most subscriptions use becomes the canonical name of
+			// the names that differ only in case and whitespace. Names that are
+			// blank, which were once accepted, go to an "Unknown" service.
+			`INSERT INTO services (name)
+				SELECT DISTINCT ON (lower(name)) name FROM (
+					SELECT COALESCE(NULLIF(btrim(regexp_replace(service_name, '\s+', ' ', 'g')), ''), 'Unknown') AS name,
+						COUNT(*) AS uses
+					FROM subscriptions GROUP BY 1
+				) AS spellings
+				ORDER BY lower(name), uses DESC, name
+				ON CONFLICT (name) DO NOTHING`,
+			`INSERT INTO service_aliases (alias, service_id)
+				SELECT lower(name), id FROM services
+				ON CONFLICT (alias) DO NOTHING`,
+			`UPDATE subscriptions SET service_id = service_aliases.service_id, service_name = services.name
+				FROM service_aliases JOIN services ON services.id = service_aliases.service_id
+				WHERE service_aliases.alias =
+					lower(COALESCE(NULLIF(btrim(regexp_replace(subscriptions.service_name, '\s+', ' ', 'g')), ''), 'Unknown'))`,
+			`ALTER TABLE subscriptions ALTER COLUMN service_id SET NOT NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_subscriptions_service_id ON subscriptions (service_id)
+				WHERE deleted_at IS NULL`,
+		},
+	},
+	{
+		version:     12,
+		description: "tag subscriptions",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS tags (
+				id SERIAL PRIMARY KEY,
+				user_id UUID NOT NULL,
+				name VARCHAR(64) NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_name ON tags (user_id, lower(name))`,
+			`CREATE TABLE IF NOT EXISTS subscription_tags (
+				subscription_id INTEGER NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+				tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+				PRIMARY KEY (subscription_id, tag_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_subscription_tags_tag_id ON subscription_tags (tag_id, subscription_id)`,
+		},
+	},
+	{
+		version:     13,
+		description: "monthly budgets and their alerts",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS budgets (
+				id SERIAL PRIMARY KEY,
+				user_id UUID NOT NULL,
+				scope VARCHAR(16) NOT NULL CHECK (scope IN ('overall', 'category', 'service')),
+				category VARCHAR(64),
+				service_id INTEGER REFERENCES services (id) ON DELETE CASCADE,
+				amount INTEGER NOT NULL CHECK (amount > 0),
+				thresholds INTEGER[] NOT NULL DEFAULT '{}',
+				channel VARCHAR(16) NOT NULL,
+				target TEXT,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_budgets_user_id ON budgets (user_id, id)`,
+			// One row per alert sent, so that replicas send each alert once
+			`CREATE TABLE IF NOT EXISTS budget_alerts (
+				budget_id INTEGER NOT NULL REFERENCES budgets (id) ON DELETE CASCADE,
+				month VARCHAR(7) NOT NULL,
+				threshold INTEGER NOT NULL,
+				sent_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (budget_id, month, threshold)
+			)`,
+		},
+	},
+}
+
+// MigrateTo applies the migrations up to and including version, so that tests
+// can store data the way an older schema held it before migrating further
+func (p *PostgresDB) MigrateTo(version int) error {
+	return p.applyMigrations(version)
+}
+
+// applyMigrations applies every migration newer than the recorded schema
+// version, up to and including target
+func (p *PostgresDB) applyMigrations(target int) error {
+	_, err := p.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only one replica may migrate at a time; the lock is released on commit
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+
+	var current int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current || m.version > target {
+			continue
+		}
+
+		for _, statement := range m.statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+			}
+		}
+
+		if _, err := tx.Exec(
+			"INSERT INTO schema_migrations (version, description) VALUES ($1, $2)",
+			m.version, m.description,
+		); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migrations: %w", err)
+	}
+
+	return nil
+}
+
+// CheckMigrations reports an error unless every known migration has been applied
+func (p *PostgresDB) CheckMigrations(ctx context.Context) error {
+	var current int
+	if err := p.DB.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	if latest := migrations[len(migrations)-1].version; current < latest {
+		return fmt.Errorf("schema is at version %d, expected %d", current, latest)
+	}
+
+	return nil
+}
@@ -1,75 +1,219 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"subscription-service/backoff"
 	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/tracing"
+	"sync/atomic"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // PostgresDB represents a PostgreSQL database connection
 type PostgresDB struct {
-	DB *sql.DB
+	DB           *sql.DB                   // The primary, which takes all writes
+	Timeouts     config.QueryTimeoutConfig // Default timeouts of the repositories' operations
+	TxOptions    *sql.TxOptions            // Options every transaction is started with
+	TxMaxRetries int                       // How often a transaction that lost a conflict is run again
+	connStr      string
+	replicas     []*replica
+	nextReplica  atomic.Uint64
+	logger       *logger.Logger
 }
 
-// NewPostgresDB creates a new PostgreSQL database connection
-func NewPostgresDB(cfg config.DatabaseConfig) (*PostgresDB, error) {
-	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
-	)
+const (
+	// initialConnectBackoff is the delay before the first connection retry; it doubles per attempt
+	initialConnectBackoff = 500 * time.Millisecond
+	// maxConnectBackoff caps the delay between connection retries
+	maxConnectBackoff = 10 * time.Second
+)
+
+// NewPostgresDB creates a new PostgreSQL database connection pool. It retries
+// with backoff until the database answers or cfg.ConnectTimeout has passed, so
+// that the service can start alongside its database.
+func NewPostgresDB(ctx context.Context, cfg config.DatabaseConfig, logger *logger.Logger) (*PostgresDB, error) {
+	connStr := ConnString(cfg)
+
+	db, err := openPool(connStr, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			break
+		}
+
+		delay := backoff.Exponential(attempt, initialConnectBackoff, maxConnectBackoff)
+		logger.Warnf("Database is not reachable (attempt %d), retrying in %s: %v", attempt, delay, err)
+
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, fmt.Errorf("failed to ping database within %s: %w", cfg.ConnectTimeout, err)
+		case <-time.After(delay):
+		}
+	}
 
-	db, err := sql.Open("postgres", connStr)
+	postgres := &PostgresDB{
+		DB:           db,
+		Timeouts:     cfg.QueryTimeouts,
+		TxOptions:    &sql.TxOptions{Isolation: isolationLevels[cfg.TxIsolation]},
+		TxMaxRetries: cfg.TxMaxRetries,
+		connStr:      connStr,
+		logger:       logger,
+	}
+
+	// Replicas are connected lazily: one that is down only costs a failover
+	for i, dsn := range cfg.Replicas {
+		pool, err := openPool(dsn, cfg)
+		if err != nil {
+			postgres.Close()
+			return nil, fmt.Errorf("failed to open read replica %d: %w", i+1, err)
+		}
+		postgres.replicas = append(postgres.replicas, &replica{name: fmt.Sprintf("replica-%d", i+1), db: pool})
+	}
+	if len(postgres.replicas) > 0 {
+		logger.Infof("Routing reads to %d read replicas", len(postgres.replicas))
+	}
+
+	return postgres, nil
+}
+
+// openPool creates a connection pool for connStr with the pool settings of cfg
+func openPool(connStr string, cfg config.DatabaseConfig) (*sql.DB, error) {
+	connector, err := pq.NewConnector(connStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	// Queries run with a traced context show up as child spans of the request
+	db := sql.OpenDB(tracing.WrapConnector(connector))
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	return db, nil
+}
+
+// ConnString returns the DSN of cfg: its URL if set, otherwise key=value pairs
+// built from the discrete fields
+func ConnString(cfg config.DatabaseConfig) string {
+	if cfg.URL != "" {
+		return cfg.URL
+	}
+
+	pairs := []struct{ key, value string }{
+		{"host", cfg.Host},
+		{"port", cfg.Port},
+		{"user", cfg.User},
+		{"password", cfg.Password},
+		{"dbname", cfg.DBName},
+		{"sslmode", cfg.SSLMode},
+	}
+
+	parts := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		parts = append(parts, pair.key+"="+quoteConnValue(pair.value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteConnValue quotes a value of a key=value DSN so that spaces, quotes and
+// backslashes, e.g. in a password, survive parsing
+func quoteConnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
 	}
 
-	return &PostgresDB{DB: db}, nil
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// NewListener opens a dedicated connection for LISTEN/NOTIFY that reconnects on its own
+func (p *PostgresDB) NewListener() *pq.Listener {
+	return pq.NewListener(p.connStr, time.Second, time.Minute, nil)
 }
 
-// Close closes the database connection
+// Logger returns the logger of the database, for repositories that report
+// failures they recover from
+func (p *PostgresDB) Logger() *logger.Logger {
+	return p.logger
+}
+
+// Close closes the connections to the primary and the replicas
 func (p *PostgresDB) Close() error {
-	return p.DB.Close()
+	errs := []error{p.DB.Close()}
+	for _, replica := range p.replicas {
+		errs = append(errs, replica.db.Close())
+	}
+	return errors.Join(errs...)
 }
 
 // RunMigrations runs database migrations
 func (p *PostgresDB) RunMigrations() error {
-	// Create subscriptions table
-	_, err := p.DB.Exec(`
-		CREATE TABLE IF NOT EXISTS subscriptions (
-			id SERIAL PRIMARY KEY,
-			service_name VARCHAR(255) NOT NULL,
-			price INTEGER NOT NULL,
-			user_id UUID NOT NULL,
-			start_date VARCHAR(7) NOT NULL,
-			end_date VARCHAR(7),
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create subscriptions table: %w", err)
+	if err := p.applyMigrations(migrations[len(migrations)-1].version); err != nil {
+		return err
 	}
 
 	// Insert some test data if the table is empty
 	var count int
-	err = p.DB.QueryRow("SELECT COUNT(*) FROM subscriptions").Scan(&count)
+	err := p.DB.QueryRow("SELECT COUNT(*) FROM subscriptions").Scan(&count)
 	if err != nil {
 		return fmt.Errorf("failed to count subscriptions: %w", err)
 	}
 
 	if count == 0 {
 		_, err = p.DB.Exec(`
-			INSERT INTO subscriptions (service_name, price, user_id, start_date, end_date)
-			VALUES 
-			('Netflix', 599, '60601fee-2bf1-4721-ae6f-7636e79a0cba', '01-2023', '01-2024'),
-			('Spotify', 199, '60601fee-2bf1-4721-ae6f-7636e79a0cba', '02-2023', NULL),
-			('Yandex Plus', 299, '70701fee-3bf1-5721-be6f-8636e79a0cba', '03-2023', '03-2024')
+			INSERT INTO services (name, category, default_price)
+			VALUES
+			('Netflix', 'video', 599),
+			('Spotify', 'music', 199),
+			('Yandex Plus', 'bundle', 299)
+			ON CONFLICT (name) DO NOTHING
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to insert test services: %w", err)
+		}
+
+		_, err = p.DB.Exec(`
+			INSERT INTO service_aliases (alias, service_id)
+			SELECT aliases.alias, services.id
+			FROM (VALUES
+				('netflix', 'Netflix'),
+				('spotify', 'Spotify'),
+				('yandex plus', 'Yandex Plus'),
+				('яндекс плюс', 'Yandex Plus')
+			) AS aliases (alias, name)
+			JOIN services ON services.name = aliases.name
+			ON CONFLICT (alias) DO NOTHING
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to insert test service aliases: %w", err)
+		}
+
+		_, err = p.DB.Exec(`
+			INSERT INTO subscriptions (service_id, service_name, price, user_id, start_date, end_date)
+			SELECT services.id, services.name, seed.price, seed.user_id::uuid, seed.start_date, seed.end_date
+			FROM (VALUES
+				('Netflix', 599, '60601fee-2bf1-4721-ae6f-7636e79a0cba', '01-2023', '01-2024'),
+				('Spotify', 199, '60601fee-2bf1-4721-ae6f-7636e79a0cba', '02-2023', NULL),
+				('Yandex Plus', 299, '70701fee-3bf1-5721-be6f-8636e79a0cba', '03-2023', '03-2024')
+			) AS seed (name, price, user_id, start_date, end_date)
+			JOIN services ON services.name = seed.name
 		`)
 		if err != nil {
 			return fmt.Errorf("failed to insert test data: %w", err)
@@ -77,4 +221,4 @@ func (p *PostgresDB) RunMigrations() error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
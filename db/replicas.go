@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// primaryNode names the primary in the logs of routed reads
+const primaryNode = "primary"
+
+// replica is a read replica reads are spread over
+type replica struct {
+	name string
+	db   *sql.DB
+}
+
+// primaryKey marks a context whose reads must go to the primary
+type primaryKey struct{}
+
+// WithPrimary returns a context whose reads go to the primary, for reads that
+// must see the latest writes, e.g. the version a conditional update checks
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// Read runs fn on the next read replica in turn, or on the primary if there
+// are none or ctx was made by WithPrimary. If fn fails on a replica it is run
+// again on the primary, unless it failed with sql.ErrNoRows or because ctx
+// ended. Which node served the read of operation is logged at debug level.
+func (p *PostgresDB) Read(ctx context.Context, operation string, fn func(db *sql.DB) error) error {
+	if len(p.replicas) == 0 || ctx.Value(primaryKey{}) != nil {
+		p.logger.Debugf("Read %s served by %s", operation, primaryNode)
+		return fn(p.DB)
+	}
+
+	replica := p.replicas[(p.nextReplica.Add(1)-1)%uint64(len(p.replicas))]
+	err := fn(replica.db)
+	if err == nil || errors.Is(err, sql.ErrNoRows) || ctx.Err() != nil {
+		p.logger.Debugf("Read %s served by %s", operation, replica.name)
+		return err
+	}
+
+	p.logger.Warnf("Read %s failed on %s, failing over to the %s: %v", operation, replica.name, primaryNode, err)
+	p.logger.Debugf("Read %s served by %s", operation, primaryNode)
+	return fn(p.DB)
+}
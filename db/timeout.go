@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WithTimeout bounds ctx by timeout for one operation; a zero timeout or an
+// earlier deadline of ctx is left as is. The returned function must be called
+// with the operation's error once it is done: it releases the context and,
+// if the context ended, makes the error match context.DeadlineExceeded or
+// context.Canceled, as the driver reports a cancelled statement as a plain
+// database error.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, func(error) error) {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	return ctx, func(err error) error {
+		defer cancel()
+		return contextError(ctx, err)
+	}
+}
+
+// contextError wraps err in the error of ctx if ctx has ended
+func contextError(ctx context.Context, err error) error {
+	cause := ctx.Err()
+	if err == nil || cause == nil || errors.Is(err, cause) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", cause, err)
+}
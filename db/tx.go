@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+
+	"subscription-service/backoff"
+)
+
+// SQLSTATEs of a transaction aborted in favour of a concurrent one; running it
+// again can succeed
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+const (
+	// initialRetryBackoff is the delay before a transaction is first run again; it doubles per attempt
+	initialRetryBackoff = 10 * time.Millisecond
+	// maxRetryBackoff caps the delay between runs of a transaction
+	maxRetryBackoff = 500 * time.Millisecond
+)
+
+// isolationLevels maps the values of database.tx_isolation to their levels
+var isolationLevels = map[string]sql.IsolationLevel{
+	"read_committed":  sql.LevelReadCommitted,
+	"repeatable_read": sql.LevelRepeatableRead,
+	"serializable":    sql.LevelSerializable,
+}
+
+// IsRetryable reports whether err aborted a transaction that can succeed when
+// run again, i.e. a serialization failure or a deadlock
+func IsRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == serializationFailure || pqErr.Code == deadlockDetected
+}
+
+// Retry runs fn and, while it fails with a retryable error, up to retries more
+// times. The delay between runs grows exponentially and is jittered so that
+// the conflicting transactions do not collide again.
+func Retry(ctx context.Context, retries int, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > retries || !IsRetryable(err) {
+			return err
+		}
+
+		delay := backoff.Exponential(attempt, initialRetryBackoff, maxRetryBackoff)
+		delay = delay/2 + rand.N(delay/2+1)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
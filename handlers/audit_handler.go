@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"subscription-service/logger"
+	"subscription-service/middleware"
+	"subscription-service/models"
+	"subscription-service/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// actorHeader identifies who performs a change; it is recorded in the audit log
+	actorHeader = "X-Actor"
+	// anonymousActor is recorded when a request does not identify its actor
+	anonymousActor = "anonymous"
+)
+
+// AuditHandler handles HTTP requests for the audit log
+type AuditHandler struct {
+	Repo   repository.AuditLog
+	Logger *logger.Logger
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(repo repository.AuditLog, logger *logger.Logger) *AuditHandler {
+	return &AuditHandler{Repo: repo, Logger: logger}
+}
+
+// List godoc
+// @Summary List audit entries
+// @Description List recorded subscription changes, newest first
+// @Tags audit
+// @Produce json
+// @Param actor query string false "Filter by actor"
+// @Param entity_id query int false "Filter by subscription ID"
+// @Param action query string false "Filter by action (create, update, delete, restore)"
+// @Param from query string false "Only entries at or after this time (RFC 3339)"
+// @Param to query string false "Only entries at or before this time (RFC 3339)"
+// @Param limit query int false "Page size (1-500, default 50)"
+// @Param offset query int false "Number of entries to skip"
+// @Success 200 {object} models.ListAuditResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /audit [get]
+func (h *AuditHandler) List(c *gin.Context) {
+	var req models.ListAuditRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, total, err := h.Repo.ListAudit(c.Request.Context(), &req)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to list audit entries: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to list audit entries")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Listed %d of %d audit entries", len(entries), total)
+	c.JSON(http.StatusOK, models.ListAuditResponse{
+		Items:  entries,
+		Total:  total,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	})
+}
+
+// auditInfo extracts the actor and request ID of a mutating request
+func auditInfo(c *gin.Context) models.AuditInfo {
+	actor := c.GetHeader(actorHeader)
+	if actor == "" {
+		actor = anonymousActor
+	}
+
+	return models.AuditInfo{
+		Actor:     actor,
+		RequestID: middleware.GetRequestID(c),
+	}
+}
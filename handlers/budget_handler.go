@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"subscription-service/budgets"
+	"subscription-service/logger"
+	"subscription-service/middleware"
+	"subscription-service/models"
+	"subscription-service/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// BudgetHandler handles HTTP requests for monthly budgets
+type BudgetHandler struct {
+	Budgets   repository.BudgetStore
+	Evaluator *budgets.Evaluator
+	Logger    *logger.Logger
+}
+
+// NewBudgetHandler creates a new budget handler
+func NewBudgetHandler(store repository.BudgetStore, evaluator *budgets.Evaluator, logger *logger.Logger) *BudgetHandler {
+	return &BudgetHandler{Budgets: store, Evaluator: evaluator, Logger: logger}
+}
+
+// Create godoc
+// @Summary Create a budget
+// @Description Create a monthly budget for all subscriptions of a user, those of a catalog category or those of one service. Alerts go out through the channel of the budget when the spend reaches its thresholds, or the configured ones if it has none.
+// @Tags budgets
+// @Accept json
+// @Produce json
+// @Param budget body models.CreateBudgetRequest true "Budget"
+// @Success 201 {object} models.Budget
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /budgets [post]
+func (h *BudgetHandler) Create(c *gin.Context) {
+	var req models.CreateBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind JSON: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.AddLogField(c, "user_id", req.UserID)
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget, err := h.Budgets.CreateBudget(c.Request.Context(), &req)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to create budget: %v", err)
+		h.respondError(c, err, "Failed to create budget")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Created budget with ID: %d", budget.ID)
+	c.JSON(http.StatusCreated, budget)
+}
+
+// List godoc
+// @Summary List budgets
+// @Description List budgets by ID
+// @Tags budgets
+// @Produce json
+// @Param user_id query string false "Filter by user ID"
+// @Success 200 {array} models.Budget
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /budgets [get]
+func (h *BudgetHandler) List(c *gin.Context) {
+	var req models.ListBudgetsRequest
+
+	userIDStr := c.Query("user_id")
+	if userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			middleware.Logger(c, h.Logger).Errorf("Invalid user ID: %s", userIDStr)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+			return
+		}
+		req.UserID = &userID
+	}
+
+	list, err := h.Budgets.ListBudgets(c.Request.Context(), &req)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to list budgets: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to list budgets")
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// Get godoc
+// @Summary Get a budget
+// @Description Get a budget by ID
+// @Tags budgets
+// @Produce json
+// @Param id path int true "Budget ID"
+// @Success 200 {object} models.Budget
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /budgets/{id} [get]
+func (h *BudgetHandler) Get(c *gin.Context) {
+	budget, ok := h.budget(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, budget)
+}
+
+// Update godoc
+// @Summary Update a budget
+// @Description Replace a budget. Alerts already sent for it are forgotten, so thresholds the spend has reached alert again under the new budget.
+// @Tags budgets
+// @Accept json
+// @Produce json
+// @Param id path int true "Budget ID"
+// @Param budget body models.UpdateBudgetRequest true "Budget"
+// @Success 200 {object} models.Budget
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /budgets/{id} [put]
+func (h *BudgetHandler) Update(c *gin.Context) {
+	id, ok := h.budgetID(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind JSON: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget, err := h.Budgets.UpdateBudget(c.Request.Context(), id, &req)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to update budget: %v", err)
+		h.respondError(c, err, "Failed to update budget")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Updated budget with ID: %d", id)
+	c.JSON(http.StatusOK, budget)
+}
+
+// Delete godoc
+// @Summary Delete a budget
+// @Description Delete a budget and the record of its alerts
+// @Tags budgets
+// @Param id path int true "Budget ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /budgets/{id} [delete]
+func (h *BudgetHandler) Delete(c *gin.Context) {
+	id, ok := h.budgetID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Budgets.DeleteBudget(c.Request.Context(), id); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to delete budget: %v", err)
+		h.respondError(c, err, "Failed to delete budget")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Deleted budget with ID: %d", id)
+	c.Status(http.StatusNoContent)
+}
+
+// Status godoc
+// @Summary Compare a budget with its spend
+// @Description Compare a budget with the projected spend of a month: the cost of the subscriptions it covers that are active in the month, computed as /subscriptions/calculate does
+// @Tags budgets
+// @Produce json
+// @Param id path int true "Budget ID"
+// @Param month query string false "Month (MM-YYYY), the current month by default"
+// @Success 200 {object} models.BudgetStatus
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /budgets/{id}/status [get]
+func (h *BudgetHandler) Status(c *gin.Context) {
+	var req models.BudgetStatusRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget, ok := h.budget(c)
+	if !ok {
+		return
+	}
+
+	month := req.Month
+	if month == "" {
+		month = budgets.CurrentMonth()
+	}
+
+	status, err := h.Evaluator.Status(c.Request.Context(), budget, month)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to compute budget status: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to compute budget status")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// budget loads the budget in the id path parameter, answering 400 or 404 if there is none
+func (h *BudgetHandler) budget(c *gin.Context) (*models.Budget, bool) {
+	id, ok := h.budgetID(c)
+	if !ok {
+		return nil, false
+	}
+
+	budget, err := h.Budgets.GetBudget(c.Request.Context(), id)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to get budget: %v", err)
+		h.respondError(c, err, "Failed to get budget")
+		return nil, false
+	}
+
+	return budget, true
+}
+
+// respondError answers a failed budget operation
+func (h *BudgetHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+	case errors.Is(err, repository.ErrServiceNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		middleware.RespondStorageError(c, err, message)
+	}
+}
+
+// budgetID parses the budget ID in the id path parameter, answering 400 if it is invalid
+func (h *BudgetHandler) budgetID(c *gin.Context) (int, bool) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid budget ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid budget ID"})
+		return 0, false
+	}
+	return id, true
+}
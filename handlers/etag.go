@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"subscription-service/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etag formats a subscription version as a strong entity tag
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// setETag exposes the subscription version in the ETag response header
+func setETag(c *gin.Context, subscription *models.Subscription) {
+	c.Header("ETag", etag(subscription.Version))
+}
+
+// parseETagList splits an If-Match or If-None-Match header value into entity tags.
+// wildcard is true when the header is "*".
+func parseETagList(header string) (tags []string, wildcard bool) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if tag == "*" {
+			return nil, true
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, false
+}
+
+// ifMatchVersions returns the versions listed in an If-Match header. Weak and
+// malformed tags never match because If-Match requires strong comparison of
+// quoted entity tags. present is false without the header.
+func ifMatchVersions(c *gin.Context) (versions []int, wildcard bool, present bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return nil, false, false
+	}
+
+	tags, wildcard := parseETagList(header)
+	for _, tag := range tags {
+		if version, ok := strongVersion(tag); ok {
+			versions = append(versions, version)
+		}
+	}
+
+	return versions, wildcard, true
+}
+
+// strongVersion returns the version named by a strong entity tag such as "5";
+// weak tags and malformed ones such as 5 or "5 name none
+func strongVersion(tag string) (int, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || etag(version) != tag {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// ifNoneMatch reports whether an If-None-Match header matches the subscription,
+// using the weak comparison that RFC 7232 prescribes for it
+func ifNoneMatch(c *gin.Context, subscription *models.Subscription) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	tags, wildcard := parseETagList(header)
+	if wildcard {
+		return true
+	}
+
+	current := etag(subscription.Version)
+	for _, tag := range tags {
+		if strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"subscription-service/logger"
+	"subscription-service/middleware"
+	"subscription-service/stream"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// defaultHeartbeat is used when the configured heartbeat interval is not positive
+const defaultHeartbeat = 15 * time.Second
+
+// EventStreamHandler streams subscription events to clients as Server-Sent Events
+type EventStreamHandler struct {
+	Hub       *stream.Hub
+	Heartbeat time.Duration
+	Logger    *logger.Logger
+}
+
+// NewEventStreamHandler creates a new event stream handler
+func NewEventStreamHandler(hub *stream.Hub, heartbeat time.Duration, logger *logger.Logger) *EventStreamHandler {
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+
+	return &EventStreamHandler{Hub: hub, Heartbeat: heartbeat, Logger: logger}
+}
+
+// Stream godoc
+// @Summary Stream subscription events
+// @Description Stream the created, updated, ended, deleted and restored events of a user's subscriptions as Server-Sent Events. The SSE event name is the event type, the id can be sent back in Last-Event-ID to resume after a disconnect, and comment lines are sent as heartbeats.
+// @Tags subscriptions
+// @Produce text/event-stream
+// @Param user_id query string true "User ID"
+// @Param Last-Event-ID header int false "ID of the last event received"
+// @Success 200 {object} models.Event
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string "The event stream is switched off"
+// @Router /subscriptions/events [get]
+func (h *EventStreamHandler) Stream(c *gin.Context) {
+	userIDStr := c.Query("user_id")
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid user ID: %s", userIDStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required and must be a UUID"})
+		return
+	}
+
+	var lastEventID int64
+	if header := c.GetHeader("Last-Event-ID"); header != "" {
+		lastEventID, err = strconv.ParseInt(header, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+			return
+		}
+	}
+
+	subscriber, replay := h.Hub.Subscribe(userID, lastEventID)
+	defer h.Hub.Unsubscribe(subscriber)
+
+	// The server's write timeout would cut the stream off; the heartbeat
+	// detects dead clients instead
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Keeps nginx from buffering the stream
+	c.Status(http.StatusOK)
+
+	for _, event := range replay {
+		if err := writeEvent(c.Writer, event); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-subscriber.Events:
+			if !ok {
+				// The client fell behind or the server is shutting down; it
+				// resumes from the replay buffer on reconnect
+				return
+			}
+			if err := writeEvent(c.Writer, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// writeEvent writes one event in the SSE wire format
+func writeEvent(w io.Writer, event *stream.Event) error {
+	return sse.Encode(w, sse.Event{
+		Id:    strconv.FormatInt(event.ID, 10),
+		Event: event.Type,
+		Data:  string(event.Data),
+	})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/middleware"
+	"subscription-service/models"
+	"subscription-service/reminders"
+	"subscription-service/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// defaultReminderListLimit and maxReminderListLimit bound GET /users/{user_id}/reminders
+const (
+	defaultReminderListLimit = 50
+	maxReminderListLimit     = 500
+)
+
+// ReminderHandler handles HTTP requests for reminder preferences and reminders
+type ReminderHandler struct {
+	Store    repository.ReminderStore
+	Defaults config.RemindersConfig
+	Logger   *logger.Logger
+}
+
+// NewReminderHandler creates a new reminder handler
+func NewReminderHandler(store repository.ReminderStore, defaults config.RemindersConfig, logger *logger.Logger) *ReminderHandler {
+	return &ReminderHandler{Store: store, Defaults: defaults, Logger: logger}
+}
+
+// GetPreferences godoc
+// @Summary Get reminder preferences
+// @Description Get when and how a user is reminded of renewals and ends; users who have not set any get the defaults
+// @Tags reminders
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Success 200 {object} models.ReminderPreferences
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /users/{user_id}/reminder-preferences [get]
+func (h *ReminderHandler) GetPreferences(c *gin.Context) {
+	userID, ok := h.parseUserID(c)
+	if !ok {
+		return
+	}
+
+	preferences, err := h.Store.GetReminderPreferences(c.Request.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		preferences, err = reminders.DefaultPreferences(userID, h.Defaults), nil
+	}
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to get reminder preferences: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to get reminder preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// UpdatePreferences godoc
+// @Summary Replace reminder preferences
+// @Description Set the lead times in days (0-30) and the channel (log, email or webhook) of a user's reminders
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param preferences body models.UpdateReminderPreferencesRequest true "Reminder preferences"
+// @Success 200 {object} models.ReminderPreferences
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /users/{user_id}/reminder-preferences [put]
+func (h *ReminderHandler) UpdatePreferences(c *gin.Context) {
+	userID, ok := h.parseUserID(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateReminderPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind JSON: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preferences := &models.ReminderPreferences{
+		UserID:          userID,
+		Enabled:         req.Enabled,
+		RenewalLeadDays: req.RenewalLeadDays,
+		EndLeadDays:     req.EndLeadDays,
+		Channel:         req.Channel,
+		Target:          req.Target,
+	}
+	if preferences.RenewalLeadDays == nil {
+		preferences.RenewalLeadDays = []int{}
+	}
+	if preferences.EndLeadDays == nil {
+		preferences.EndLeadDays = []int{}
+	}
+
+	if err := h.Store.SaveReminderPreferences(c.Request.Context(), preferences); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to save reminder preferences: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to save reminder preferences")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Updated reminder preferences of user %s", userID)
+	c.JSON(http.StatusOK, preferences)
+}
+
+// List godoc
+// @Summary List reminders
+// @Description List a user's planned and sent reminders, latest send time first
+// @Tags reminders
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param limit query int false "Maximum number of reminders (1-500, default 50)"
+// @Success 200 {array} models.ReminderJob
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /users/{user_id}/reminders [get]
+func (h *ReminderHandler) List(c *gin.Context) {
+	userID, ok := h.parseUserID(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultReminderListLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxReminderListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = parsed
+	}
+
+	jobs, err := h.Store.ListReminders(c.Request.Context(), userID, limit)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to list reminders: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to list reminders")
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// parseUserID parses the user_id path parameter and answers 400 when it is not a UUID
+func (h *ReminderHandler) parseUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDStr := c.Param("user_id")
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid user ID: %s", userIDStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return uuid.UUID{}, false
+	}
+
+	return userID, true
+}
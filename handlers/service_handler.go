@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"subscription-service/logger"
+	"subscription-service/middleware"
+	"subscription-service/models"
+	"subscription-service/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServiceHandler handles HTTP requests for the service catalog
+type ServiceHandler struct {
+	Catalog repository.ServiceCatalog
+	Logger  *logger.Logger
+}
+
+// NewServiceHandler creates a new service catalog handler
+func NewServiceHandler(catalog repository.ServiceCatalog, logger *logger.Logger) *ServiceHandler {
+	return &ServiceHandler{Catalog: catalog, Logger: logger}
+}
+
+// Create godoc
+// @Summary Add a service to the catalog
+// @Description Add a service with its canonical name and the other names it is known by
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param service body models.CreateServiceRequest true "Service"
+// @Success 201 {object} models.Service
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /services [post]
+func (h *ServiceHandler) Create(c *gin.Context) {
+	var req models.CreateServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind JSON: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service, err := h.Catalog.CreateService(c.Request.Context(), &req)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to create service: %v", err)
+		if errors.Is(err, repository.ErrServiceExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Service name or alias is already taken"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to create service")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Created service with ID: %d", service.ID)
+	c.JSON(http.StatusCreated, service)
+}
+
+// List godoc
+// @Summary List the service catalog
+// @Description List the services of the catalog by name
+// @Tags services
+// @Produce json
+// @Param category query string false "Filter by category"
+// @Success 200 {array} models.Service
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /services [get]
+func (h *ServiceHandler) List(c *gin.Context) {
+	var req models.ListServicesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	services, err := h.Catalog.ListServices(c.Request.Context(), &req)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to list services: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to list services")
+		return
+	}
+
+	c.JSON(http.StatusOK, services)
+}
+
+// Get godoc
+// @Summary Get a service
+// @Description Get a service of the catalog by ID
+// @Tags services
+// @Produce json
+// @Param id path int true "Service ID"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /services/{id} [get]
+func (h *ServiceHandler) Get(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service ID"})
+		return
+	}
+
+	service, err := h.Catalog.GetService(c.Request.Context(), id)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to get service: %v", err)
+		if errors.Is(err, repository.ErrServiceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to get service")
+		return
+	}
+
+	c.JSON(http.StatusOK, service)
+}
+
+// AddAlias godoc
+// @Summary Add an alias to a service
+// @Description Make another name resolve to a service of the catalog
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param id path int true "Service ID"
+// @Param alias body models.AddServiceAliasRequest true "Alias"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /services/{id}/aliases [post]
+func (h *ServiceHandler) AddAlias(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service ID"})
+		return
+	}
+
+	var req models.AddServiceAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind JSON: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service, err := h.Catalog.AddServiceAlias(c.Request.Context(), id, req.Alias)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to add service alias: %v", err)
+		switch {
+		case errors.Is(err, repository.ErrServiceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+		case errors.Is(err, repository.ErrServiceExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "Alias already belongs to another service"})
+		default:
+			middleware.RespondStorageError(c, err, "Failed to add service alias")
+		}
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Added alias %q to service %d", req.Alias, id)
+	c.JSON(http.StatusOK, service)
+}
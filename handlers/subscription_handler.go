@@ -1,29 +1,41 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
 	"net/http"
 	"strconv"
 	"subscription-service/db"
 	"subscription-service/logger"
+	"subscription-service/middleware"
 	"subscription-service/models"
+	"subscription-service/patch"
 	"subscription-service/repository"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 )
 
+// errPriceRequired is returned for a subscription created without a price for a
+// service without a default price
+var errPriceRequired = errors.New("price is required, the service has no default price")
+
+// maxPatchAttempts bounds how often a patch without If-Match is applied again
+// because the subscription changed while it was being applied
+const maxPatchAttempts = 3
+
 // SubscriptionHandler handles HTTP requests for subscriptions
 type SubscriptionHandler struct {
-	Repo   interface{} // Can be either SubscriptionRepository or MockSubscriptionRepository
+	Repo   repository.Repository // Either SubscriptionRepository or MockSubscriptionRepository
 	Logger *logger.Logger
-	repo   *repository.SubscriptionRepository // For backward compatibility
-	logger *logger.Logger                     // For backward compatibility
 }
 
 // NewSubscriptionHandler creates a new subscription handler
-func NewSubscriptionHandler(db *db.PostgresDB, logger *logger.Logger) *SubscriptionHandler {
-	repo := repository.NewSubscriptionRepository(db)
-	return &SubscriptionHandler{Repo: repo, Logger: logger, repo: repo, logger: logger}
+func NewSubscriptionHandler(repo repository.Repository, logger *logger.Logger) *SubscriptionHandler {
+	return &SubscriptionHandler{Repo: repo, Logger: logger}
 }
 
 // Create godoc
@@ -33,64 +45,64 @@ func NewSubscriptionHandler(db *db.PostgresDB, logger *logger.Logger) *Subscript
 // @Accept json
 // @Produce json
 // @Param subscription body models.CreateSubscriptionRequest true "Subscription data"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
 // @Success 201 {object} models.Subscription
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
 // @Router /subscriptions [post]
 func (h *SubscriptionHandler) Create(c *gin.Context) {
 	var req models.CreateSubscriptionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.Logger.Errorf("Failed to bind JSON: %v", err)
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind JSON: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	middleware.AddLogField(c, "user_id", req.UserID)
 
 	if err := req.Validate(); err != nil {
-		h.Logger.Errorf("Validation error: %v", err)
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if mockRepo, ok := h.Repo.(*repository.MockSubscriptionRepository); ok {
-		// Using mock repository
-		createdSub, err := mockRepo.Create(&req)
+	var subscription *models.Subscription
+	err := h.Repo.WithTx(c.Request.Context(), func(tx repository.Repository) error {
+		// The request is left alone, the unit of work may run again
+		resolved := req
+		service, err := tx.ResolveService(c.Request.Context(), req.ServiceID, req.ServiceName)
 		if err != nil {
-			h.Logger.Errorf("Failed to create subscription: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
-			return
+			return err
 		}
-
-		subscription, err := mockRepo.GetByID(createdSub.ID)
-		if err != nil {
-			h.Logger.Errorf("Failed to get created subscription: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve created subscription"})
-			return
+		resolved.ServiceID, resolved.ServiceName = &service.ID, service.Name
+		if resolved.Price == 0 {
+			if service.DefaultPrice == nil {
+				return errPriceRequired
+			}
+			resolved.Price = *service.DefaultPrice
 		}
 
-		h.Logger.Infof("Created subscription with ID: %d", createdSub.ID)
-		c.JSON(http.StatusCreated, subscription)
-	} else if repo, ok := h.Repo.(*repository.SubscriptionRepository); ok {
-		// Using real repository
-		id, err := repo.Create(&req)
+		id, err := tx.Create(c.Request.Context(), &resolved, auditInfo(c))
 		if err != nil {
-			h.Logger.Errorf("Failed to create subscription: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
-			return
+			return err
 		}
 
-		subscription, err := repo.GetByID(id)
-		if err != nil {
-			h.Logger.Errorf("Failed to get created subscription: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve created subscription"})
-			return
+		subscription, err = tx.GetByID(c.Request.Context(), id)
+		return err
+	})
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to create subscription: %v", err)
+		if !respondServiceError(c, err) {
+			middleware.RespondStorageError(c, err, "Failed to create subscription")
 		}
-
-		h.Logger.Infof("Created subscription with ID: %d", id)
-		c.JSON(http.StatusCreated, subscription)
-	} else {
-		h.Logger.Error("Unknown repository type")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
 	}
+
+	middleware.Logger(c, h.Logger).Infof("Created subscription with ID: %d", subscription.ID)
+	setETag(c, subscription)
+	c.JSON(http.StatusCreated, subscription)
 }
 
 // Get godoc
@@ -99,144 +111,312 @@ func (h *SubscriptionHandler) Create(c *gin.Context) {
 // @Tags subscriptions
 // @Produce json
 // @Param id path int true "Subscription ID"
+// @Param If-None-Match header string false "ETag of a cached copy"
 // @Success 200 {object} models.Subscription
+// @Success 304 "Not Modified"
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Header 200 {string} ETag "Subscription version"
 // @Router /subscriptions/{id} [get]
 func (h *SubscriptionHandler) Get(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		h.Logger.Errorf("Invalid ID: %s", idStr)
+		middleware.Logger(c, h.Logger).Errorf("Invalid ID: %s", idStr)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
 		return
 	}
 
-	if mockRepo, ok := h.Repo.(*repository.MockSubscriptionRepository); ok {
-		// Using mock repository
-		subscription, err := mockRepo.GetByID(id)
-		if err != nil {
-			h.Logger.Errorf("Failed to get subscription: %v", err)
-			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
-			return
-		}
-
-		h.Logger.Infof("Retrieved subscription with ID: %d", id)
-		c.JSON(http.StatusOK, subscription)
-	} else if repo, ok := h.Repo.(*repository.SubscriptionRepository); ok {
-		// Using real repository
-		subscription, err := repo.GetByID(id)
-		if err != nil {
-			h.Logger.Errorf("Failed to get subscription: %v", err)
+	subscription, err := h.Repo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to get subscription: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
 			return
 		}
+		middleware.RespondStorageError(c, err, "Failed to get subscription")
+		return
+	}
 
-		h.Logger.Infof("Retrieved subscription with ID: %d", id)
-		c.JSON(http.StatusOK, subscription)
-	} else {
-		h.Logger.Error("Unknown repository type")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	setETag(c, subscription)
+	if ifNoneMatch(c, subscription) {
+		c.Status(http.StatusNotModified)
+		return
 	}
+
+	middleware.Logger(c, h.Logger).Infof("Retrieved subscription with ID: %d", id)
+	c.JSON(http.StatusOK, subscription)
 }
 
 // List godoc
 // @Summary List subscriptions
-// @Description List all subscriptions with optional filtering
+// @Description List subscriptions a page at a time with optional filtering and sorting. Follow next_cursor, keeping the other parameters, to get the next page.
 // @Tags subscriptions
 // @Produce json
 // @Param user_id query string false "Filter by user ID"
 // @Param service_name query string false "Filter by service name"
-// @Success 200 {array} models.Subscription
+// @Param service_prefix query string false "Filter by the start of the service name, ignoring case"
+// @Param min_price query int false "Only subscriptions costing at least this much"
+// @Param max_price query int false "Only subscriptions costing at most this much"
+// @Param active_in query string false "Only subscriptions active in this month (MM-YYYY)"
+// @Param has_end_date query bool false "Only subscriptions with (true) or without (false) an end date"
+// @Param tag_id query []int false "Only subscriptions with any of these tags" collectionFormat(multi)
+// @Param sort query string false "Sort key: price, start_date, created_at or service_name (default created_at)"
+// @Param order query string false "Sort direction: asc or desc (default asc)"
+// @Param limit query int false "Page size (1-500, default 50)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param include_total query bool false "Count the subscriptions matching the filters"
+// @Success 200 {object} models.SubscriptionPage
+// @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
 // @Router /subscriptions [get]
 func (h *SubscriptionHandler) List(c *gin.Context) {
-	userIDStr := c.Query("user_id")
-	serviceName := c.Query("service_name")
+	var req models.ListSubscriptionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	var userID *uuid.UUID
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userIDStr := c.Query("user_id")
 	if userIDStr != "" {
-		parsedID, err := uuid.Parse(userIDStr)
+		userID, err := uuid.Parse(userIDStr)
 		if err != nil {
-			h.logger.Errorf("Invalid user ID: %s", userIDStr)
+			middleware.Logger(c, h.Logger).Errorf("Invalid user ID: %s", userIDStr)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
 			return
 		}
-		userID = &parsedID
+		req.UserID = &userID
 	}
 
-	var serviceNamePtr *string
-	if serviceName != "" {
-		serviceNamePtr = &serviceName
+	page, err := h.Repo.List(c.Request.Context(), &req)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to list subscriptions: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to list subscriptions")
+		return
 	}
 
-	subscriptions, err := h.repo.List(userID, serviceNamePtr)
+	middleware.Logger(c, h.Logger).Infof("Listed %d subscriptions", len(page.Items))
+	c.JSON(http.StatusOK, page)
+}
+
+// Search godoc
+// @Summary Search subscriptions
+// @Description Find subscriptions by service name, best matches first. Cyrillic and Latin spellings match each other ("Яндекс" finds "Yandex"), words match by prefix and typos are tolerated.
+// @Tags subscriptions
+// @Produce json
+// @Param q query string true "Text to look for in service names"
+// @Param user_id query string false "Filter by user ID"
+// @Param limit query int false "Maximum number of results (1-100, default 20)"
+// @Success 200 {object} models.SearchSubscriptionsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string "Search is switched off"
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /subscriptions/search [get]
+func (h *SubscriptionHandler) Search(c *gin.Context) {
+	var req models.SearchSubscriptionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userIDStr := c.Query("user_id")
+	if userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			middleware.Logger(c, h.Logger).Errorf("Invalid user ID: %s", userIDStr)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+			return
+		}
+		req.UserID = &userID
+	}
+
+	results, err := h.Repo.Search(c.Request.Context(), &req)
 	if err != nil {
-		h.logger.Errorf("Failed to list subscriptions: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list subscriptions"})
+		middleware.Logger(c, h.Logger).Errorf("Failed to search subscriptions: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to search subscriptions")
 		return
 	}
 
-	h.logger.Infof("Listed %d subscriptions", len(subscriptions))
-	c.JSON(http.StatusOK, subscriptions)
+	middleware.Logger(c, h.Logger).Infof("Found %d subscriptions", len(results))
+	c.JSON(http.StatusOK, models.SearchSubscriptionsResponse{Items: results})
 }
 
 // Update godoc
-// @Summary Update a subscription
-// @Description Update a subscription by ID
+// @Summary Replace a subscription
+// @Description Replace a subscription by ID; omitted optional fields such as end_date are cleared
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param id path int true "Subscription ID"
 // @Param subscription body models.UpdateSubscriptionRequest true "Subscription data"
+// @Param If-Match header string false "Only update if the subscription still has this ETag"
 // @Success 200 {object} models.Subscription
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Header 200 {string} ETag "Subscription version"
 // @Router /subscriptions/{id} [put]
 func (h *SubscriptionHandler) Update(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		h.logger.Errorf("Invalid ID: %s", idStr)
+		middleware.Logger(c, h.Logger).Errorf("Invalid ID: %s", idStr)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
 		return
 	}
 
 	var req models.UpdateSubscriptionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.logger.Errorf("Failed to bind JSON: %v", err)
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind JSON: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	middleware.AddLogField(c, "user_id", req.UserID)
 
 	if err := req.Validate(); err != nil {
-		h.logger.Errorf("Validation error: %v", err)
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.repo.Update(id, &req); err != nil {
-		h.logger.Errorf("Failed to update subscription: %v", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+	var subscription *models.Subscription
+	expectedVersion, err := h.expectedVersion(c, id)
+	if err == nil {
+		subscription, err = h.updateAndGet(c, id, &req, expectedVersion)
+	}
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to update subscription: %v", err)
+		h.respondUpdateError(c, err)
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Updated subscription with ID: %d", id)
+	setETag(c, subscription)
+	c.JSON(http.StatusOK, subscription)
+}
+
+// Patch godoc
+// @Summary Partially update a subscription
+// @Description Apply a JSON Merge Patch (RFC 7396) or, with Content-Type application/json-patch+json, a JSON Patch (RFC 6902) to a subscription. In a merge patch absent fields are left unchanged and null clears a field. Without If-Match a patch is applied again if the subscription changes meanwhile, and fails with 409 if it keeps changing.
+// @Tags subscriptions
+// @Accept application/merge-patch+json,application/json-patch+json,json
+// @Produce json
+// @Param id path int true "Subscription ID"
+// @Param patch body object true "Merge patch document or JSON Patch operations"
+// @Param If-Match header string false "Only update if the subscription still has this ETag"
+// @Success 200 {object} models.Subscription
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Header 200 {string} ETag "Subscription version"
+// @Router /subscriptions/{id} [patch]
+func (h *SubscriptionHandler) Patch(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
 		return
 	}
 
-	subscription, err := h.repo.GetByID(id)
+	applyPatch := patch.MergePatch
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	switch mediaType {
+	case patch.MergePatchContentType, "application/json", "":
+	case patch.JSONPatchContentType:
+		applyPatch = patch.JSONPatch
+	default:
+		middleware.Logger(c, h.Logger).Errorf("Unsupported patch media type: %s", mediaType)
+		c.Header("Accept-Patch", patch.MergePatchContentType+", "+patch.JSONPatchContentType)
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported patch media type"})
+		return
+	}
+
+	body, err := c.GetRawData()
 	if err != nil {
-		h.logger.Errorf("Failed to get updated subscription: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated subscription"})
+		middleware.Logger(c, h.Logger).Errorf("Failed to read patch: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
 		return
 	}
 
-	h.logger.Infof("Updated subscription with ID: %d", id)
+	expectedVersion, err := h.expectedVersion(c, id)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to update subscription: %v", err)
+		h.respondUpdateError(c, err)
+		return
+	}
+
+	// The patch is applied to the version read, so the update must not succeed
+	// if the subscription changes before it is written. Without If-Match such a
+	// change is not the client's conflict and the patch is applied to the new
+	// version instead.
+	var subscription *models.Subscription
+	for attempt := 1; ; attempt++ {
+		// Read from the primary: a lagging replica would make the update conflict
+		current, err := h.Repo.GetByID(db.WithPrimary(c.Request.Context()), id)
+		if err == nil && expectedVersion != nil && *expectedVersion != current.Version {
+			err = repository.ErrVersionConflict
+		}
+		if err != nil {
+			middleware.Logger(c, h.Logger).Errorf("Failed to update subscription: %v", err)
+			h.respondUpdateError(c, err)
+			return
+		}
+
+		req, ok := h.patchedRequest(c, current, body, applyPatch)
+		if !ok {
+			return
+		}
+
+		subscription, err = h.updateAndGet(c, id, req, &current.Version)
+		if errors.Is(err, repository.ErrVersionConflict) && expectedVersion == nil {
+			if attempt < maxPatchAttempts {
+				continue
+			}
+			middleware.Logger(c, h.Logger).Errorf("Gave up patching subscription %d after %d conflicting updates", id, attempt)
+			c.JSON(http.StatusConflict, gin.H{"error": "Subscription kept changing while it was patched; try again"})
+			return
+		}
+		if err != nil {
+			middleware.Logger(c, h.Logger).Errorf("Failed to update subscription: %v", err)
+			h.respondUpdateError(c, err)
+			return
+		}
+		break
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Patched subscription with ID: %d", id)
+	setETag(c, subscription)
 	c.JSON(http.StatusOK, subscription)
 }
 
 // Delete godoc
 // @Summary Delete a subscription
-// @Description Delete a subscription by ID
+// @Description Soft-delete a subscription by ID; it can be restored until it is purged
 // @Tags subscriptions
 // @Produce json
 // @Param id path int true "Subscription ID"
@@ -244,49 +424,140 @@ func (h *SubscriptionHandler) Update(c *gin.Context) {
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
 // @Router /subscriptions/{id} [delete]
 func (h *SubscriptionHandler) Delete(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		h.logger.Errorf("Invalid ID: %s", idStr)
+		middleware.Logger(c, h.Logger).Errorf("Invalid ID: %s", idStr)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
 		return
 	}
 
-	if err := h.repo.Delete(id); err != nil {
-		h.logger.Errorf("Failed to delete subscription: %v", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+	if err := h.Repo.Delete(c.Request.Context(), id, auditInfo(c)); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to delete subscription: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to delete subscription")
 		return
 	}
 
-	h.logger.Infof("Deleted subscription with ID: %d", id)
+	middleware.Logger(c, h.Logger).Infof("Deleted subscription with ID: %d", id)
 	c.Status(http.StatusNoContent)
 }
 
+// Restore godoc
+// @Summary Restore a deleted subscription
+// @Description Restore a soft-deleted subscription by ID
+// @Tags subscriptions
+// @Produce json
+// @Param id path int true "Subscription ID"
+// @Success 200 {object} models.Subscription
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /subscriptions/{id}/restore [post]
+func (h *SubscriptionHandler) Restore(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return
+	}
+
+	var subscription *models.Subscription
+	err = h.Repo.WithTx(c.Request.Context(), func(tx repository.Repository) error {
+		if err := tx.Restore(c.Request.Context(), id, auditInfo(c)); err != nil {
+			return err
+		}
+
+		var err error
+		subscription, err = tx.GetByID(c.Request.Context(), id)
+		return err
+	})
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to restore subscription: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deleted subscription not found"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to restore subscription")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Restored subscription with ID: %d", id)
+	setETag(c, subscription)
+	c.JSON(http.StatusOK, subscription)
+}
+
+// ListDeleted godoc
+// @Summary List deleted subscriptions
+// @Description List soft-deleted subscriptions that have not been purged yet
+// @Tags admin
+// @Produce json
+// @Param user_id query string false "Filter by user ID"
+// @Success 200 {array} models.Subscription
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /admin/subscriptions/deleted [get]
+func (h *SubscriptionHandler) ListDeleted(c *gin.Context) {
+	userIDStr := c.Query("user_id")
+
+	var userID *uuid.UUID
+	if userIDStr != "" {
+		parsedID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			middleware.Logger(c, h.Logger).Errorf("Invalid user ID: %s", userIDStr)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+			return
+		}
+		userID = &parsedID
+	}
+
+	subscriptions, err := h.Repo.ListDeleted(c.Request.Context(), userID)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to list deleted subscriptions: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to list deleted subscriptions")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Listed %d deleted subscriptions", len(subscriptions))
+	c.JSON(http.StatusOK, subscriptions)
+}
+
 // CalculateTotalCost godoc
 // @Summary Calculate total subscription cost
-// @Description Calculate the total cost of subscriptions for a period
+// @Description Calculate the total cost of subscriptions for a period, in all and per tag. Every subscription costs its price for each month of the period it is active in, counting its start and end months. A subscription with several tags counts toward each.
 // @Tags subscriptions
 // @Produce json
 // @Param user_id query string false "Filter by user ID"
 // @Param service_name query string false "Filter by service name"
+// @Param service_id query int false "Filter by catalog service ID"
+// @Param category query string false "Filter by catalog category of the service"
+// @Param tag_id query []int false "Only subscriptions with any of these tags" collectionFormat(multi)
 // @Param start_period query string true "Start period (MM-YYYY)"
 // @Param end_period query string true "End period (MM-YYYY)"
 // @Success 200 {object} models.CalculateCostResponse
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
 // @Router /subscriptions/calculate [get]
 func (h *SubscriptionHandler) CalculateTotalCost(c *gin.Context) {
 	var req models.CalculateCostRequest
 	if err := c.ShouldBindQuery(&req); err != nil {
-		h.logger.Errorf("Failed to bind query: %v", err)
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind query: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	if err := req.Validate(); err != nil {
-		h.logger.Errorf("Validation error: %v", err)
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -295,7 +566,7 @@ func (h *SubscriptionHandler) CalculateTotalCost(c *gin.Context) {
 	if userIDStr != "" {
 		userID, err := uuid.Parse(userIDStr)
 		if err != nil {
-			h.logger.Errorf("Invalid user ID: %s", userIDStr)
+			middleware.Logger(c, h.Logger).Errorf("Invalid user ID: %s", userIDStr)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
 			return
 		}
@@ -307,13 +578,148 @@ func (h *SubscriptionHandler) CalculateTotalCost(c *gin.Context) {
 		req.ServiceName = &serviceName
 	}
 
-	totalCost, err := h.repo.CalculateTotalCost(&req)
+	cost, err := h.Repo.CalculateTotalCost(c.Request.Context(), &req)
 	if err != nil {
-		h.logger.Errorf("Failed to calculate total cost: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate total cost"})
+		middleware.Logger(c, h.Logger).Errorf("Failed to calculate total cost: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to calculate total cost")
 		return
 	}
 
-	h.logger.Infof("Calculated total cost: %d", totalCost)
-	c.JSON(http.StatusOK, models.CalculateCostResponse{TotalCost: totalCost})
+	middleware.Logger(c, h.Logger).Infof("Calculated total cost: %d", cost.TotalCost)
+	c.JSON(http.StatusOK, cost)
+}
+
+// patchedRequest applies a patch to the current subscription and validates the
+// result, answering 400, 409 or 500 if it cannot be applied
+func (h *SubscriptionHandler) patchedRequest(c *gin.Context, current *models.Subscription, body []byte, applyPatch func(document, patch []byte) ([]byte, error)) (*models.UpdateSubscriptionRequest, bool) {
+	document, err := json.Marshal(models.NewUpdateSubscriptionRequest(current))
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to encode subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subscription"})
+		return nil, false
+	}
+
+	patched, err := applyPatch(document, body)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to apply patch: %v", err)
+		if errors.Is(err, patch.ErrTestFailed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	var req models.UpdateSubscriptionRequest
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to decode patched subscription: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	// A subscription always carries the name of its service
+	if req.ServiceName == "" {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: service_name cleared")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "service_name cannot be cleared"})
+		return nil, false
+	}
+
+	// The document names the service twice, so the field a patch left alone
+	// still names the old service and must not be checked against the new one
+	serviceIDKept := req.ServiceID != nil && *req.ServiceID == current.ServiceID
+	serviceNameKept := req.ServiceName == current.ServiceName
+	switch {
+	case serviceIDKept && !serviceNameKept:
+		req.ServiceID = nil
+	case serviceNameKept && req.ServiceID != nil:
+		req.ServiceName = ""
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return &req, true
+}
+
+// expectedVersion resolves the If-Match header of a request into the version the
+// subscription must still have. It returns nil when no precondition applies and
+// ErrVersionConflict when none of the listed entity tags can match.
+func (h *SubscriptionHandler) expectedVersion(c *gin.Context, id int) (*int, error) {
+	versions, wildcard, present := ifMatchVersions(c)
+	if !present || wildcard {
+		return nil, nil
+	}
+
+	switch len(versions) {
+	case 0:
+		return nil, repository.ErrVersionConflict
+	case 1:
+		return &versions[0], nil
+	}
+
+	// Several tags: pin the current version if it is one of them, the
+	// repository then rejects the update if it changes in the meantime
+	current, err := h.Repo.GetByID(db.WithPrimary(c.Request.Context()), id)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		if version == current.Version {
+			return &version, nil
+		}
+	}
+
+	return nil, repository.ErrVersionConflict
+}
+
+// updateAndGet updates a subscription and reads back the result in one unit of work
+func (h *SubscriptionHandler) updateAndGet(c *gin.Context, id int, req *models.UpdateSubscriptionRequest, expectedVersion *int) (*models.Subscription, error) {
+	var subscription *models.Subscription
+	err := h.Repo.WithTx(c.Request.Context(), func(tx repository.Repository) error {
+		if err := tx.Update(c.Request.Context(), id, req, expectedVersion, auditInfo(c)); err != nil {
+			return err
+		}
+
+		var err error
+		subscription, err = tx.GetByID(c.Request.Context(), id)
+		return err
+	})
+	return subscription, err
+}
+
+// respondUpdateError writes the response for a failed subscription update
+func (h *SubscriptionHandler) respondUpdateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+	case errors.Is(err, repository.ErrVersionConflict):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Subscription was modified by another request"})
+	case respondServiceError(c, err):
+	default:
+		middleware.RespondStorageError(c, err, "Failed to update subscription")
+	}
+}
+
+// respondServiceError writes the response for a subscription whose service
+// does not resolve and reports whether err was such a failure
+func respondServiceError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrServiceNotFound),
+		errors.Is(err, repository.ErrServiceMismatch),
+		errors.Is(err, errPriceRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
 }
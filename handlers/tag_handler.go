@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"subscription-service/logger"
+	"subscription-service/middleware"
+	"subscription-service/models"
+	"subscription-service/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TagHandler handles HTTP requests for tags and the tags of subscriptions
+type TagHandler struct {
+	Tags   repository.TagStore
+	Logger *logger.Logger
+}
+
+// NewTagHandler creates a new tag handler
+func NewTagHandler(tags repository.TagStore, logger *logger.Logger) *TagHandler {
+	return &TagHandler{Tags: tags, Logger: logger}
+}
+
+// Create godoc
+// @Summary Create a tag
+// @Description Create a tag a user can group subscriptions by. Tag names are unique per user regardless of case.
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param tag body models.CreateTagRequest true "Tag"
+// @Success 201 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /tags [post]
+func (h *TagHandler) Create(c *gin.Context) {
+	var req models.CreateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind JSON: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.AddLogField(c, "user_id", req.UserID)
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag, err := h.Tags.CreateTag(c.Request.Context(), &req)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to create tag: %v", err)
+		if errors.Is(err, repository.ErrTagExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tag name is already taken"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to create tag")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Created tag with ID: %d", tag.ID)
+	c.JSON(http.StatusCreated, tag)
+}
+
+// List godoc
+// @Summary List tags
+// @Description List tags by name
+// @Tags tags
+// @Produce json
+// @Param user_id query string false "Filter by user ID"
+// @Success 200 {array} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /tags [get]
+func (h *TagHandler) List(c *gin.Context) {
+	var req models.ListTagsRequest
+
+	userIDStr := c.Query("user_id")
+	if userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			middleware.Logger(c, h.Logger).Errorf("Invalid user ID: %s", userIDStr)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+			return
+		}
+		req.UserID = &userID
+	}
+
+	tags, err := h.Tags.ListTags(c.Request.Context(), &req)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to list tags: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to list tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// Get godoc
+// @Summary Get a tag
+// @Description Get a tag by ID
+// @Tags tags
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /tags/{id} [get]
+func (h *TagHandler) Get(c *gin.Context) {
+	id, ok := h.tagID(c, "id")
+	if !ok {
+		return
+	}
+
+	tag, err := h.Tags.GetTag(c.Request.Context(), id)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to get tag: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to get tag")
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// Rename godoc
+// @Summary Rename a tag
+// @Description Rename a tag; its subscriptions keep it
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Param tag body models.RenameTagRequest true "New name"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /tags/{id} [put]
+func (h *TagHandler) Rename(c *gin.Context) {
+	id, ok := h.tagID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req models.RenameTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind JSON: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag, err := h.Tags.RenameTag(c.Request.Context(), id, req.Name)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to rename tag: %v", err)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		case errors.Is(err, repository.ErrTagExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "Tag name is already taken"})
+		default:
+			middleware.RespondStorageError(c, err, "Failed to rename tag")
+		}
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Renamed tag with ID: %d", id)
+	c.JSON(http.StatusOK, tag)
+}
+
+// Delete godoc
+// @Summary Delete a tag
+// @Description Delete a tag and remove it from its subscriptions
+// @Tags tags
+// @Param id path int true "Tag ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /tags/{id} [delete]
+func (h *TagHandler) Delete(c *gin.Context) {
+	id, ok := h.tagID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.Tags.DeleteTag(c.Request.Context(), id); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to delete tag: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to delete tag")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Deleted tag with ID: %d", id)
+	c.Status(http.StatusNoContent)
+}
+
+// ListSubscriptionTags godoc
+// @Summary List the tags of a subscription
+// @Description List the tags of a subscription by name
+// @Tags tags
+// @Produce json
+// @Param id path int true "Subscription ID"
+// @Success 200 {array} models.Tag
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /subscriptions/{id}/tags [get]
+func (h *TagHandler) ListSubscriptionTags(c *gin.Context) {
+	id, ok := subscriptionID(c, h.Logger)
+	if !ok {
+		return
+	}
+
+	tags, err := h.Tags.ListSubscriptionTags(c.Request.Context(), id)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to list subscription tags: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to list subscription tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// TagSubscription godoc
+// @Summary Tag a subscription
+// @Description Put a subscription under a tag of its user; tagging it twice is harmless
+// @Tags tags
+// @Param id path int true "Subscription ID"
+// @Param tag_id path int true "Tag ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /subscriptions/{id}/tags/{tag_id} [put]
+func (h *TagHandler) TagSubscription(c *gin.Context) {
+	id, ok := subscriptionID(c, h.Logger)
+	if !ok {
+		return
+	}
+	tagID, ok := h.tagID(c, "tag_id")
+	if !ok {
+		return
+	}
+
+	if err := h.Tags.TagSubscription(c.Request.Context(), id, tagID); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to tag subscription: %v", err)
+		h.respondTaggingError(c, err, "Failed to tag subscription")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Tagged subscription %d with tag %d", id, tagID)
+	c.Status(http.StatusNoContent)
+}
+
+// UntagSubscription godoc
+// @Summary Remove a tag from a subscription
+// @Description Remove a tag from a subscription; removing a tag it does not have is harmless
+// @Tags tags
+// @Param id path int true "Subscription ID"
+// @Param tag_id path int true "Tag ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /subscriptions/{id}/tags/{tag_id} [delete]
+func (h *TagHandler) UntagSubscription(c *gin.Context) {
+	id, ok := subscriptionID(c, h.Logger)
+	if !ok {
+		return
+	}
+	tagID, ok := h.tagID(c, "tag_id")
+	if !ok {
+		return
+	}
+
+	if err := h.Tags.UntagSubscription(c.Request.Context(), id, tagID); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to untag subscription: %v", err)
+		h.respondTaggingError(c, err, "Failed to untag subscription")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Removed tag %d from subscription %d", tagID, id)
+	c.Status(http.StatusNoContent)
+}
+
+// respondTaggingError answers a failed change to the tags of a subscription
+func (h *TagHandler) respondTaggingError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+	case errors.Is(err, repository.ErrTagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+	case errors.Is(err, repository.ErrTagUserMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		middleware.RespondStorageError(c, err, message)
+	}
+}
+
+// tagID parses the tag ID in the path parameter name, answering 400 if it is invalid
+func (h *TagHandler) tagID(c *gin.Context, name string) (int, bool) {
+	idStr := c.Param(name)
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid tag ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// subscriptionID parses the subscription ID in the id path parameter,
+// answering 400 if it is invalid
+func subscriptionID(c *gin.Context, log *logger.Logger) (int, bool) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.Logger(c, log).Errorf("Invalid ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription ID"})
+		return 0, false
+	}
+	return id, true
+}
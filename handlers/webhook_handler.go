@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"subscription-service/logger"
+	"subscription-service/middleware"
+	"subscription-service/models"
+	"subscription-service/repository"
+	"subscription-service/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookHandler handles HTTP requests for webhook endpoints and their deliveries
+type WebhookHandler struct {
+	Store  repository.WebhookStore
+	Logger *logger.Logger
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(store repository.WebhookStore, logger *logger.Logger) *WebhookHandler {
+	return &WebhookHandler{Store: store, Logger: logger}
+}
+
+// Create godoc
+// @Summary Register a webhook endpoint
+// @Description Register a URL that receives subscription events. An empty event list subscribes to all events. The signing secret is only returned here; it is generated when not given.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body models.CreateWebhookRequest true "Webhook endpoint"
+// @Success 201 {object} models.WebhookEndpoint
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /webhooks [post]
+func (h *WebhookHandler) Create(c *gin.Context) {
+	var req models.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind JSON: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		if secret, err = webhooks.GenerateSecret(); err != nil {
+			middleware.Logger(c, h.Logger).Errorf("Failed to generate webhook secret: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+			return
+		}
+	}
+
+	events := req.Events
+	if events == nil {
+		events = []string{}
+	}
+
+	endpoint := &models.WebhookEndpoint{
+		URL:    req.URL,
+		Events: events,
+		Secret: secret,
+		Active: true,
+	}
+	if err := h.Store.CreateEndpoint(c.Request.Context(), endpoint); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to create webhook: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to create webhook")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Created webhook endpoint with ID: %d", endpoint.ID)
+	c.JSON(http.StatusCreated, endpoint)
+}
+
+// List godoc
+// @Summary List webhook endpoints
+// @Description List all registered webhook endpoints
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} models.WebhookEndpoint
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /webhooks [get]
+func (h *WebhookHandler) List(c *gin.Context) {
+	endpoints, err := h.Store.ListEndpoints(c.Request.Context())
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to list webhooks: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to list webhooks")
+		return
+	}
+
+	for _, endpoint := range endpoints {
+		endpoint.Secret = ""
+	}
+
+	c.JSON(http.StatusOK, endpoints)
+}
+
+// Get godoc
+// @Summary Get a webhook endpoint
+// @Description Get a webhook endpoint by ID
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.WebhookEndpoint
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /webhooks/{id} [get]
+func (h *WebhookHandler) Get(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	endpoint, err := h.Store.GetEndpoint(c.Request.Context(), id)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to get webhook: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to get webhook")
+		return
+	}
+
+	endpoint.Secret = ""
+	c.JSON(http.StatusOK, endpoint)
+}
+
+// Delete godoc
+// @Summary Delete a webhook endpoint
+// @Description Delete a webhook endpoint and its delivery log
+// @Tags webhooks
+// @Param id path int true "Webhook ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /webhooks/{id} [delete]
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	if err := h.Store.DeleteEndpoint(c.Request.Context(), id); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to delete webhook: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to delete webhook")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Deleted webhook endpoint with ID: %d", id)
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries godoc
+// @Summary List webhook deliveries
+// @Description List the delivery log, newest first
+// @Tags webhooks
+// @Produce json
+// @Param endpoint_id query int false "Filter by webhook ID"
+// @Param status query string false "Filter by status (pending, succeeded, dead)"
+// @Param limit query int false "Page size (1-500, default 50)"
+// @Param offset query int false "Number of deliveries to skip"
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Header 200 {integer} X-Total-Count "Number of matching deliveries"
+// @Router /webhooks/deliveries [get]
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	var req models.ListDeliveriesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to bind query: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deliveries, total, err := h.Store.ListDeliveries(c.Request.Context(), &req)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to list webhook deliveries: %v", err)
+		middleware.RespondStorageError(c, err, "Failed to list webhook deliveries")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// Redeliver godoc
+// @Summary Redeliver a webhook
+// @Description Send a delivery again, e.g. one in the dead-letter state, with a fresh set of attempts
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /webhooks/deliveries/{id}/redeliver [post]
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Invalid ID: %s", idStr)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	delivery, err := h.Store.Redeliver(c.Request.Context(), id)
+	if err != nil {
+		middleware.Logger(c, h.Logger).Errorf("Failed to redeliver webhook: %v", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+			return
+		}
+		middleware.RespondStorageError(c, err, "Failed to redeliver webhook")
+		return
+	}
+
+	middleware.Logger(c, h.Logger).Infof("Scheduled redelivery of webhook delivery %d", id)
+	c.JSON(http.StatusAccepted, delivery)
+}
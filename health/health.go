@@ -0,0 +1,158 @@
+// Package health serves the liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultTimeout bounds all readiness checks together when no timeout is configured
+const defaultTimeout = 2 * time.Second
+
+// Statuses reported per check and for the whole probe
+const (
+	StatusOK          = "ok"
+	StatusFailing     = "failing"
+	StatusUnavailable = "unavailable"
+)
+
+// shutdownCheck is the name under which a shutdown in progress is reported
+const shutdownCheck = "shutdown"
+
+// errShuttingDown fails the readiness probe once the shutdown has begun
+var errShuttingDown = errors.New("server is shutting down")
+
+// CheckFunc reports whether a dependency is usable
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult is the outcome of one readiness check
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Response is the body of both probes
+type Response struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker runs the registered readiness checks
+type Checker struct {
+	timeout      time.Duration
+	mutex        sync.RWMutex
+	checks       map[string]CheckFunc
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a checker whose checks must all finish within timeout
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &Checker{timeout: timeout, checks: make(map[string]CheckFunc)}
+}
+
+// Register adds a readiness check
+func (h *Checker) Register(name string, check CheckFunc) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.checks[name] = check
+}
+
+// SetShuttingDown makes readiness fail from now on so that load balancers stop
+// sending requests while in-flight ones are drained
+func (h *Checker) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// Check runs every check concurrently and reports whether all of them passed
+func (h *Checker) Check(ctx context.Context) (bool, map[string]CheckResult) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	h.mutex.RLock()
+	checks := make(map[string]CheckFunc, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mutex.RUnlock()
+
+	results := make(map[string]CheckResult, len(checks)+1)
+	var resultsMutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check CheckFunc) {
+			defer wg.Done()
+			result := run(ctx, check)
+
+			resultsMutex.Lock()
+			results[name] = result
+			resultsMutex.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	if h.shuttingDown.Load() {
+		results[shutdownCheck] = CheckResult{Status: StatusFailing, Error: errShuttingDown.Error()}
+	}
+
+	ready := true
+	for _, result := range results {
+		if result.Status != StatusOK {
+			ready = false
+		}
+	}
+
+	return ready, results
+}
+
+// run runs one check, giving up when ctx expires even if the check ignores it
+func run(ctx context.Context, check CheckFunc) CheckResult {
+	start := time.Now()
+
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: StatusOK, DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Liveness answers 200 as long as the process can serve requests at all; it
+// checks no dependencies so that an outage does not get the service restarted
+func (h *Checker) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, Response{Status: StatusOK})
+}
+
+// Readiness answers 200 when every check passes and 503 otherwise, with the
+// result of each check
+func (h *Checker) Readiness(c *gin.Context) {
+	ready, results := h.Check(c.Request.Context())
+
+	status, code := StatusOK, http.StatusOK
+	if !ready {
+		status, code = StatusUnavailable, http.StatusServiceUnavailable
+	}
+	c.JSON(code, Response{Status: status, Checks: results})
+}
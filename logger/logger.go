@@ -15,22 +15,49 @@ type Logger struct {
 func NewLogger() *Logger {
 	logrusLogger := logrus.New()
 	logrusLogger.SetOutput(os.Stdout)
-	logrusLogger.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
+
+	// Set output format based on environment variable or default to text
+	logrusLogger.SetFormatter(parseFormat(os.Getenv("LOG_FORMAT")))
 
 	// Set log level based on environment variable or default to info
-	level := os.Getenv("LOG_LEVEL")
-	switch level {
+	logrusLogger.SetLevel(parseLevel(os.Getenv("LOG_LEVEL")))
+
+	logrusLogger.AddHook(traceHook{})
+
+	return &Logger{Logger: logrusLogger}
+}
+
+// SetLevelName changes the level of the logger at runtime; unknown names mean info
+func (l *Logger) SetLevelName(name string) {
+	l.SetLevel(parseLevel(name))
+}
+
+// SetFormatName switches the logger to json or, for any other name, text output
+func (l *Logger) SetFormatName(name string) {
+	l.SetFormatter(parseFormat(name))
+}
+
+// parseLevel maps debug, warn and error to their levels and anything else to info
+func parseLevel(name string) logrus.Level {
+	switch name {
 	case "debug":
-		logrusLogger.SetLevel(logrus.DebugLevel)
+		return logrus.DebugLevel
 	case "warn":
-		logrusLogger.SetLevel(logrus.WarnLevel)
+		return logrus.WarnLevel
 	case "error":
-		logrusLogger.SetLevel(logrus.ErrorLevel)
+		return logrus.ErrorLevel
 	default:
-		logrusLogger.SetLevel(logrus.InfoLevel)
+		return logrus.InfoLevel
 	}
+}
 
-	return &Logger{Logger: logrusLogger}
-}
\ No newline at end of file
+// parseFormat maps json to the JSON formatter and anything else to text
+func parseFormat(name string) logrus.Formatter {
+	if name == "json" {
+		return &logrus.JSONFormatter{}
+	}
+
+	return &logrus.TextFormatter{
+		FullTimestamp: true,
+	}
+}
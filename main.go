@@ -1,13 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"subscription-service/budgets"
 	"subscription-service/config"
 	"subscription-service/db"
 	"subscription-service/handlers"
+	"subscription-service/health"
 	"subscription-service/logger"
+	"subscription-service/metrics"
+	"subscription-service/middleware"
+	"subscription-service/models"
+	"subscription-service/notify"
+	"subscription-service/outbox"
+	"subscription-service/reminders"
+	"subscription-service/repository"
+	"subscription-service/stream"
+	"subscription-service/tracing"
+	"subscription-service/webhooks"
+	"subscription-service/workers"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -22,60 +43,262 @@ import (
 // @host localhost:8081
 // @BasePath /api/v1
 func main() {
+	flags, err := config.ParseFlags(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
 	// Load configuration
-	cfg, err := config.LoadConfig()
+	cfg, err := config.LoadConfig(flags)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	if flags.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("Failed to print configuration: %v", err)
+		}
+		return
+	}
+
 	// Initialize logger
 	logger := logger.NewLogger()
+	logger.SetLevelName(cfg.Log.Level)
+	logger.SetFormatName(cfg.Log.Format)
+
+	if err := run(cfg, flags, logger); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// run starts the server and workers and blocks until a termination signal has
+// been handled; the deferred calls release resources in reverse order of setup
+func run(cfg *config.Config, flags *config.Flags, logger *logger.Logger) error {
+	// Set up tracing before anything issues traced queries
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Errorf("Failed to flush traces: %v", err)
+		}
+	}()
 
 	// Connect to database
-	postgres, err := db.NewPostgresDB(cfg.Database)
+	postgres, err := db.NewPostgresDB(context.Background(), cfg.Database, logger)
 	if err != nil {
-		logger.Fatalf("Failed to connect to database: %v", err)
+		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 	defer postgres.Close()
 
 	// Run database migrations
 	if err := postgres.RunMigrations(); err != nil {
-		logger.Fatalf("Failed to run database migrations: %v", err)
+		return fmt.Errorf("failed to run database migrations: %w", err)
 	}
 
 	// Initialize handlers with DB
-	subscriptionHandler := handlers.NewSubscriptionHandler(postgres, logger)
+	repo := repository.NewSubscriptionRepository(postgres)
+	webhookStore := repository.NewWebhookRepository(postgres)
+	serviceMetrics := metrics.New()
+	serviceMetrics.RegisterDBStats(postgres.DB)
+	serviceMetrics.RegisterSubscriptionStats(repo)
+	subscriptionHandler := handlers.NewSubscriptionHandler(serviceMetrics.InstrumentRepository(repo), logger)
+	auditHandler := handlers.NewAuditHandler(repo, logger)
+	serviceHandler := handlers.NewServiceHandler(repo, logger)
+	tagHandler := handlers.NewTagHandler(repo, logger)
+	webhookHandler := handlers.NewWebhookHandler(webhookStore, logger)
+	reminderHandler := handlers.NewReminderHandler(repo, cfg.Reminders, logger)
+	hub := stream.NewHub(cfg.Stream.BufferSize)
+	eventStreamHandler := handlers.NewEventStreamHandler(hub, cfg.Stream.Heartbeat, logger)
+	idempotencyStore := repository.NewIdempotencyRepository(postgres)
+
+	// Events recorded in the outbox go to webhooks and any configured broker
+	publisher := outbox.MultiPublisher{webhooks.NewPublisher(webhookStore, logger)}
+	if cfg.Outbox.HTTPURL != "" {
+		publisher = append(publisher, outbox.NewHTTPPublisher(cfg.Outbox.HTTPURL, cfg.Outbox.Timeout))
+	}
+	if cfg.Outbox.NATSURL != "" {
+		natsPublisher, err := outbox.NewNATSPublisher(cfg.Outbox.NATSURL, cfg.Outbox.NATSSubject, cfg.Outbox.Timeout)
+		if err != nil {
+			return fmt.Errorf("failed to configure NATS publisher: %w", err)
+		}
+		defer natsPublisher.Close()
+		publisher = append(publisher, natsPublisher)
+	}
+
+	// Reminders and budget alerts go out through the channel chosen by each user
+	notifier := notify.Router{
+		models.NotifyChannelLog:     notify.NewLogNotifier(logger),
+		models.NotifyChannelWebhook: notify.NewWebhookNotifier(cfg.Reminders.Timeout),
+	}
+	if cfg.SMTP.Host != "" {
+		notifier[models.NotifyChannelEmail] = notify.NewEmailNotifier(cfg.SMTP)
+	}
+	budgetEvaluator := budgets.NewEvaluator(repo, notifier, cfg.Budgets, logger)
+	budgetHandler := handlers.NewBudgetHandler(repo, budgetEvaluator, logger)
+
+	// Start background workers
+	workerGroup := workers.NewGroup(logger)
+	workerGroup.Go("purge", workers.NewPurgeWorker(repo, cfg.Purge, logger).Run)
+	workerGroup.Go("idempotency-cleanup", workers.NewIdempotencyCleanupWorker(idempotencyStore, cfg.Idempotency, logger).Run)
+	workerGroup.Go("outbox-relay", workers.NewOutboxRelayWorker(outbox.NewRelay(repo, publisher, cfg.Outbox, logger), repo, cfg.Outbox, logger).Run)
+	workerGroup.Go("webhooks", workers.NewWebhookWorker(webhooks.NewDispatcher(webhookStore, cfg.Webhooks, logger), cfg.Webhooks, logger).Run)
+	// Every replica streams the events committed by any replica
+	workerGroup.Go("event-feed", func(ctx context.Context) {
+		if err := repo.Listen(ctx, hub.Publish); err != nil {
+			logger.Errorf("Stopped listening for subscription events: %v", err)
+		}
+	})
+	workerGroup.Go("reminders", workers.NewReminderWorker(reminders.NewScheduler(repo, notifier, cfg.Reminders, logger), cfg.Reminders, logger).Run)
+	workerGroup.Go("budgets", workers.NewBudgetWorker(budgetEvaluator, cfg.Budgets, logger).Run)
+
+	// Log level and feature flags follow config changes without a restart
+	configWatcher := config.NewWatcher(cfg, flags, logger)
+	configWatcher.OnReload(func(cfg *config.Config) {
+		logger.SetLevelName(cfg.Log.Level)
+		logger.SetFormatName(cfg.Log.Format)
+	})
+	workerGroup.Go("config-watcher", configWatcher.Run)
 
 	// Initialize router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// Probes are registered ahead of the other middleware to keep them out of
+	// the request logs, traces and metrics
+	healthChecker := health.NewChecker(cfg.Health.Timeout)
+	healthChecker.Register("database", postgres.DB.PingContext)
+	healthChecker.Register("migrations", postgres.CheckMigrations)
+	healthChecker.Register("workers", workerGroup.Check)
+	router.GET("/livez", healthChecker.Liveness)
+	router.GET("/readyz", healthChecker.Readiness)
+
+	router.Use(tracing.Middleware())
+	router.Use(middleware.RequestID(), middleware.RequestLogger(logger))
+	router.Use(serviceMetrics.Middleware())
+	router.GET("/metrics", serviceMetrics.Handler(logger))
 
 	// Setup API routes
 	api := router.Group("/api/v1")
 	{
-		// Health check endpoint
-		api.GET("/health", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"status": "healthy",
-				"mode":   "database",
-			})
-		})
+		// Kept for existing clients; the same as /readyz
+		api.GET("/health", healthChecker.Readiness)
 
 		// Real subscriptions endpoints
-		api.POST("/subscriptions", subscriptionHandler.Create)
+		api.POST("/subscriptions", middleware.Idempotency(idempotencyStore, cfg.Idempotency.TTL, logger), subscriptionHandler.Create)
 		api.GET("/subscriptions/:id", subscriptionHandler.Get)
 		api.GET("/subscriptions", subscriptionHandler.List)
 		api.PUT("/subscriptions/:id", subscriptionHandler.Update)
+		api.PATCH("/subscriptions/:id", subscriptionHandler.Patch)
 		api.DELETE("/subscriptions/:id", subscriptionHandler.Delete)
+		api.POST("/subscriptions/:id/restore", subscriptionHandler.Restore)
 		api.GET("/subscriptions/calculate", subscriptionHandler.CalculateTotalCost)
+		api.GET("/subscriptions/search", middleware.Feature(func() bool { return configWatcher.Current().Features.Search }), subscriptionHandler.Search)
+		api.GET("/subscriptions/events", middleware.Feature(func() bool { return configWatcher.Current().Features.EventStream }), eventStreamHandler.Stream)
+
+		// Service catalog that subscriptions refer to
+		api.POST("/services", serviceHandler.Create)
+		api.GET("/services", serviceHandler.List)
+		api.GET("/services/:id", serviceHandler.Get)
+		api.POST("/services/:id/aliases", serviceHandler.AddAlias)
+
+		// Tags users group their subscriptions by
+		api.POST("/tags", tagHandler.Create)
+		api.GET("/tags", tagHandler.List)
+		api.GET("/tags/:id", tagHandler.Get)
+		api.PUT("/tags/:id", tagHandler.Rename)
+		api.DELETE("/tags/:id", tagHandler.Delete)
+		api.GET("/subscriptions/:id/tags", tagHandler.ListSubscriptionTags)
+		api.PUT("/subscriptions/:id/tags/:tag_id", tagHandler.TagSubscription)
+		api.DELETE("/subscriptions/:id/tags/:tag_id", tagHandler.UntagSubscription)
+
+		// Audit log of subscription changes
+		api.GET("/audit", auditHandler.List)
+
+		// Webhook endpoints and their delivery log
+		api.POST("/webhooks", webhookHandler.Create)
+		api.GET("/webhooks", webhookHandler.List)
+		api.GET("/webhooks/:id", webhookHandler.Get)
+		api.DELETE("/webhooks/:id", webhookHandler.Delete)
+		api.GET("/webhooks/deliveries", webhookHandler.ListDeliveries)
+		api.POST("/webhooks/deliveries/:id/redeliver", webhookHandler.Redeliver)
+
+		// Renewal and end reminders
+		api.GET("/users/:user_id/reminder-preferences", reminderHandler.GetPreferences)
+		api.PUT("/users/:user_id/reminder-preferences", reminderHandler.UpdatePreferences)
+		api.GET("/users/:user_id/reminders", reminderHandler.List)
+
+		// Monthly budgets and their threshold alerts
+		api.POST("/budgets", budgetHandler.Create)
+		api.GET("/budgets", budgetHandler.List)
+		api.GET("/budgets/:id", budgetHandler.Get)
+		api.PUT("/budgets/:id", budgetHandler.Update)
+		api.DELETE("/budgets/:id", budgetHandler.Delete)
+		api.GET("/budgets/:id/status", budgetHandler.Status)
+
+		// Admin endpoints
+		admin := api.Group("/admin")
+		admin.GET("/subscriptions/deleted", subscriptionHandler.ListDeleted)
 	}
 
 	// Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	// Start the server
-	serverAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, 8081)
-	logger.Infof("Starting server on %s", serverAddr)
-	if err := router.Run(serverAddr); err != nil {
-		logger.Fatalf("Failed to start server: %v", err)
+	serverAddr := net.JoinHostPort(cfg.Server.Host, cfg.Server.Port)
+	server := &http.Server{
+		Addr:              serverAddr,
+		Handler:           router,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	// Open event streams would otherwise hold up the shutdown until its deadline
+	server.RegisterOnShutdown(hub.Close)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Infof("Starting server on %s", serverAddr)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// Run until SIGINT or SIGTERM; a second signal kills the process at once
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	var runErr error
+	select {
+	case <-signalCtx.Done():
+		logger.Info("Shutting down")
+	case err := <-serverErr:
+		runErr = fmt.Errorf("failed to start server: %w", err)
+	}
+	stopSignals()
+
+	// Fail readiness first so that load balancers stop routing new requests here
+	healthChecker.SetShuttingDown()
+	if runErr == nil {
+		time.Sleep(cfg.Health.ShutdownDelay)
 	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Drain in-flight requests before the workers stop; the broker connection,
+	// database pool and tracer are closed by the deferred calls afterwards
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Errorf("Failed to drain HTTP requests: %v", err)
+	}
+	if err := workerGroup.Stop(shutdownCtx); err != nil {
+		logger.Errorf("Failed to stop workers: %v", err)
+	}
+
+	return runErr
 }
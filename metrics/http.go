@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"subscription-service/logger"
+)
+
+// unmatchedRoute labels requests that matched no route, which keeps the number of label values bounded
+const unmatchedRoute = "unmatched"
+
+// Middleware counts requests and records their latency by route template
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		m.httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		m.httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler(logger *logger.Logger) gin.HandlerFunc {
+	// A failing collector yields a 500 instead of a page missing its metrics
+	handler := promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{
+		ErrorLog:      logger,
+		ErrorHandling: promhttp.HTTPErrorOnError,
+	})
+
+	return gin.WrapH(handler)
+}
@@ -0,0 +1,144 @@
+// Package metrics exposes service metrics in the Prometheus format.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+
+	"subscription-service/repository"
+)
+
+// uncategorized labels subscriptions whose service has no catalog category
+const uncategorized = "uncategorized"
+
+// DefaultBuckets are latency buckets in seconds suitable for HTTP requests and queries
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics holds the metrics recorded by the service
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequests         *prometheus.CounterVec
+	httpRequestDuration  *prometheus.HistogramVec
+	queryDuration        *prometheus.HistogramVec
+	subscriptionsCreated prometheus.Counter
+}
+
+// New creates the service metrics in a new registry, together with the Go
+// runtime and process metrics
+func New() *Metrics {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	m := &Metrics{
+		Registry: registry,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of HTTP requests by method, route and status code.",
+			Buckets: DefaultBuckets,
+		}, []string{"method", "route", "status"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "repository_query_duration_seconds",
+			Help:    "Duration of repository operations by operation and outcome.",
+			Buckets: DefaultBuckets,
+		}, []string{"operation", "outcome"}),
+		subscriptionsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "subscriptions_created_total",
+			Help: "Subscriptions created by this instance.",
+		}),
+	}
+	registry.MustRegister(m.httpRequests, m.httpRequestDuration, m.queryDuration, m.subscriptionsCreated)
+
+	return m
+}
+
+// ObserveQuery records the duration of a repository operation that started at start
+func (m *Metrics) ObserveQuery(operation string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+
+	m.queryDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+// RegisterDBStats exposes the connection pool statistics of db
+func (m *Metrics) RegisterDBStats(db *sql.DB) {
+	gauge := func(name, help string, value func(sql.DBStats) float64) {
+		m.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help},
+			func() float64 { return value(db.Stats()) }))
+	}
+	counter := func(name, help string, value func(sql.DBStats) float64) {
+		m.Registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help},
+			func() float64 { return value(db.Stats()) }))
+	}
+
+	gauge("db_max_open_connections", "Maximum number of open database connections.",
+		func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	gauge("db_open_connections", "Open database connections, in use or idle.",
+		func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	gauge("db_in_use_connections", "Database connections in use.",
+		func(s sql.DBStats) float64 { return float64(s.InUse) })
+	gauge("db_idle_connections", "Idle database connections.",
+		func(s sql.DBStats) float64 { return float64(s.Idle) })
+	counter("db_wait_count_total", "Times a query waited for a free database connection.",
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	counter("db_wait_duration_seconds_total", "Time spent waiting for a free database connection.",
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	counter("db_max_idle_closed_total", "Connections closed because of the idle connection limit.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("db_max_idle_time_closed_total", "Connections closed because they were idle too long.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) })
+	counter("db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.",
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
+
+// RegisterSubscriptionStats exposes the number of active subscriptions, which is counted at scrape time
+func (m *Metrics) RegisterSubscriptionStats(store repository.StatsStore) {
+	m.Registry.MustRegister(&subscriptionStats{
+		store: store,
+		active: prometheus.NewDesc(
+			"subscriptions_active", "Subscriptions that are not deleted per catalog category.",
+			[]string{"category"}, nil,
+		),
+	})
+}
+
+// subscriptionStats collects the subscription counts of a store
+type subscriptionStats struct {
+	store  repository.StatsStore
+	active *prometheus.Desc
+}
+
+func (s *subscriptionStats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.active
+}
+
+func (s *subscriptionStats) Collect(ch chan<- prometheus.Metric) {
+	// A scrape carries no context; the report query timeout bounds the count
+	counts, err := s.store.CountActiveByCategory(context.Background())
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(s.active, err)
+		return
+	}
+
+	byLabel := map[string]int{}
+	for category, count := range counts {
+		if category == "" {
+			category = uncategorized
+		}
+		byLabel[category] += count
+	}
+
+	for category, count := range byLabel {
+		ch <- prometheus.MustNewConstMetric(s.active, prometheus.GaugeValue, float64(count), category)
+	}
+}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subscription-service/models"
+	"subscription-service/repository"
+)
+
+// instrumentedRepository records the duration of every call to the wrapped repository
+type instrumentedRepository struct {
+	repo    repository.Repository
+	metrics *Metrics
+
+	// Inside a unit of work creations are counted only once it commits
+	inTx    bool
+	created int
+}
+
+// InstrumentRepository wraps repo so that its operations are measured
+func (m *Metrics) InstrumentRepository(repo repository.Repository) repository.Repository {
+	return &instrumentedRepository{repo: repo, metrics: m}
+}
+
+func (r *instrumentedRepository) Create(ctx context.Context, subscription *models.CreateSubscriptionRequest, audit models.AuditInfo) (int, error) {
+	start := time.Now()
+	id, err := r.repo.Create(ctx, subscription, audit)
+	r.metrics.ObserveQuery("create", start, err)
+	if err == nil {
+		r.countCreated(1)
+	}
+	return id, err
+}
+
+func (r *instrumentedRepository) GetByID(ctx context.Context, id int) (*models.Subscription, error) {
+	start := time.Now()
+	subscription, err := r.repo.GetByID(ctx, id)
+	r.metrics.ObserveQuery("get", start, ignoreNotFound(err))
+	return subscription, err
+}
+
+func (r *instrumentedRepository) ResolveService(ctx context.Context, id *int, name string) (*models.Service, error) {
+	start := time.Now()
+	service, err := r.repo.ResolveService(ctx, id, name)
+	r.metrics.ObserveQuery("resolve_service", start, err)
+	return service, err
+}
+
+func (r *instrumentedRepository) List(ctx context.Context, filter *models.ListSubscriptionsRequest) (*models.SubscriptionPage, error) {
+	start := time.Now()
+	page, err := r.repo.List(ctx, filter)
+	r.metrics.ObserveQuery("list", start, err)
+	return page, err
+}
+
+func (r *instrumentedRepository) Search(ctx context.Context, req *models.SearchSubscriptionsRequest) ([]*models.SubscriptionSearchResult, error) {
+	start := time.Now()
+	results, err := r.repo.Search(ctx, req)
+	r.metrics.ObserveQuery("search", start, err)
+	return results, err
+}
+
+func (r *instrumentedRepository) Update(ctx context.Context, id int, subscription *models.UpdateSubscriptionRequest, expectedVersion *int, audit models.AuditInfo) error {
+	start := time.Now()
+	err := r.repo.Update(ctx, id, subscription, expectedVersion, audit)
+	r.metrics.ObserveQuery("update", start, ignoreNotFound(err))
+	return err
+}
+
+func (r *instrumentedRepository) Delete(ctx context.Context, id int, audit models.AuditInfo) error {
+	start := time.Now()
+	err := r.repo.Delete(ctx, id, audit)
+	r.metrics.ObserveQuery("delete", start, ignoreNotFound(err))
+	return err
+}
+
+func (r *instrumentedRepository) Restore(ctx context.Context, id int, audit models.AuditInfo) error {
+	start := time.Now()
+	err := r.repo.Restore(ctx, id, audit)
+	r.metrics.ObserveQuery("restore", start, ignoreNotFound(err))
+	return err
+}
+
+func (r *instrumentedRepository) ListDeleted(ctx context.Context, userID *uuid.UUID) ([]*models.Subscription, error) {
+	start := time.Now()
+	subscriptions, err := r.repo.ListDeleted(ctx, userID)
+	r.metrics.ObserveQuery("list_deleted", start, err)
+	return subscriptions, err
+}
+
+func (r *instrumentedRepository) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	start := time.Now()
+	purged, err := r.repo.PurgeDeleted(ctx, retention)
+	r.metrics.ObserveQuery("purge_deleted", start, err)
+	return purged, err
+}
+
+func (r *instrumentedRepository) CalculateTotalCost(ctx context.Context, req *models.CalculateCostRequest) (*models.CalculateCostResponse, error) {
+	start := time.Now()
+	cost, err := r.repo.CalculateTotalCost(ctx, req)
+	r.metrics.ObserveQuery("calculate_total_cost", start, err)
+	return cost, err
+}
+
+func (r *instrumentedRepository) WithTx(ctx context.Context, fn func(tx repository.Repository) error) error {
+	start := time.Now()
+	var created int
+	err := r.repo.WithTx(ctx, func(tx repository.Repository) error {
+		// A retried unit of work starts counting afresh
+		instrumented := &instrumentedRepository{repo: tx, metrics: r.metrics, inTx: true}
+		err := fn(instrumented)
+		created = instrumented.created
+		return err
+	})
+	r.metrics.ObserveQuery("transaction", start, ignoreNotFound(err))
+	if err == nil && created > 0 {
+		r.countCreated(created)
+	}
+	return err
+}
+
+// countCreated counts created subscriptions, or holds them back until the unit
+// of work they were created in commits
+func (r *instrumentedRepository) countCreated(count int) {
+	if r.inTx {
+		r.created += count
+		return
+	}
+	r.metrics.subscriptionsCreated.Add(float64(count))
+}
+
+// ignoreNotFound keeps expected misses and version conflicts out of the error outcome
+func ignoreNotFound(err error) error {
+	if errors.Is(err, repository.ErrNotFound) || errors.Is(err, repository.ErrVersionConflict) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StatusClientClosedRequest is recorded for requests the client gave up on
+// before the response was written; the client never sees it
+const StatusClientClosedRequest = 499
+
+// RespondStorageError writes the response for a failed storage operation:
+// 504 if it ran out of time, 499 if the client went away, and a 500 with
+// message otherwise
+func RespondStorageError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "The request timed out"})
+	case errors.Is(err, context.Canceled):
+		c.AbortWithStatus(StatusClientClosedRequest)
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Feature answers 404 while a feature flag is off. The flag is read on every
+// request so that a reloaded configuration applies at once.
+func Feature(enabled func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !enabled() {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "This feature is disabled"})
+			return
+		}
+
+		c.Next()
+	}
+}
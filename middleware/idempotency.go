@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"subscription-service/logger"
+	"subscription-service/repository"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header that makes a POST safe to retry
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response that was replayed from a stored one
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// maxIdempotencyKeyLength matches the size of the key column
+	maxIdempotencyKeyLength = 255
+)
+
+// replayedHeaders lists the response headers stored with an idempotent response
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Idempotency makes requests carrying an Idempotency-Key header safe to retry.
+// The first request with a key runs normally and its response is stored for ttl.
+// A retry with the same key and body gets the stored response, a retry with a
+// different body is rejected, and a retry while the first request is still
+// running gets 409 Conflict. Requests without the header are not affected.
+func Idempotency(store repository.IdempotencyStore, ttl time.Duration, log *logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			Logger(c, log).Errorf("Failed to read request body: %v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(c.Request, body)
+
+		record, reserved, err := store.Reserve(c.Request.Context(), key, fingerprint, ttl)
+		if err != nil {
+			Logger(c, log).Errorf("Failed to reserve idempotency key: %v", err)
+			RespondStorageError(c, err, "Internal server error")
+			return
+		}
+
+		if !reserved {
+			switch {
+			case record.Fingerprint != fingerprint:
+				Logger(c, log).Errorf("Idempotency key %q reused with a different request", key)
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case !record.Completed:
+				Logger(c, log).Infof("Idempotency key %q is still in progress", key)
+				c.Header("Retry-After", "1")
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+			default:
+				Logger(c, log).Infof("Replaying stored response for idempotency key %q", key)
+				for _, name := range replayedHeaders {
+					if value := record.Header.Get(name); value != "" {
+						c.Header(name, value)
+					}
+				}
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Status(record.StatusCode)
+				c.Writer.Write(record.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		// The outcome is stored even if the client has gone away, so that the key
+		// is neither left reserved nor lost for a response that was produced
+		storeCtx := context.WithoutCancel(c.Request.Context())
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				store.Release(storeCtx, key, record.CreatedAt)
+				panic(recovered)
+			}
+		}()
+
+		c.Next()
+
+		// Server errors and requests the client gave up on are not final: let
+		// the client retry with the same key
+		if recorder.Status() >= http.StatusInternalServerError ||
+			recorder.Status() == StatusClientClosedRequest || c.Request.Context().Err() != nil {
+			if err := store.Release(storeCtx, key, record.CreatedAt); err != nil {
+				Logger(c, log).Errorf("Failed to release idempotency key: %v", err)
+			}
+			return
+		}
+
+		header := http.Header{}
+		for _, name := range replayedHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				header.Set(name, value)
+			}
+		}
+
+		// A request that ran so long that its reservation was taken over leaves
+		// the key to the request that took it
+		if err := store.Complete(storeCtx, key, record.CreatedAt, recorder.Status(), header, recorder.body.Bytes()); err != nil {
+			Logger(c, log).Errorf("Failed to store idempotent response: %v", err)
+		}
+	}
+}
+
+// requestFingerprint identifies a request by method, path and body. JSON bodies
+// are re-encoded first so that formatting and key order do not matter.
+func requestFingerprint(r *http.Request, body []byte) string {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if canonical, err := json.Marshal(decoded); err == nil {
+			body = canonical
+		}
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body while writing it through
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write copies the body before passing it on
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString copies the body before passing it on
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// RequestIDHeader carries the ID of a request; it is generated when missing
+	// and always echoed back in the response
+	RequestIDHeader = "X-Request-ID"
+
+	// requestIDKey stores the request ID in the gin.Context
+	requestIDKey = "request_id"
+
+	// maxRequestIDLength keeps a caller-supplied ID from bloating every log entry
+	maxRequestIDLength = 128
+)
+
+// RequestID takes the request ID from the X-Request-ID header or generates one
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID assigned by RequestID, or the X-Request-ID header
+// when the middleware is not installed
+func GetRequestID(c *gin.Context) string {
+	if id := c.GetString(requestIDKey); id != "" {
+		return id
+	}
+	return c.GetHeader(RequestIDHeader)
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"subscription-service/logger"
+)
+
+// requestLoggerKey stores the per-request log entry in the gin.Context
+const requestLoggerKey = "request_logger"
+
+// RequestLogger stores a log entry carrying the request ID, route and user ID
+// in the gin.Context for handlers to log through, and logs every finished
+// request with its status and latency. It replaces gin's own request logger
+// and must run after RequestID.
+func RequestLogger(log *logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		fields := logrus.Fields{
+			"request_id": GetRequestID(c),
+			"method":     c.Request.Method,
+			"route":      route(c),
+		}
+		if userID := c.Param("user_id"); userID != "" {
+			fields["user_id"] = userID
+		} else if userID := c.Query("user_id"); userID != "" {
+			fields["user_id"] = userID
+		}
+		c.Set(requestLoggerKey, log.WithContext(c.Request.Context()).WithFields(fields))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		entry := Logger(c, log).WithFields(logrus.Fields{
+			"status":     status,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"path":       c.Request.URL.Path,
+			"client_ip":  c.ClientIP(),
+		})
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			entry.Error("Request failed")
+		case status >= http.StatusBadRequest:
+			entry.Warn("Request rejected")
+		default:
+			entry.Info("Request completed")
+		}
+	}
+}
+
+// Logger returns the log entry of the request, falling back to log when
+// RequestLogger is not installed
+func Logger(c *gin.Context, log *logger.Logger) *logrus.Entry {
+	if value, ok := c.Get(requestLoggerKey); ok {
+		return value.(*logrus.Entry)
+	}
+	return log.WithContext(c.Request.Context()).WithField("request_id", GetRequestID(c))
+}
+
+// AddLogField adds a field to the log entries of the rest of the request,
+// including the final one, e.g. the user ID once the body has been read
+func AddLogField(c *gin.Context, key string, value interface{}) {
+	if entry, ok := c.Get(requestLoggerKey); ok {
+		c.Set(requestLoggerKey, entry.(*logrus.Entry).WithField(key, value))
+	}
+}
+
+// route returns the route template of the request, or "unmatched"
+func route(c *gin.Context) string {
+	if path := c.FullPath(); path != "" {
+		return path
+	}
+	return "unmatched"
+}
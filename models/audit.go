@@ -0,0 +1,151 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// Audit actions recorded for subscription mutations
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+)
+
+// AuditEntitySubscription is the entity type of audit entries about subscriptions
+const AuditEntitySubscription = "subscription"
+
+// AuditInfo identifies who made a change and in which request
+type AuditInfo struct {
+	Actor     string
+	RequestID string
+}
+
+// AuditEntry represents a single recorded change to an entity
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	Actor      string                 `json:"actor"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	EntityType string                 `json:"entity_type"`
+	EntityID   int                    `json:"entity_id"`
+	Action     string                 `json:"action"`
+	Before     json.RawMessage        `json:"before,omitempty" swaggertype:"object"`
+	After      json.RawMessage        `json:"after,omitempty" swaggertype:"object"`
+	Changes    map[string]FieldChange `json:"changes,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// FieldChange holds the old and new value of a single changed field
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// ListAuditRequest represents the query parameters for listing audit entries
+type ListAuditRequest struct {
+	Actor    string     `form:"actor"`
+	EntityID *int       `form:"entity_id"`
+	Action   string     `form:"action"`
+	From     *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To       *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit    int        `form:"limit,default=50"`
+	Offset   int        `form:"offset"`
+}
+
+// ListAuditResponse represents a page of audit entries
+type ListAuditResponse struct {
+	Items  []*AuditEntry `json:"items"`
+	Total  int           `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+// NewSubscriptionAuditEntry builds an audit entry from the subscription state
+// before and after a change; either side may be nil
+func NewSubscriptionAuditEntry(action string, info AuditInfo, id int, before, after *Subscription) (*AuditEntry, error) {
+	entry := &AuditEntry{
+		Actor:      info.Actor,
+		RequestID:  info.RequestID,
+		EntityType: AuditEntitySubscription,
+		EntityID:   id,
+		Action:     action,
+	}
+
+	var err error
+	if before != nil {
+		if entry.Before, err = json.Marshal(before); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if entry.After, err = json.Marshal(after); err != nil {
+			return nil, err
+		}
+	}
+
+	entry.Changes, err = DiffSnapshots(entry.Before, entry.After)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// DiffSnapshots returns the top-level fields that differ between two JSON objects.
+// The updated_at bookkeeping field is left out.
+func DiffSnapshots(before, after json.RawMessage) (map[string]FieldChange, error) {
+	beforeFields := map[string]interface{}{}
+	afterFields := map[string]interface{}{}
+
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &beforeFields); err != nil {
+			return nil, err
+		}
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &afterFields); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := map[string]FieldChange{}
+	for key, from := range beforeFields {
+		if to, ok := afterFields[key]; !ok || !reflect.DeepEqual(from, to) {
+			changes[key] = FieldChange{From: from, To: afterFields[key]}
+		}
+	}
+	for key, to := range afterFields {
+		if _, ok := beforeFields[key]; !ok {
+			changes[key] = FieldChange{From: nil, To: to}
+		}
+	}
+	delete(changes, "updated_at")
+
+	return changes, nil
+}
+
+// Validate validates the list audit request
+func (r *ListAuditRequest) Validate() error {
+	switch r.Action {
+	case "", AuditActionCreate, AuditActionUpdate, AuditActionDelete, AuditActionRestore:
+	default:
+		return errors.New("action must be one of create, update, delete, restore")
+	}
+
+	if r.Limit < 1 || r.Limit > 500 {
+		return errors.New("limit must be between 1 and 500")
+	}
+
+	if r.Offset < 0 {
+		return errors.New("offset must not be negative")
+	}
+
+	if r.From != nil && r.To != nil && r.From.After(*r.To) {
+		return errors.New("from cannot be after to")
+	}
+
+	return nil
+}
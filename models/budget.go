@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// What a budget covers
+const (
+	BudgetScopeOverall  = "overall"  // Every subscription of the user
+	BudgetScopeCategory = "category" // Subscriptions to services of a catalog category
+	BudgetScopeService  = "service"  // Subscriptions to one service of the catalog
+)
+
+// maxBudgetThreshold bounds alert thresholds, in percent of the budget
+const maxBudgetThreshold = 1000
+
+// Budget is the most a user means to spend on subscriptions in a month
+type Budget struct {
+	ID         int       `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Scope      string    `json:"scope"`
+	Category   *string   `json:"category,omitempty"`   // Catalog category of a category budget
+	ServiceID  *int      `json:"service_id,omitempty"` // Catalog service of a service budget
+	Amount     int       `json:"amount"`
+	Thresholds []int     `json:"thresholds"` // Percentages of the amount that raise an alert; empty for the configured defaults
+	Channel    string    `json:"channel"`    // Channel alerts are sent through, as for reminders
+	Target     string    `json:"target,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// UpdateBudgetRequest represents the request body for replacing a budget
+type UpdateBudgetRequest struct {
+	Scope      string  `json:"scope" binding:"required"`
+	Category   *string `json:"category,omitempty"`
+	ServiceID  *int    `json:"service_id,omitempty"`
+	Amount     int     `json:"amount" binding:"required,min=1"`
+	Thresholds []int   `json:"thresholds"`
+	Channel    string  `json:"channel" binding:"required"`
+	Target     string  `json:"target,omitempty"`
+}
+
+// CreateBudgetRequest represents the request body for creating a budget
+type CreateBudgetRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+	UpdateBudgetRequest
+}
+
+// ListBudgetsRequest represents the query parameters for listing budgets
+type ListBudgetsRequest struct {
+	UserID *uuid.UUID `form:"-"` // Parsed by the handler; gin cannot bind uuid.UUID
+}
+
+// BudgetStatus compares a budget with the spend of a month
+type BudgetStatus struct {
+	Budget *Budget `json:"budget"`
+	Month  string  `json:"month"` // MM-YYYY
+	// Projected spend of the month: the cost of the subscriptions in the scope of
+	// the budget that are active in it, as CalculateTotalCost computes it
+	Spend       int   `json:"spend"`
+	Remaining   int   `json:"remaining"` // Negative once the budget is exceeded
+	PercentUsed int   `json:"percent_used"`
+	Exceeded    bool  `json:"exceeded"`
+	Thresholds  []int `json:"thresholds"` // Thresholds in effect, the budget's own or the defaults
+	Reached     []int `json:"reached"`    // Thresholds the spend has reached
+}
+
+// BudgetStatusRequest represents the query parameters of a budget status
+type BudgetStatusRequest struct {
+	Month string `form:"month"` // MM-YYYY; the current month when empty
+}
+
+// Validate validates the budget
+func (r *UpdateBudgetRequest) Validate() error {
+	switch r.Scope {
+	case BudgetScopeOverall:
+		if r.Category != nil || r.ServiceID != nil {
+			return errors.New("an overall budget takes neither category nor service_id")
+		}
+	case BudgetScopeCategory:
+		if r.Category == nil || *r.Category == "" || r.ServiceID != nil {
+			return errors.New("a category budget takes a category and no service_id")
+		}
+	case BudgetScopeService:
+		if r.ServiceID == nil || r.Category != nil {
+			return errors.New("a service budget takes a service_id and no category")
+		}
+	default:
+		return errors.New("scope must be one of overall, category, service")
+	}
+
+	for i, threshold := range r.Thresholds {
+		if threshold < 1 || threshold > maxBudgetThreshold {
+			return errors.New("thresholds must be percentages between 1 and 1000")
+		}
+		if i > 0 && threshold <= r.Thresholds[i-1] {
+			return errors.New("thresholds must be in ascending order")
+		}
+	}
+
+	return validateNotifyTarget(r.Channel, r.Target)
+}
+
+// Validate validates the budget status request
+func (r *BudgetStatusRequest) Validate() error {
+	if r.Month != "" && !monthPattern.MatchString(r.Month) {
+		return errors.New("month must be in MM-YYYY format")
+	}
+	return nil
+}
+
+// CostRequest returns the cost calculation of the subscriptions in the scope of
+// the budget for one month
+func (b *Budget) CostRequest(month string) *CalculateCostRequest {
+	userID := b.UserID
+	req := &CalculateCostRequest{
+		UserID:      &userID,
+		StartPeriod: month,
+		EndPeriod:   month,
+	}
+
+	switch b.Scope {
+	case BudgetScopeCategory:
+		req.Category = *b.Category
+	case BudgetScopeService:
+		req.ServiceID = b.ServiceID
+	}
+
+	return req
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord represents a request made with an Idempotency-Key and,
+// once the request has finished, the response that is replayed to retries
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	Completed   bool
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
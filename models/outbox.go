@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxAggregateSubscription is the aggregate type of outbox events about subscriptions
+const OutboxAggregateSubscription = "subscription"
+
+// OutboxEvent is an event recorded in the same transaction as the change it
+// describes and published afterwards by the outbox relay
+type OutboxEvent struct {
+	ID            int64
+	AggregateType string
+	AggregateID   string
+	EventID       uuid.UUID
+	EventType     string
+	Payload       json.RawMessage // The encoded Event
+	Attempts      int
+	CreatedAt     time.Time
+	PublishedAt   *time.Time
+	NextAttemptAt time.Time
+	LastError     string
+}
+
+// NewSubscriptionOutboxEvents builds the events describing a subscription change
+// recorded in the audit log under action
+func NewSubscriptionOutboxEvents(action string, before, after *Subscription) ([]*OutboxEvent, error) {
+	subscription := after
+	if subscription == nil {
+		subscription = before
+	}
+
+	var eventTypes []string
+	switch action {
+	case AuditActionCreate:
+		eventTypes = []string{EventSubscriptionCreated}
+	case AuditActionUpdate:
+		eventTypes = []string{EventSubscriptionUpdated}
+		if endDateChanged(before, after) {
+			eventTypes = append(eventTypes, EventSubscriptionEnded)
+		}
+	case AuditActionDelete:
+		eventTypes = []string{EventSubscriptionDeleted}
+	case AuditActionRestore:
+		eventTypes = []string{EventSubscriptionRestored}
+	}
+
+	events := make([]*OutboxEvent, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		event := NewEvent(eventType, subscription)
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &OutboxEvent{
+			AggregateType: OutboxAggregateSubscription,
+			AggregateID:   strconv.Itoa(subscription.ID),
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       payload,
+		})
+	}
+
+	return events, nil
+}
+
+// endDateChanged reports whether an update set or moved the end date
+func endDateChanged(before, after *Subscription) bool {
+	if after == nil || after.EndDate == nil {
+		return false
+	}
+	return before == nil || before.EndDate == nil || *before.EndDate != *after.EndDate
+}
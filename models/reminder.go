@@ -0,0 +1,284 @@
+package models
+
+import (
+	"errors"
+	"net/mail"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reminder kinds
+const (
+	ReminderKindRenewal = "renewal" // The subscription renews on the first day of every month it is active
+	ReminderKindEnd     = "end"     // The subscription ends after its end_date month
+)
+
+// Reminder job states
+const (
+	ReminderStatusPending   = "pending"
+	ReminderStatusSent      = "sent"
+	ReminderStatusFailed    = "failed"    // All attempts failed
+	ReminderStatusCancelled = "cancelled" // The subscription changed so that the reminder no longer applies
+)
+
+// Channels reminders can be delivered through
+const (
+	NotifyChannelLog     = "log"
+	NotifyChannelEmail   = "email"
+	NotifyChannelWebhook = "webhook"
+)
+
+// MaxReminderLeadDays bounds the lead times; renewals are at most a month apart
+const MaxReminderLeadDays = 30
+
+// ReminderPreferences holds how and when a user is reminded of their subscriptions
+type ReminderPreferences struct {
+	UserID          uuid.UUID `json:"user_id"`
+	Enabled         bool      `json:"enabled"`
+	RenewalLeadDays []int     `json:"renewal_lead_days"` // Days before a renewal to send a reminder
+	EndLeadDays     []int     `json:"end_lead_days"`     // Days before the end of a subscription to send a reminder
+	Channel         string    `json:"channel"`
+	Target          string    `json:"target,omitempty"` // Email address or webhook URL, depending on the channel
+	UpdatedAt       time.Time `json:"updated_at,omitempty"`
+}
+
+// UpdateReminderPreferencesRequest represents the request body for replacing a user's reminder preferences
+type UpdateReminderPreferencesRequest struct {
+	Enabled         bool   `json:"enabled"`
+	RenewalLeadDays []int  `json:"renewal_lead_days"`
+	EndLeadDays     []int  `json:"end_lead_days"`
+	Channel         string `json:"channel" binding:"required"`
+	Target          string `json:"target,omitempty"`
+}
+
+// Validate validates the reminder preferences
+func (r *UpdateReminderPreferencesRequest) Validate() error {
+	for _, days := range append(append([]int{}, r.RenewalLeadDays...), r.EndLeadDays...) {
+		if days < 0 || days > MaxReminderLeadDays {
+			return errors.New("lead days must be between 0 and 30")
+		}
+	}
+
+	return validateNotifyTarget(r.Channel, r.Target)
+}
+
+// validateNotifyTarget checks that target is an address the channel can deliver to
+func validateNotifyTarget(channel, target string) error {
+	switch channel {
+	case NotifyChannelLog:
+	case NotifyChannelEmail:
+		if _, err := mail.ParseAddress(target); err != nil {
+			return errors.New("target must be an email address for the email channel")
+		}
+	case NotifyChannelWebhook:
+		parsed, err := url.Parse(target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("target must be an absolute http or https URL for the webhook channel")
+		}
+	default:
+		return errors.New("channel must be one of log, email, webhook")
+	}
+
+	return nil
+}
+
+// ReminderJob is a reminder scheduled for one lead time before one renewal or end
+type ReminderJob struct {
+	ID             int64         `json:"id"`
+	SubscriptionID int           `json:"subscription_id"`
+	UserID         uuid.UUID     `json:"user_id"`
+	Kind           string        `json:"kind"`
+	DueOn          time.Time     `json:"due_on"` // The day the subscription renews or ends
+	LeadDays       int           `json:"lead_days"`
+	SendAt         time.Time     `json:"send_at"`
+	Channel        string        `json:"channel"`
+	Target         string        `json:"target,omitempty"`
+	Status         string        `json:"status"`
+	Attempts       int           `json:"attempts"`
+	NextAttemptAt  time.Time     `json:"next_attempt_at"`
+	LastError      string        `json:"last_error,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	SentAt         *time.Time    `json:"sent_at,omitempty"`
+	Subscription   *Subscription `json:"-"` // Loaded when the job is claimed for delivery
+}
+
+// ReminderTarget is a subscription together with its owner's reminder preferences
+type ReminderTarget struct {
+	Subscription *Subscription
+	Preferences  *ReminderPreferences // Nil when the user has not set any
+}
+
+// NextRenewal returns the first renewal of the subscription on or after now.
+// A subscription renews on the first day of every month after its start month
+// up to and including its end month.
+func (s *Subscription) NextRenewal(now time.Time) (time.Time, bool) {
+	start, err := time.Parse("01-2006", s.StartDate)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	renewal := startOfMonth(now)
+	if renewal.Before(now) {
+		renewal = renewal.AddDate(0, 1, 0)
+	}
+	if !renewal.After(start) {
+		renewal = start.AddDate(0, 1, 0)
+	}
+
+	if end, ok := s.EndsOn(); ok && !renewal.Before(end) {
+		return time.Time{}, false
+	}
+
+	return renewal, true
+}
+
+// EndsOn returns the day after the last day of the subscription, i.e. the first
+// day of the month after its end_date, if it has one
+func (s *Subscription) EndsOn() (time.Time, bool) {
+	if s.EndDate == nil {
+		return time.Time{}, false
+	}
+
+	end, err := time.Parse("01-2006", *s.EndDate)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return end.AddDate(0, 1, 0), true
+}
+
+// PlanReminders returns the reminder jobs due for a subscription at now. Every
+// lead time whose send time is still ahead gets a job; of the lead times that
+// have already passed only the latest does, so that a new subscription or a
+// changed preference does not produce a burst of stale reminders.
+func PlanReminders(target *ReminderTarget, now time.Time) []*ReminderJob {
+	preferences := target.Preferences
+	if preferences == nil || !preferences.Enabled {
+		return nil
+	}
+
+	subscription := target.Subscription
+	jobs := []*ReminderJob{}
+
+	if renewal, ok := subscription.NextRenewal(now); ok {
+		jobs = append(jobs, planReminders(subscription, preferences, ReminderKindRenewal, renewal, preferences.RenewalLeadDays, now)...)
+	}
+	if end, ok := subscription.EndsOn(); ok && end.After(now) {
+		jobs = append(jobs, planReminders(subscription, preferences, ReminderKindEnd, end, preferences.EndLeadDays, now)...)
+	}
+
+	return jobs
+}
+
+// ReminderWindowOpen reports whether the next renewal or the end of a
+// subscription is no further ahead than the longest lead time of its kind.
+// Until then PlanReminders is not needed for it: once the window opens it plans
+// the longest lead time as its latest passed one.
+func ReminderWindowOpen(subscription *Subscription, preferences *ReminderPreferences, now time.Time) bool {
+	if !preferences.Enabled {
+		return false
+	}
+
+	if renewal, ok := subscription.NextRenewal(now); ok && withinLead(renewal, preferences.RenewalLeadDays, now) {
+		return true
+	}
+
+	end, ok := subscription.EndsOn()
+	return ok && end.After(now) && withinLead(end, preferences.EndLeadDays, now)
+}
+
+// withinLead reports whether the send time of any of leadDays before day has come
+func withinLead(day time.Time, leadDays []int, now time.Time) bool {
+	for _, lead := range leadDays {
+		if !day.AddDate(0, 0, -lead).After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReminderMatchesPreferences reports whether a planned job is still wanted by
+// the user's preferences: reminders are enabled and its lead time is still one
+// of the lead times of its kind
+func ReminderMatchesPreferences(job *ReminderJob, preferences *ReminderPreferences) bool {
+	if !preferences.Enabled {
+		return false
+	}
+
+	for _, lead := range preferences.LeadDays(job.Kind) {
+		if lead == job.LeadDays {
+			return true
+		}
+	}
+	return false
+}
+
+// LeadDays returns the lead times of a reminder kind
+func (p *ReminderPreferences) LeadDays(kind string) []int {
+	if kind == ReminderKindEnd {
+		return p.EndLeadDays
+	}
+	return p.RenewalLeadDays
+}
+
+// ReminderStillApplies reports whether a planned job still matches the
+// subscription, which may have changed or ended since the job was planned
+func ReminderStillApplies(job *ReminderJob, subscription *Subscription, now time.Time) bool {
+	if subscription == nil || subscription.DeletedAt != nil || !job.DueOn.After(now) {
+		return false
+	}
+
+	switch job.Kind {
+	case ReminderKindRenewal:
+		renewal, ok := subscription.NextRenewal(now)
+		return ok && renewal.Equal(job.DueOn)
+	case ReminderKindEnd:
+		end, ok := subscription.EndsOn()
+		return ok && end.Equal(job.DueOn)
+	}
+
+	return false
+}
+
+// planReminders plans the jobs of one kind for a single renewal or end
+func planReminders(subscription *Subscription, preferences *ReminderPreferences, kind string, dueOn time.Time, leadDays []int, now time.Time) []*ReminderJob {
+	leads := append([]int{}, leadDays...)
+	sort.Sort(sort.Reverse(sort.IntSlice(leads)))
+
+	var jobs []*ReminderJob
+	var latestPassed *ReminderJob
+	for _, lead := range leads {
+		job := &ReminderJob{
+			SubscriptionID: subscription.ID,
+			UserID:         subscription.UserID,
+			Kind:           kind,
+			DueOn:          dueOn,
+			LeadDays:       lead,
+			SendAt:         dueOn.AddDate(0, 0, -lead),
+			Channel:        preferences.Channel,
+			Target:         preferences.Target,
+			Status:         ReminderStatusPending,
+		}
+
+		if job.SendAt.After(now) {
+			jobs = append(jobs, job)
+		} else {
+			latestPassed = job
+		}
+	}
+
+	if latestPassed != nil {
+		jobs = append(jobs, latestPassed)
+	}
+
+	return jobs
+}
+
+// startOfMonth returns midnight UTC on the first day of the month of t
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
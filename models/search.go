@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"subscription-service/search"
+)
+
+// SearchSubscriptionsRequest represents the query parameters for searching subscriptions
+type SearchSubscriptionsRequest struct {
+	Query  string     `form:"q" binding:"required"`
+	UserID *uuid.UUID `form:"-"` // Parsed by the handler; gin cannot bind uuid.UUID
+	Limit  int        `form:"limit,default=20"`
+}
+
+// SubscriptionSearchResult represents a subscription found by a search
+type SubscriptionSearchResult struct {
+	Subscription
+	Score     float64 `json:"score"`     // From 0 to 1; 1 when every word of the query starts a word of the service name
+	Highlight string  `json:"highlight"` // HTML-escaped service name with the matching words in <b> tags
+}
+
+// SearchSubscriptionsResponse represents the ranked results of a search, best first
+type SearchSubscriptionsResponse struct {
+	Items []*SubscriptionSearchResult `json:"items"`
+}
+
+// Validate validates the search subscriptions request
+func (r *SearchSubscriptionsRequest) Validate() error {
+	if utf8.RuneCountInString(r.Query) > 100 {
+		return errors.New("q must be at most 100 characters long")
+	}
+
+	if search.Normalize(r.Query) == "" {
+		return errors.New("q must contain letters or digits")
+	}
+
+	if r.Limit < 1 || r.Limit > 100 {
+		return errors.New("limit must be between 1 and 100")
+	}
+
+	return nil
+}
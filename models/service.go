@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Service represents an entry of the service catalog that subscriptions refer to
+type Service struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`    // Canonical name, copied into the service_name of subscriptions
+	Aliases      []string  `json:"aliases"` // Lookup keys of the names the service is known by, see ServiceKey
+	Category     *string   `json:"category,omitempty"`
+	LogoURL      *string   `json:"logo_url,omitempty"`
+	DefaultPrice *int      `json:"default_price,omitempty"` // Price of subscriptions created without one
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CreateServiceRequest represents the request body for adding a service to the catalog
+type CreateServiceRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	Aliases      []string `json:"aliases"` // Other names the service is known by
+	Category     *string  `json:"category,omitempty"`
+	LogoURL      *string  `json:"logo_url,omitempty"`
+	DefaultPrice *int     `json:"default_price,omitempty"`
+}
+
+// AddServiceAliasRequest represents the request body for adding an alias to a service
+type AddServiceAliasRequest struct {
+	Alias string `json:"alias" binding:"required"`
+}
+
+// ListServicesRequest represents the query parameters for listing the catalog
+type ListServicesRequest struct {
+	Category string `form:"category"`
+}
+
+// CleanServiceName trims a service name and collapses its inner whitespace
+func CleanServiceName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// ServiceKey returns the key a service name is looked up by among the aliases,
+// so that "Netflix", "netflix" and "NETFLIX " find the same service
+func ServiceKey(name string) string {
+	return strings.ToLower(CleanServiceName(name))
+}
+
+// Validate validates the service creation request
+func (r *CreateServiceRequest) Validate() error {
+	if CleanServiceName(r.Name) == "" {
+		return errors.New("name must not be blank")
+	}
+
+	for _, alias := range r.Aliases {
+		if CleanServiceName(alias) == "" {
+			return errors.New("aliases must not be blank")
+		}
+	}
+
+	if r.LogoURL != nil {
+		parsed, err := url.Parse(*r.LogoURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("logo_url must be an absolute http or https URL")
+		}
+	}
+
+	if r.DefaultPrice != nil && *r.DefaultPrice < 1 {
+		return errors.New("default_price must be at least 1")
+	}
+
+	return nil
+}
+
+// Validate validates the alias request
+func (r *AddServiceAliasRequest) Validate() error {
+	if CleanServiceName(r.Alias) == "" {
+		return errors.New("alias must not be blank")
+	}
+	return nil
+}
@@ -10,49 +10,69 @@ import (
 
 // Subscription represents a user's subscription to a service
 type Subscription struct {
-	ID         int       `json:"id"`
-	ServiceName string    `json:"service_name"`
-	Price       int       `json:"price"`
-	UserID      uuid.UUID `json:"user_id"`
-	StartDate   string    `json:"start_date"`
-	EndDate     *string   `json:"end_date,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int        `json:"id"`
+	ServiceID   int        `json:"service_id"`   // Entry of the service catalog
+	ServiceName string     `json:"service_name"` // Canonical name of the service
+	Price       int        `json:"price"`
+	UserID      uuid.UUID  `json:"user_id"`
+	StartDate   string     `json:"start_date"`
+	EndDate     *string    `json:"end_date,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	Version     int        `json:"version"` // Incremented on every change; exposed as the ETag
 }
 
-// CreateSubscriptionRequest represents the request body for creating a subscription
+// CreateSubscriptionRequest represents the request body for creating a subscription.
+// The service is given by its catalog ID or by a name that resolves through the
+// aliases of the catalog; a name the catalog does not know adds a service.
 type CreateSubscriptionRequest struct {
-	ServiceName string    `json:"service_name" binding:"required"`
-	Price       int       `json:"price" binding:"required,min=1"`
+	ServiceID   *int      `json:"service_id,omitempty"`
+	ServiceName string    `json:"service_name"`
+	Price       int       `json:"price" binding:"omitempty,min=1"` // Defaults to the default price of the service
 	UserID      uuid.UUID `json:"user_id" binding:"required"`
 	StartDate   string    `json:"start_date" binding:"required"`
 	EndDate     *string   `json:"end_date,omitempty"`
 }
 
-// UpdateSubscriptionRequest represents the request body for updating a subscription
+// UpdateSubscriptionRequest represents the request body for replacing a subscription.
+// It is a full replacement: an omitted end_date clears it. The service is given
+// like in CreateSubscriptionRequest.
 type UpdateSubscriptionRequest struct {
-	ServiceName string    `json:"service_name,omitempty"`
-	Price       *int      `json:"price,omitempty" binding:"omitempty,min=1"`
-	UserID      uuid.UUID `json:"user_id,omitempty"`
-	StartDate   string    `json:"start_date,omitempty"`
+	ServiceID   *int      `json:"service_id,omitempty"`
+	ServiceName string    `json:"service_name"`
+	Price       int       `json:"price" binding:"required,min=1"`
+	UserID      uuid.UUID `json:"user_id" binding:"required"`
+	StartDate   string    `json:"start_date" binding:"required"`
 	EndDate     *string   `json:"end_date,omitempty"`
 }
 
 // CalculateCostRequest represents the request for calculating total subscription cost
 type CalculateCostRequest struct {
-	UserID      *uuid.UUID `form:"user_id,omitempty"`
+	UserID      *uuid.UUID `form:"-"` // Parsed by the handler; gin cannot bind uuid.UUID
 	ServiceName *string    `form:"service_name,omitempty"`
+	ServiceID   *int       `form:"service_id"`
+	Category    string     `form:"category"` // Catalog category of the services
 	StartPeriod string     `form:"start_period" binding:"required"`
 	EndPeriod   string     `form:"end_period" binding:"required"`
+	TagIDs      []int      `form:"tag_id"` // Subscriptions with any of these tags
 }
 
 // CalculateCostResponse represents the response for calculating total subscription cost
 type CalculateCostResponse struct {
 	TotalCost int `json:"total_cost"`
+	// Cost of the matching subscriptions per tag, by tag name. A subscription
+	// with several tags counts toward each. With tag filters only those tags
+	// are listed.
+	ByTag []TagCost `json:"by_tag"`
 }
 
 // Validate validates the subscription data
 func (s *CreateSubscriptionRequest) Validate() error {
+	if s.ServiceID == nil && CleanServiceName(s.ServiceName) == "" {
+		return errors.New("service_id or service_name is required")
+	}
+
 	// Validate date format (MM-YYYY)
 	datePattern := regexp.MustCompile(`^(0[1-9]|1[0-2])-(\d{4})$`)
 	if !datePattern.MatchString(s.StartDate) {
@@ -68,9 +88,13 @@ func (s *CreateSubscriptionRequest) Validate() error {
 
 // Validate validates the subscription update data
 func (s *UpdateSubscriptionRequest) Validate() error {
+	if s.ServiceID == nil && CleanServiceName(s.ServiceName) == "" {
+		return errors.New("service_id or service_name is required")
+	}
+
 	// Validate date format (MM-YYYY)
 	datePattern := regexp.MustCompile(`^(0[1-9]|1[0-2])-(\d{4})$`)
-	if s.StartDate != "" && !datePattern.MatchString(s.StartDate) {
+	if !datePattern.MatchString(s.StartDate) {
 		return errors.New("start_date must be in MM-YYYY format")
 	}
 
@@ -81,6 +105,62 @@ func (s *UpdateSubscriptionRequest) Validate() error {
 	return nil
 }
 
+// NewUpdateSubscriptionRequest returns the replacement request that reproduces
+// the editable fields of a subscription
+func NewUpdateSubscriptionRequest(subscription *Subscription) *UpdateSubscriptionRequest {
+	serviceID := subscription.ServiceID
+	return &UpdateSubscriptionRequest{
+		ServiceID:   &serviceID,
+		ServiceName: subscription.ServiceName,
+		Price:       subscription.Price,
+		UserID:      subscription.UserID,
+		StartDate:   subscription.StartDate,
+		EndDate:     subscription.EndDate,
+	}
+}
+
+// CostIn returns what the subscription costs in the period between two MM-YYYY
+// months: its price for every month of the period it is active in, counting its
+// start and end months. CalculateTotalCost sums this over the matching subscriptions.
+func (s *Subscription) CostIn(startPeriod, endPeriod string) int {
+	first, ok := monthIndex(startPeriod)
+	if !ok {
+		return 0
+	}
+	last, ok := monthIndex(endPeriod)
+	if !ok {
+		return 0
+	}
+
+	start, ok := monthIndex(s.StartDate)
+	if !ok {
+		return 0
+	}
+	first = max(first, start)
+
+	if s.EndDate != nil {
+		end, ok := monthIndex(*s.EndDate)
+		if !ok {
+			return 0
+		}
+		last = min(last, end)
+	}
+
+	if last < first {
+		return 0
+	}
+	return s.Price * (last - first + 1)
+}
+
+// monthIndex numbers a MM-YYYY month so that consecutive months differ by one
+func monthIndex(month string) (int, bool) {
+	date, err := time.Parse("01-2006", month)
+	if err != nil {
+		return 0, false
+	}
+	return date.Year()*12 + int(date.Month()) - 1, true
+}
+
 // Validate validates the calculate cost request
 func (c *CalculateCostRequest) Validate() error {
 	// Validate date format (MM-YYYY)
@@ -93,5 +173,9 @@ func (c *CalculateCostRequest) Validate() error {
 		return errors.New("end_period must be in MM-YYYY format")
 	}
 
-	return nil
-}
\ No newline at end of file
+	if c.ServiceID != nil && *c.ServiceID < 1 {
+		return errors.New("service_id must be a positive integer")
+	}
+
+	return validateTagFilters(c.TagIDs)
+}
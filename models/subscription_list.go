@@ -0,0 +1,182 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Keys subscription lists can be sorted by
+const (
+	SortByPrice       = "price"
+	SortByStartDate   = "start_date"
+	SortByCreatedAt   = "created_at"
+	SortByServiceName = "service_name"
+)
+
+// Directions subscription lists can be sorted in
+const (
+	SortAscending  = "asc"
+	SortDescending = "desc"
+)
+
+// cursorTimeFormat keeps the microseconds PostgreSQL stores and, in UTC,
+// orders like the times it formats
+const cursorTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// monthPattern matches the MM-YYYY format of subscription dates
+var monthPattern = regexp.MustCompile(`^(0[1-9]|1[0-2])-(\d{4})$`)
+
+// ErrInvalidCursor is returned for a cursor that was not issued for the list it is used with
+var ErrInvalidCursor = errors.New("cursor is invalid")
+
+// ListSubscriptionsRequest represents the query parameters for listing subscriptions
+type ListSubscriptionsRequest struct {
+	UserID        *uuid.UUID `form:"-"` // Parsed by the handler; gin cannot bind uuid.UUID
+	ServiceName   *string    `form:"service_name"`
+	ServicePrefix string     `form:"service_prefix"` // Case-insensitive prefix of the service name
+	MinPrice      *int       `form:"min_price"`
+	MaxPrice      *int       `form:"max_price"`
+	ActiveIn      string     `form:"active_in"` // Month (MM-YYYY) the subscriptions must be active in
+	HasEndDate    *bool      `form:"has_end_date"`
+	TagIDs        []int      `form:"tag_id"` // Subscriptions with any of these tags
+	Sort          string     `form:"sort,default=created_at"`
+	Order         string     `form:"order,default=asc"`
+	Limit         int        `form:"limit,default=50"`
+	Cursor        string     `form:"cursor"` // next_cursor of the previous page
+	IncludeTotal  bool       `form:"include_total"`
+}
+
+// SubscriptionPage represents a page of subscriptions
+type SubscriptionPage struct {
+	Items      []*Subscription `json:"items"`
+	NextCursor string          `json:"next_cursor,omitempty"` // Absent on the last page
+	Total      *int            `json:"total,omitempty"`       // Subscriptions matching the filters, if requested
+}
+
+// SubscriptionCursor marks the subscription a page ended with. It is bound to
+// the sort it was issued for.
+type SubscriptionCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"` // SortValue of the subscription
+	ID    int    `json:"id"`
+}
+
+// Validate validates the list subscriptions request
+func (r *ListSubscriptionsRequest) Validate() error {
+	switch r.Sort {
+	case SortByPrice, SortByStartDate, SortByCreatedAt, SortByServiceName:
+	default:
+		return errors.New("sort must be one of price, start_date, created_at, service_name")
+	}
+
+	if r.Order != SortAscending && r.Order != SortDescending {
+		return errors.New("order must be asc or desc")
+	}
+
+	if r.Limit < 1 || r.Limit > 500 {
+		return errors.New("limit must be between 1 and 500")
+	}
+
+	if (r.MinPrice != nil && *r.MinPrice < 0) || (r.MaxPrice != nil && *r.MaxPrice < 0) {
+		return errors.New("min_price and max_price must not be negative")
+	}
+
+	if r.MinPrice != nil && r.MaxPrice != nil && *r.MinPrice > *r.MaxPrice {
+		return errors.New("min_price cannot be greater than max_price")
+	}
+
+	if r.ActiveIn != "" && !monthPattern.MatchString(r.ActiveIn) {
+		return errors.New("active_in must be in MM-YYYY format")
+	}
+
+	if err := validateTagFilters(r.TagIDs); err != nil {
+		return err
+	}
+
+	if _, err := r.ParseCursor(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ParseCursor decodes the cursor of the request; it returns nil for the first page
+func (r *ListSubscriptionsRequest) ParseCursor() (*SubscriptionCursor, error) {
+	if r.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(r.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor SubscriptionCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// A cursor only marks a position in the order it was issued for
+	if cursor.Sort != r.Sort || cursor.Order != r.Order {
+		return nil, ErrInvalidCursor
+	}
+
+	if _, err := cursor.SortArg(); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// NextCursor returns the cursor of the page that follows last
+func (r *ListSubscriptionsRequest) NextCursor(last *Subscription) string {
+	data, _ := json.Marshal(SubscriptionCursor{
+		Sort:  r.Sort,
+		Order: r.Order,
+		Value: last.SortValue(r.Sort),
+		ID:    last.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// SortArg returns the value of the cursor as a query argument of the type of its sort key
+func (c *SubscriptionCursor) SortArg() (interface{}, error) {
+	switch c.Sort {
+	case SortByPrice:
+		return strconv.Atoi(c.Value)
+	case SortByCreatedAt:
+		return time.Parse(cursorTimeFormat, c.Value)
+	default:
+		return c.Value, nil
+	}
+}
+
+// SortValue returns the value the subscription is ordered by when sorting by
+// sort. Start dates are turned into YYYYMM so that they order by time.
+func (s *Subscription) SortValue(sort string) string {
+	switch sort {
+	case SortByPrice:
+		return strconv.Itoa(s.Price)
+	case SortByStartDate:
+		return MonthKey(s.StartDate)
+	case SortByCreatedAt:
+		return s.CreatedAt.UTC().Format(cursorTimeFormat)
+	default:
+		return s.ServiceName
+	}
+}
+
+// MonthKey turns a MM-YYYY month into YYYYMM, which orders by time
+func MonthKey(month string) string {
+	if len(month) != len("MM-YYYY") {
+		return month
+	}
+	return month[3:] + month[:2]
+}
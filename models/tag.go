@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// MaxTagNameLength is the longest tag name in characters
+const MaxTagNameLength = 64
+
+// MaxTagFilters is the most tags a list or cost calculation can be filtered by
+const MaxTagFilters = 20
+
+// Tag represents a group a user puts subscriptions in, such as "work" or "family".
+// Tag names are unique per user regardless of case.
+type Tag struct {
+	ID        int       `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateTagRequest represents the request body for creating a tag
+type CreateTagRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+	Name   string    `json:"name" binding:"required"`
+}
+
+// RenameTagRequest represents the request body for renaming a tag
+type RenameTagRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// ListTagsRequest represents the query parameters for listing tags
+type ListTagsRequest struct {
+	UserID *uuid.UUID `form:"-"` // Parsed by the handler; gin cannot bind uuid.UUID
+}
+
+// TagCost is the cost of the subscriptions with a tag
+type TagCost struct {
+	TagID     int    `json:"tag_id"`
+	Name      string `json:"name"`
+	TotalCost int    `json:"total_cost"`
+}
+
+// CleanTagName trims a tag name and collapses its inner whitespace
+func CleanTagName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Validate validates the tag creation request
+func (r *CreateTagRequest) Validate() error {
+	return validateTagName(r.Name)
+}
+
+// Validate validates the tag rename request
+func (r *RenameTagRequest) Validate() error {
+	return validateTagName(r.Name)
+}
+
+// validateTagName checks that a tag name is neither blank nor too long
+func validateTagName(name string) error {
+	name = CleanTagName(name)
+	if name == "" {
+		return errors.New("name must not be blank")
+	}
+	if utf8.RuneCountInString(name) > MaxTagNameLength {
+		return errors.New("name must be at most 64 characters")
+	}
+	return nil
+}
+
+// validateTagFilters checks the tag IDs a request is filtered by
+func validateTagFilters(tagIDs []int) error {
+	if len(tagIDs) > MaxTagFilters {
+		return errors.New("at most 20 tag_id filters are allowed")
+	}
+	for _, id := range tagIDs {
+		if id < 1 {
+			return errors.New("tag_id must be a positive integer")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscription lifecycle events delivered to webhooks
+const (
+	EventSubscriptionCreated  = "subscription.created"
+	EventSubscriptionUpdated  = "subscription.updated"
+	EventSubscriptionEnded    = "subscription.ended"
+	EventSubscriptionDeleted  = "subscription.deleted"
+	EventSubscriptionRestored = "subscription.restored"
+)
+
+// EventTypes lists every event type a webhook can subscribe to
+var EventTypes = []string{
+	EventSubscriptionCreated,
+	EventSubscriptionUpdated,
+	EventSubscriptionEnded,
+	EventSubscriptionDeleted,
+	EventSubscriptionRestored,
+}
+
+// Webhook delivery states
+const (
+	DeliveryStatusPending   = "pending"   // Waiting for its first or next attempt
+	DeliveryStatusSucceeded = "succeeded" // The endpoint answered with a 2xx status
+	DeliveryStatusDead      = "dead"      // All attempts failed; only a manual redelivery sends it again
+)
+
+// Event is a subscription lifecycle event as sent to webhook endpoints
+type Event struct {
+	ID         uuid.UUID     `json:"id"`
+	Type       string        `json:"type"`
+	OccurredAt time.Time     `json:"occurred_at"`
+	Data       *Subscription `json:"data"`
+}
+
+// NewEvent creates an event about a subscription
+func NewEvent(eventType string, subscription *Subscription) *Event {
+	return &Event{
+		ID:         uuid.New(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       subscription,
+	}
+}
+
+// WebhookEndpoint represents a registered webhook receiver
+type WebhookEndpoint struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"` // Event types sent to the endpoint; empty means all
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Accepts reports whether the endpoint is subscribed to an event type
+func (e *WebhookEndpoint) Accepts(eventType string) bool {
+	if !e.Active {
+		return false
+	}
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, accepted := range e.Events {
+		if accepted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateWebhookRequest represents the request body for registering a webhook
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"` // Generated when empty
+}
+
+// Validate validates the webhook registration request
+func (r *CreateWebhookRequest) Validate() error {
+	parsed, err := url.Parse(r.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+
+	for _, eventType := range r.Events {
+		if !isEventType(eventType) {
+			return errors.New("unknown event type: " + eventType)
+		}
+	}
+
+	return nil
+}
+
+// WebhookDelivery represents the delivery of one event to one endpoint
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	EndpointID     int             `json:"endpoint_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// DeliveryResult is the outcome of a single delivery attempt
+type DeliveryResult struct {
+	StatusCode    *int
+	Error         string
+	Succeeded     bool
+	NextAttemptAt *time.Time // When to try again; nil moves a failed delivery to the dead-letter state
+}
+
+// ListDeliveriesRequest represents the query parameters for listing webhook deliveries
+type ListDeliveriesRequest struct {
+	EndpointID *int   `form:"endpoint_id"`
+	Status     string `form:"status"`
+	Limit      int    `form:"limit,default=50"`
+	Offset     int    `form:"offset"`
+}
+
+// Validate validates the delivery list query
+func (r *ListDeliveriesRequest) Validate() error {
+	switch r.Status {
+	case "", DeliveryStatusPending, DeliveryStatusSucceeded, DeliveryStatusDead:
+	default:
+		return errors.New("status must be one of pending, succeeded, dead")
+	}
+
+	if r.Limit < 1 || r.Limit > 500 {
+		return errors.New("limit must be between 1 and 500")
+	}
+
+	if r.Offset < 0 {
+		return errors.New("offset must not be negative")
+	}
+
+	return nil
+}
+
+// isEventType reports whether eventType is a known event type
+func isEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
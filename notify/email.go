@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"subscription-service/config"
+)
+
+// EmailNotifier sends messages as plain-text email through an SMTP server
+type EmailNotifier struct {
+	cfg config.SMTPConfig
+}
+
+// NewEmailNotifier creates a notifier that sends email through the configured server
+func NewEmailNotifier(cfg config.SMTPConfig) *EmailNotifier {
+	return &EmailNotifier{cfg: cfg}
+}
+
+// Notify sends the message to its target address
+func (n *EmailNotifier) Notify(ctx context.Context, message *Message) error {
+	addr := net.JoinHostPort(n.cfg.Host, n.cfg.Port)
+
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)
+	}
+
+	if err := smtp.SendMail(addr, auth, n.cfg.From, []string{message.Target}, n.compose(message)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+// compose builds the RFC 5322 message
+func (n *EmailNotifier) compose(message *Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", message.Target)
+	fmt.Fprintf(&b, "Subject: %s\r\n", stripNewlines(message.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
+
+// stripNewlines keeps user-provided text from injecting headers
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,23 @@
+package notify
+
+import (
+	"context"
+
+	"subscription-service/logger"
+)
+
+// LogNotifier writes messages to the service log; useful in development and as a default channel
+type LogNotifier struct {
+	logger *logger.Logger
+}
+
+// NewLogNotifier creates a notifier that logs every message
+func NewLogNotifier(logger *logger.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+// Notify logs the message
+func (n *LogNotifier) Notify(ctx context.Context, message *Message) error {
+	n.logger.Infof("Notification: %s: %s", message.Subject, message.Body)
+	return nil
+}
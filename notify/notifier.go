@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+)
+
+// Message is a notification addressed to a user through one channel
+type Message struct {
+	Channel string      // One of the models.NotifyChannel* constants
+	Target  string      // Email address or webhook URL; unused by the log channel
+	Subject string      // Short summary, used as the email subject
+	Body    string      // Human-readable text
+	Payload interface{} // Structured form of the message, sent as JSON by the webhook channel
+}
+
+// Notifier delivers messages to users
+type Notifier interface {
+	Notify(ctx context.Context, message *Message) error
+}
+
+// Router is a Notifier that hands every message to the notifier of its channel
+type Router map[string]Notifier
+
+// Notify delivers the message through the notifier registered for its channel
+func (r Router) Notify(ctx context.Context, message *Message) error {
+	notifier, ok := r[message.Channel]
+	if !ok {
+		return fmt.Errorf("notification channel %q is not configured", message.Channel)
+	}
+
+	return notifier.Notify(ctx, message)
+}
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier posts the payload of every message as JSON to the message target
+type WebhookNotifier struct {
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier that posts messages to their target URL
+func NewWebhookNotifier(timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{client: &http.Client{Timeout: timeout}}
+}
+
+// Notify posts the message payload and treats any non-2xx status as a failure
+func (n *WebhookNotifier) Notify(ctx context.Context, message *Message) error {
+	body, err := json.Marshal(message.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, message.Target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"subscription-service/models"
+)
+
+// Headers describing the event sent by HTTPPublisher
+const (
+	EventIDHeader       = "X-Event-ID"
+	EventTypeHeader     = "X-Event-Type"
+	AggregateTypeHeader = "X-Aggregate-Type"
+	AggregateIDHeader   = "X-Aggregate-ID"
+)
+
+// HTTPPublisher POSTs every event as JSON to a fixed URL
+type HTTPPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPPublisher creates a new HTTP publisher
+func NewHTTPPublisher(url string, timeout time.Duration) *HTTPPublisher {
+	return &HTTPPublisher{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Publish sends the event; any response other than 2xx is a failure
+func (p *HTTPPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(event.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, event.EventID.String())
+	req.Header.Set(EventTypeHeader, event.EventType)
+	req.Header.Set(AggregateTypeHeader, event.AggregateType)
+	req.Header.Set(AggregateIDHeader, event.AggregateID)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to publish event: %s answered %d", p.url, resp.StatusCode)
+	}
+
+	return nil
+}
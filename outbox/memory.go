@@ -0,0 +1,68 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"subscription-service/models"
+)
+
+// InMemoryPublisher keeps published events in memory and passes them to
+// in-process subscribers
+type InMemoryPublisher struct {
+	events      []*models.OutboxEvent
+	subscribers map[chan *models.OutboxEvent]struct{}
+	mutex       sync.Mutex
+}
+
+// NewInMemoryPublisher creates a new in-memory publisher
+func NewInMemoryPublisher() *InMemoryPublisher {
+	return &InMemoryPublisher{
+		subscribers: make(map[chan *models.OutboxEvent]struct{}),
+	}
+}
+
+// Publish stores the event and hands it to every subscriber. Subscribers that
+// are not keeping up miss the event rather than blocking the relay.
+func (p *InMemoryPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.events = append(p.events, event)
+	for subscriber := range p.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Events returns the events published so far
+func (p *InMemoryPublisher) Events() []*models.OutboxEvent {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]*models.OutboxEvent(nil), p.events...)
+}
+
+// Subscribe returns a channel receiving every event published from now on and
+// a function that ends the subscription
+func (p *InMemoryPublisher) Subscribe(buffer int) (<-chan *models.OutboxEvent, func()) {
+	subscriber := make(chan *models.OutboxEvent, buffer)
+
+	p.mutex.Lock()
+	p.subscribers[subscriber] = struct{}{}
+	p.mutex.Unlock()
+
+	var once sync.Once
+	return subscriber, func() {
+		once.Do(func() {
+			p.mutex.Lock()
+			delete(p.subscribers, subscriber)
+			p.mutex.Unlock()
+			close(subscriber)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Package outbox relays events recorded in the transactional outbox to publishers.
+package outbox
+
+import (
+	"context"
+	"errors"
+
+	"subscription-service/models"
+)
+
+// Publisher delivers outbox events to their consumers. Events are published at
+// least once: Publish may be called again for an event it already accepted, so
+// consumers should deduplicate by event ID.
+type Publisher interface {
+	Publish(ctx context.Context, event *models.OutboxEvent) error
+}
+
+// MultiPublisher publishes every event to all of its publishers
+type MultiPublisher []Publisher
+
+// Publish passes event to every publisher; it fails if any of them fails, in
+// which case the event is published to all of them again later
+func (m MultiPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	var errs []error
+	for _, publisher := range m {
+		if err := publisher.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,79 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"subscription-service/backoff"
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/repository"
+)
+
+// Relay moves events from the outbox to a publisher
+type Relay struct {
+	store     repository.OutboxStore
+	publisher Publisher
+	cfg       config.OutboxConfig
+	logger    *logger.Logger
+}
+
+// NewRelay creates a new outbox relay
+func NewRelay(store repository.OutboxStore, publisher Publisher, cfg config.OutboxConfig, logger *logger.Logger) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		cfg:       cfg,
+		logger:    logger,
+	}
+}
+
+// RelayPending publishes batches of due events until none are left and returns
+// how many were published. Each batch is claimed and completed in short
+// transactions of its own, so no rows stay locked while the publisher works.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		// A claimed event is not handed out again until publishing has had time to
+		// finish; if it takes longer, the event may be published twice but never
+		// ahead of its aggregate's earlier events
+		events, err := r.store.ClaimPendingEvents(ctx, r.cfg.BatchSize, 2*r.cfg.Timeout)
+		if err != nil {
+			return total, err
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		published := 0
+		for _, event := range events {
+			if err := r.publisher.Publish(ctx, event); err != nil {
+				r.logger.Errorf("Failed to publish %s event %s (attempt %d): %v", event.EventType, event.EventID, event.Attempts+1, err)
+				event.LastError = err.Error()
+				event.NextAttemptAt = time.Now().Add(r.retryDelay(event.Attempts + 1))
+				continue
+			}
+
+			publishedAt := time.Now()
+			event.PublishedAt = &publishedAt
+			published++
+		}
+
+		if err := r.store.CompleteEvents(ctx, events); err != nil {
+			return total, err
+		}
+
+		// Events of an aggregate are published one per batch, so keep going while there is progress
+		total += published
+		if published == 0 {
+			break
+		}
+	}
+
+	return total, nil
+}
+
+// retryDelay returns how long a failed event waits before its next attempt
+func (r *Relay) retryDelay(attempts int) time.Duration {
+	return backoff.Exponential(attempts, r.cfg.InitialBackoff, r.cfg.MaxBackoff)
+}
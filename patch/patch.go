@@ -0,0 +1,391 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902)
+// documents to JSON values.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of the supported patch formats
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalidPatch is returned when a patch document is malformed or cannot be applied
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrTestFailed is returned when a JSON Patch "test" operation does not match
+	ErrTestFailed = errors.New("patch test operation failed")
+)
+
+// Operation is a single JSON Patch operation
+type Operation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from,omitempty"`
+	Value *json.RawMessage `json:"value,omitempty"`
+}
+
+// MergePatch applies an RFC 7396 merge patch to a JSON document. Members set to
+// null in the patch are removed from the document; absent members are left alone.
+func MergePatch(document, mergePatch []byte) ([]byte, error) {
+	target, err := decode(document)
+	if err != nil {
+		return nil, fmt.Errorf("%w: document: %v", ErrInvalidPatch, err)
+	}
+
+	patchValue, err := decode(mergePatch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(mergeValue(target, patchValue))
+}
+
+// mergeValue implements the MergePatch algorithm from RFC 7396 section 2
+func mergeValue(target, patchValue interface{}) interface{} {
+	patchObject, ok := patchValue.(map[string]interface{})
+	if !ok {
+		return patchValue
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// JSONPatch applies an RFC 6902 patch to a JSON document. Operations are applied
+// in order and the whole patch fails if any of them fails.
+func JSONPatch(document, jsonPatch []byte) ([]byte, error) {
+	target, err := decode(document)
+	if err != nil {
+		return nil, fmt.Errorf("%w: document: %v", ErrInvalidPatch, err)
+	}
+
+	var operations []Operation
+	if err := json.Unmarshal(jsonPatch, &operations); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	for i, operation := range operations {
+		target, err = applyOperation(target, operation)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, operation.Op, operation.Path, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+// applyOperation applies one JSON Patch operation and returns the new document root
+func applyOperation(document interface{}, operation Operation) (interface{}, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+		value, err := decode(*operation.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+
+		switch operation.Op {
+		case "add":
+			return add(document, path, value)
+		case "replace":
+			if len(path) == 0 {
+				return value, nil
+			}
+			if document, err = remove(document, path); err != nil {
+				return nil, err
+			}
+			return add(document, path, value)
+		default:
+			current, err := get(document, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, ErrTestFailed
+			}
+			return document, nil
+		}
+
+	case "remove":
+		return remove(document, path)
+
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(document, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if operation.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalidPatch)
+			}
+			if document, err = remove(document, from); err != nil {
+				return nil, err
+			}
+		} else {
+			// Copies must not share nested maps or slices with the source
+			if value, err = clone(value); err != nil {
+				return nil, err
+			}
+		}
+		return add(document, path, value)
+	}
+
+	return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, operation.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// get returns the value a pointer refers to
+func get(document interface{}, path []string) (interface{}, error) {
+	current := document
+	for _, token := range path {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q does not exist", ErrInvalidPatch, token)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("%w: cannot traverse into a scalar at %q", ErrInvalidPatch, token)
+		}
+	}
+
+	return current, nil
+}
+
+// add inserts or sets a value and returns the new document root
+func add(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(document, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			if token == "-" {
+				return append(node, value), nil
+			}
+			index, err := arrayIndex(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("%w: cannot add to a scalar", ErrInvalidPatch)
+	})
+}
+
+// remove deletes the referenced value and returns the new document root
+func remove(document interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	return update(document, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("%w: member %q does not exist", ErrInvalidPatch, token)
+			}
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:index], node[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: cannot remove from a scalar", ErrInvalidPatch)
+	})
+}
+
+// update walks to the parent of the last path token, lets fn change it, and writes
+// the result back up the tree so that slices grown or shrunk by fn are kept
+func update(node interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	token, rest := path[0], path[1:]
+	switch parent := node.(type) {
+	case map[string]interface{}:
+		child, ok := parent[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: member %q does not exist", ErrInvalidPatch, token)
+		}
+		updated, err := update(child, rest, fn)
+		if err != nil {
+			return nil, err
+		}
+		parent[token] = updated
+		return parent, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(parent)-1)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := update(parent[index], rest, fn)
+		if err != nil {
+			return nil, err
+		}
+		parent[index] = updated
+		return parent, nil
+	}
+
+	return nil, fmt.Errorf("%w: cannot traverse into a scalar at %q", ErrInvalidPatch, token)
+}
+
+// arrayIndex parses an array reference token that must not exceed max
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max {
+		return 0, fmt.Errorf("%w: array index %q out of range", ErrInvalidPatch, token)
+	}
+
+	return index, nil
+}
+
+// isPrefix reports whether prefix is a leading part of path
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// decode parses a JSON value keeping numbers exact
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+
+	return value, nil
+}
+
+// clone deep-copies a decoded JSON value
+func clone(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// equal compares two decoded JSON values, treating numbers by their numeric value
+func equal(a, b interface{}) bool {
+	if numberA, ok := a.(json.Number); ok {
+		numberB, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		floatA, errA := numberA.Float64()
+		floatB, errB := numberB.Float64()
+		return errA == nil && errB == nil && floatA == floatB
+	}
+
+	switch valueA := a.(type) {
+	case map[string]interface{}:
+		valueB, ok := b.(map[string]interface{})
+		if !ok || len(valueA) != len(valueB) {
+			return false
+		}
+		for key, item := range valueA {
+			other, ok := valueB[key]
+			if !ok || !equal(item, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		valueB, ok := b.([]interface{})
+		if !ok || len(valueA) != len(valueB) {
+			return false
+		}
+		for i := range valueA {
+			if !equal(valueA[i], valueB[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
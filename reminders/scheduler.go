@@ -0,0 +1,173 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subscription-service/backoff"
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/notify"
+	"subscription-service/repository"
+)
+
+// Scheduler plans reminder jobs for upcoming renewals and ends and delivers the due ones.
+// Every replica may run it: planning is deduplicated by the store and due jobs
+// are claimed with a lease, so each reminder is sent by one replica only.
+type Scheduler struct {
+	store    repository.ReminderStore
+	notifier notify.Notifier
+	cfg      config.RemindersConfig
+	logger   *logger.Logger
+}
+
+// NewScheduler creates a new reminder scheduler
+func NewScheduler(store repository.ReminderStore, notifier notify.Notifier, cfg config.RemindersConfig, logger *logger.Logger) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		notifier: notifier,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// Payload is the JSON body of a reminder sent through the webhook channel
+type Payload struct {
+	ReminderID   int64                `json:"reminder_id"`
+	Kind         string               `json:"kind"`
+	DueOn        string               `json:"due_on"`
+	LeadDays     int                  `json:"lead_days"`
+	Subscription *models.Subscription `json:"subscription"`
+}
+
+// DefaultPreferences returns the preferences of a user who has not set any
+func DefaultPreferences(userID uuid.UUID, cfg config.RemindersConfig) *models.ReminderPreferences {
+	return &models.ReminderPreferences{
+		UserID:          userID,
+		Enabled:         true,
+		RenewalLeadDays: append([]int{}, cfg.RenewalLeadDays...),
+		EndLeadDays:     append([]int{}, cfg.EndLeadDays...),
+		Channel:         models.NotifyChannelLog,
+	}
+}
+
+// Run plans new reminders and then delivers the due ones
+func (s *Scheduler) Run(ctx context.Context) error {
+	if _, err := s.Plan(ctx); err != nil {
+		return err
+	}
+
+	return s.Deliver(ctx)
+}
+
+// Plan creates the reminder jobs of the live subscriptions whose next renewal or
+// end is within reach of a lead time and returns how many are new
+func (s *Scheduler) Plan(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	targets, err := s.store.ListReminderTargets(ctx, now, DefaultPreferences(uuid.Nil, s.cfg))
+	if err != nil {
+		return 0, err
+	}
+
+	var jobs []*models.ReminderJob
+	for _, target := range targets {
+		if target.Preferences == nil {
+			target.Preferences = DefaultPreferences(target.Subscription.UserID, s.cfg)
+		}
+		jobs = append(jobs, models.PlanReminders(target, now)...)
+	}
+
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+
+	created, err := s.store.CreateReminderJobs(ctx, jobs)
+	if err != nil {
+		return 0, err
+	}
+	if created > 0 {
+		s.logger.Infof("Planned %d reminders", created)
+	}
+
+	return created, nil
+}
+
+// Deliver sends every due reminder that still applies and records the outcomes
+func (s *Scheduler) Deliver(ctx context.Context) error {
+	// A claimed job is not handed out again until the notification has had time to finish
+	jobs, err := s.store.ClaimDueReminders(ctx, s.cfg.BatchSize, 2*s.cfg.Timeout)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if !models.ReminderStillApplies(job, job.Subscription, time.Now()) {
+			s.logger.Infof("Cancelled %s reminder %d: subscription %d changed", job.Kind, job.ID, job.SubscriptionID)
+			if err := s.store.CompleteReminder(ctx, job.ID, models.ReminderStatusCancelled); err != nil {
+				s.logger.Errorf("Failed to cancel reminder %d: %v", job.ID, err)
+			}
+			continue
+		}
+
+		if err := s.notifier.Notify(ctx, message(job)); err != nil {
+			s.recordFailure(ctx, job, err)
+			continue
+		}
+
+		if err := s.store.CompleteReminder(ctx, job.ID, models.ReminderStatusSent); err != nil {
+			s.logger.Errorf("Failed to record reminder %d as sent: %v", job.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// recordFailure schedules a retry or, after the last attempt, marks the job failed
+func (s *Scheduler) recordFailure(ctx context.Context, job *models.ReminderJob, err error) {
+	var next *time.Time
+
+	attempt := job.Attempts + 1
+	if attempt < s.cfg.MaxAttempts {
+		retryAt := time.Now().Add(backoff.Exponential(attempt, s.cfg.InitialBackoff, s.cfg.MaxBackoff))
+		next = &retryAt
+		s.logger.Errorf("Reminder %d failed (attempt %d), retrying at %s: %v", job.ID, attempt, retryAt.Format(time.RFC3339), err)
+	} else {
+		s.logger.Errorf("Reminder %d failed %d times, giving up: %v", job.ID, attempt, err)
+	}
+
+	if err := s.store.RecordReminderFailure(ctx, job.ID, err.Error(), next); err != nil {
+		s.logger.Errorf("Failed to record reminder %d failure: %v", job.ID, err)
+	}
+}
+
+// message renders a reminder job as a notification
+func message(job *models.ReminderJob) *notify.Message {
+	subscription := job.Subscription
+	day := job.DueOn.Format("2006-01-02")
+
+	subject := fmt.Sprintf("%s renews on %s", subscription.ServiceName, day)
+	body := fmt.Sprintf("Your %s subscription renews on %s for %d.", subscription.ServiceName, day, subscription.Price)
+	if job.Kind == models.ReminderKindEnd {
+		subject = fmt.Sprintf("%s ends on %s", subscription.ServiceName, day)
+		body = fmt.Sprintf("Your %s subscription ends on %s.", subscription.ServiceName, day)
+	}
+
+	return &notify.Message{
+		Channel: job.Channel,
+		Target:  job.Target,
+		Subject: subject,
+		Body:    body,
+		Payload: Payload{
+			ReminderID:   job.ID,
+			Kind:         job.Kind,
+			DueOn:        day,
+			LeadDays:     job.LeadDays,
+			Subscription: subscription,
+		},
+	}
+}
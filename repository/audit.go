@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"subscription-service/db"
+	"subscription-service/models"
+)
+
+// AuditLog describes read access to the audit trail of subscription changes
+type AuditLog interface {
+	ListAudit(ctx context.Context, filter *models.ListAuditRequest) ([]*models.AuditEntry, int, error)
+}
+
+var (
+	_ AuditLog = (*SubscriptionRepository)(nil)
+	_ AuditLog = (*MockSubscriptionRepository)(nil)
+)
+
+// auditColumns is the column list understood by scanAuditEntry
+const auditColumns = `id, actor, request_id, entity_type, entity_id, action, before, after, changes, created_at`
+
+// ListAudit returns a page of audit entries matching the filter, newest first,
+// together with the total number of matching entries
+func (r *SubscriptionRepository) ListAudit(ctx context.Context, filter *models.ListAuditRequest) (_ []*models.AuditEntry, _ int, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	whereConditions := []string{}
+	args := []interface{}{}
+	paramCounter := 1
+
+	if filter.Actor != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf("actor = $%d", paramCounter))
+		args = append(args, filter.Actor)
+		paramCounter++
+	}
+
+	if filter.EntityID != nil {
+		whereConditions = append(whereConditions, fmt.Sprintf("entity_id = $%d", paramCounter))
+		args = append(args, *filter.EntityID)
+		paramCounter++
+	}
+
+	if filter.Action != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf("action = $%d", paramCounter))
+		args = append(args, filter.Action)
+		paramCounter++
+	}
+
+	if filter.From != nil {
+		whereConditions = append(whereConditions, fmt.Sprintf("created_at >= $%d", paramCounter))
+		args = append(args, *filter.From)
+		paramCounter++
+	}
+
+	if filter.To != nil {
+		whereConditions = append(whereConditions, fmt.Sprintf("created_at <= $%d", paramCounter))
+		args = append(args, *filter.To)
+		paramCounter++
+	}
+
+	where := ""
+	if len(whereConditions) > 0 {
+		where = " WHERE " + strings.Join(whereConditions, " AND ")
+	}
+
+	var entries []*models.AuditEntry
+	var total int
+	err = r.read(ctx, "list_audit", func(q querier) (err error) {
+		entries, total, err = listAudit(ctx, q, where, args, paramCounter, filter)
+		return err
+	})
+	return entries, total, err
+}
+
+// listAudit runs the queries of ListAudit on q for the conditions in where,
+// whose arguments are args; the page bounds are bound from paramCounter on
+func listAudit(ctx context.Context, q querier, where string, args []interface{}, paramCounter int, filter *models.ListAuditRequest) ([]*models.AuditEntry, int, error) {
+	var total int
+	if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s FROM audit_log%s ORDER BY id DESC LIMIT $%d OFFSET $%d",
+		auditColumns, where, paramCounter, paramCounter+1,
+	)
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*models.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+// insertAuditEntry records a subscription change inside the transaction that made it
+func insertAuditEntry(ctx context.Context, tx *sql.Tx, action string, info models.AuditInfo, before, after *models.Subscription) error {
+	id := 0
+	if after != nil {
+		id = after.ID
+	} else if before != nil {
+		id = before.ID
+	}
+
+	entry, err := models.NewSubscriptionAuditEntry(action, info, id, before, after)
+	if err != nil {
+		return fmt.Errorf("failed to build audit entry: %w", err)
+	}
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit changes: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO audit_log (actor, request_id, entity_type, entity_id, action, before, after, changes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		entry.Actor, nullString(entry.RequestID), entry.EntityType, entry.EntityID, entry.Action,
+		nullJSON(entry.Before), nullJSON(entry.After), string(changes),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// scanAuditEntry scans a row selected with auditColumns
+func scanAuditEntry(row rowScanner) (*models.AuditEntry, error) {
+	var entry models.AuditEntry
+	var requestID sql.NullString
+	var before, after, changes []byte
+
+	err := row.Scan(
+		&entry.ID,
+		&entry.Actor,
+		&requestID,
+		&entry.EntityType,
+		&entry.EntityID,
+		&entry.Action,
+		&before,
+		&after,
+		&changes,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.RequestID = requestID.String
+	entry.Before = before
+	entry.After = after
+	if len(changes) > 0 {
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, err
+		}
+	}
+
+	return &entry, nil
+}
+
+// nullString maps an empty string to SQL NULL
+func nullString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// nullJSON maps an empty JSON document to SQL NULL; lib/pq would send []byte as bytea
+func nullJSON(value json.RawMessage) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	return string(value)
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"subscription-service/db"
+	"subscription-service/models"
+)
+
+// BudgetStore keeps the monthly budgets of users and the alerts sent for them.
+// Both SubscriptionRepository and MockSubscriptionRepository implement it.
+type BudgetStore interface {
+	// CreateBudget adds a budget; a service the catalog does not have is ErrServiceNotFound
+	CreateBudget(ctx context.Context, req *models.CreateBudgetRequest) (*models.Budget, error)
+	GetBudget(ctx context.Context, id int) (*models.Budget, error)
+	ListBudgets(ctx context.Context, filter *models.ListBudgetsRequest) ([]*models.Budget, error)
+	// UpdateBudget replaces a budget and forgets the alerts sent for it, so
+	// that the new amount and thresholds alert afresh
+	UpdateBudget(ctx context.Context, id int, req *models.UpdateBudgetRequest) (*models.Budget, error)
+	DeleteBudget(ctx context.Context, id int) error
+
+	// ClaimBudgetAlert records that the alert for a threshold of a budget in a
+	// month is being sent. It reports false if it was claimed before, so that
+	// every alert is sent once across replicas.
+	ClaimBudgetAlert(ctx context.Context, budgetID int, month string, threshold int) (bool, error)
+	// ReleaseBudgetAlert forgets a claimed alert that could not be sent, so
+	// that a later evaluation sends it again
+	ReleaseBudgetAlert(ctx context.Context, budgetID int, month string, threshold int) error
+}
+
+var (
+	_ BudgetStore = (*SubscriptionRepository)(nil)
+	_ BudgetStore = (*MockSubscriptionRepository)(nil)
+)
+
+// budgetColumns is the column list understood by scanBudget
+const budgetColumns = `id, user_id, scope, category, service_id, amount, thresholds, channel, target, created_at, updated_at`
+
+// CreateBudget adds a monthly budget for a user
+func (r *SubscriptionRepository) CreateBudget(ctx context.Context, req *models.CreateBudgetRequest) (_ *models.Budget, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	budget, err := scanBudget(r.conn().QueryRowContext(ctx,
+		`INSERT INTO budgets (user_id, scope, category, service_id, amount, thresholds, channel, target)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+budgetColumns,
+		req.UserID, req.Scope, req.Category, req.ServiceID, req.Amount, int64Array(req.Thresholds),
+		req.Channel, nullString(req.Target),
+	))
+	if err != nil {
+		if hasSQLState(err, foreignKeyViolation) {
+			return nil, ErrServiceNotFound
+		}
+		return nil, fmt.Errorf("failed to create budget: %w", err)
+	}
+
+	return budget, nil
+}
+
+// GetBudget gets a budget by ID
+func (r *SubscriptionRepository) GetBudget(ctx context.Context, id int) (_ *models.Budget, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	var budget *models.Budget
+	err = r.read(ctx, "get_budget", func(q querier) error {
+		var err error
+		budget, err = scanBudget(q.QueryRowContext(ctx, `SELECT `+budgetColumns+` FROM budgets WHERE id = $1`, id))
+		return err
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get budget: %w", err)
+	}
+
+	return budget, nil
+}
+
+// ListBudgets lists budgets by ID, optionally of one user
+func (r *SubscriptionRepository) ListBudgets(ctx context.Context, filter *models.ListBudgetsRequest) (_ []*models.Budget, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	query := `SELECT ` + budgetColumns + ` FROM budgets`
+	args := []interface{}{}
+	if filter.UserID != nil {
+		query += " WHERE user_id = $1"
+		args = append(args, *filter.UserID)
+	}
+	query += " ORDER BY id"
+
+	var budgets []*models.Budget
+	err = r.read(ctx, "list_budgets", func(q querier) error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to list budgets: %w", err)
+		}
+		defer rows.Close()
+
+		budgets = []*models.Budget{}
+		for rows.Next() {
+			budget, err := scanBudget(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan budget: %w", err)
+			}
+			budgets = append(budgets, budget)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to list budgets: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return budgets, nil
+}
+
+// UpdateBudget replaces a budget and forgets the alerts sent for it
+func (r *SubscriptionRepository) UpdateBudget(ctx context.Context, id int, req *models.UpdateBudgetRequest) (_ *models.Budget, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	var budget *models.Budget
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		budget, err = scanBudget(tx.QueryRowContext(ctx,
+			`UPDATE budgets
+			SET scope = $2, category = $3, service_id = $4, amount = $5, thresholds = $6,
+				channel = $7, target = $8, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING `+budgetColumns,
+			id, req.Scope, req.Category, req.ServiceID, req.Amount, int64Array(req.Thresholds),
+			req.Channel, nullString(req.Target),
+		))
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if hasSQLState(err, foreignKeyViolation) {
+			return ErrServiceNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update budget: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM budget_alerts WHERE budget_id = $1`, id); err != nil {
+			return fmt.Errorf("failed to reset budget alerts: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return budget, nil
+}
+
+// DeleteBudget deletes a budget together with its alerts
+func (r *SubscriptionRepository) DeleteBudget(ctx context.Context, id int) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	result, err := r.conn().ExecContext(ctx, `DELETE FROM budgets WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete budget: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ClaimBudgetAlert records an alert unless it was recorded before
+func (r *SubscriptionRepository) ClaimBudgetAlert(ctx context.Context, budgetID int, month string, threshold int) (_ bool, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	result, err := r.conn().ExecContext(ctx,
+		`INSERT INTO budget_alerts (budget_id, month, threshold) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		budgetID, month, threshold,
+	)
+	if err != nil {
+		if hasSQLState(err, foreignKeyViolation) {
+			return false, ErrNotFound
+		}
+		return false, fmt.Errorf("failed to claim budget alert: %w", err)
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return claimed == 1, nil
+}
+
+// ReleaseBudgetAlert forgets a claimed alert
+func (r *SubscriptionRepository) ReleaseBudgetAlert(ctx context.Context, budgetID int, month string, threshold int) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	_, err = r.conn().ExecContext(ctx,
+		`DELETE FROM budget_alerts WHERE budget_id = $1 AND month = $2 AND threshold = $3`,
+		budgetID, month, threshold,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release budget alert: %w", err)
+	}
+
+	return nil
+}
+
+// scanBudget scans a row selected with budgetColumns
+func scanBudget(row rowScanner) (*models.Budget, error) {
+	var budget models.Budget
+	var category, target sql.NullString
+	var serviceID sql.NullInt64
+	var thresholds pq.Int64Array
+
+	err := row.Scan(
+		&budget.ID,
+		&budget.UserID,
+		&budget.Scope,
+		&category,
+		&serviceID,
+		&budget.Amount,
+		&thresholds,
+		&budget.Channel,
+		&target,
+		&budget.CreatedAt,
+		&budget.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if category.Valid {
+		budget.Category = &category.String
+	}
+	if serviceID.Valid {
+		id := int(serviceID.Int64)
+		budget.ServiceID = &id
+	}
+	budget.Thresholds = intSlice(thresholds)
+	budget.Target = target.String
+
+	return &budget, nil
+}
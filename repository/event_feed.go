@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subscription-service/backoff"
+	"subscription-service/models"
+)
+
+// outboxChannel is the NOTIFY channel every committed outbox event is announced on
+const outboxChannel = "outbox_events"
+
+// maxCatchUpEvents bounds how many events are read back after the listener reconnects
+const maxCatchUpEvents = 1000
+
+const (
+	// initialListenBackoff is the delay before the listener retries a failed
+	// query; it doubles per attempt
+	initialListenBackoff = time.Second
+	// maxListenBackoff caps the delay between the listener's retries
+	maxListenBackoff = time.Minute
+)
+
+// EventFeed streams outbox events to every replica as they are committed.
+// Both SubscriptionRepository and MockSubscriptionRepository implement it.
+type EventFeed interface {
+	// Listen calls handle with every event committed from now on until ctx is
+	// done. An event may be passed more than once. Failures to reach the
+	// database are retried, so it only returns once ctx is done.
+	Listen(ctx context.Context, handle func(*models.OutboxEvent)) error
+}
+
+var (
+	_ EventFeed = (*SubscriptionRepository)(nil)
+	_ EventFeed = (*MockSubscriptionRepository)(nil)
+)
+
+// outboxNotification is the NOTIFY payload of an outbox event
+type outboxNotification struct {
+	ID            int64           `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	EventID       uuid.UUID       `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// notifyOutboxEvent announces an event; Postgres delivers the notification on commit only
+func notifyOutboxEvent(ctx context.Context, tx *sql.Tx, event *models.OutboxEvent) error {
+	payload, err := json.Marshal(outboxNotification{
+		ID:            event.ID,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		EventID:       event.EventID,
+		EventType:     event.EventType,
+		Payload:       event.Payload,
+		CreatedAt:     event.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox notification: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", outboxChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to notify outbox event: %w", err)
+	}
+
+	return nil
+}
+
+// Listen receives outbox notifications with LISTEN and, after the connection
+// was lost, reads back the events committed in the meantime. Failed queries are
+// logged and retried with backoff until ctx is done.
+func (r *SubscriptionRepository) Listen(ctx context.Context, handle func(*models.OutboxEvent)) error {
+	var lastID int64
+	for attempt := 1; ; attempt++ {
+		err := r.db.DB.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM outbox").Scan(&lastID)
+		if err == nil {
+			break
+		}
+		if !r.waitToRetryListen(ctx, attempt, fmt.Errorf("failed to read latest outbox event: %w", err)) {
+			return nil
+		}
+	}
+
+	listener := r.db.NewListener()
+	defer listener.Close()
+
+	for attempt := 1; ; attempt++ {
+		err := listener.Listen(outboxChannel)
+		if err == nil {
+			break
+		}
+		if !r.waitToRetryListen(ctx, attempt, fmt.Errorf("failed to listen for outbox events: %w", err)) {
+			return nil
+		}
+	}
+
+	// Set while events committed after lastID may have been missed
+	catchUp, attempt := false, 1
+	for {
+		if catchUp {
+			events, err := r.outboxEventsAfter(ctx, lastID)
+			if err != nil {
+				if !r.waitToRetryListen(ctx, attempt, err) {
+					return nil
+				}
+				attempt++
+				continue
+			}
+			attempt, catchUp = 1, false
+
+			for _, event := range events {
+				lastID = event.ID
+				handle(event)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.Notify:
+			// A nil notification means the connection was re-established
+			if notification == nil {
+				catchUp = true
+				continue
+			}
+
+			var decoded outboxNotification
+			if err := json.Unmarshal([]byte(notification.Extra), &decoded); err != nil {
+				continue
+			}
+			if decoded.ID > lastID {
+				lastID = decoded.ID
+			}
+
+			handle(&models.OutboxEvent{
+				ID:            decoded.ID,
+				AggregateType: decoded.AggregateType,
+				AggregateID:   decoded.AggregateID,
+				EventID:       decoded.EventID,
+				EventType:     decoded.EventType,
+				Payload:       decoded.Payload,
+				CreatedAt:     decoded.CreatedAt,
+			})
+		case <-time.After(90 * time.Second):
+			// Detects a dead connection the server would not tell us about
+			go listener.Ping()
+		}
+	}
+}
+
+// waitToRetryListen logs a failure of the listener and waits before its next
+// attempt; it reports false if ctx is done first
+func (r *SubscriptionRepository) waitToRetryListen(ctx context.Context, attempt int, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	delay := backoff.Exponential(attempt, initialListenBackoff, maxListenBackoff)
+	r.db.Logger().Warnf("Outbox listener failed (attempt %d), retrying in %s: %v", attempt, delay, err)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// outboxEventsAfter returns the events with an ID above id, oldest first
+func (r *SubscriptionRepository) outboxEventsAfter(ctx context.Context, id int64) ([]*models.OutboxEvent, error) {
+	rows, err := r.db.DB.QueryContext(ctx,
+		`SELECT `+outboxColumns+` FROM outbox WHERE id > $1 ORDER BY id LIMIT $2`,
+		id, maxCatchUpEvents,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read missed outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.OutboxEvent{}
+	for rows.Next() {
+		event, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read missed outbox events: %w", err)
+	}
+
+	return events, nil
+}
+
+// Listen calls handle with every event recorded from now on until ctx is done
+func (r *MockSubscriptionRepository) Listen(ctx context.Context, handle func(*models.OutboxEvent)) error {
+	r.mutex.Lock()
+	r.nextListenerID++
+	id := r.nextListenerID
+	r.listeners[id] = handle
+	r.mutex.Unlock()
+
+	<-ctx.Done()
+
+	r.mutex.Lock()
+	delete(r.listeners, id)
+	r.mutex.Unlock()
+
+	return nil
+}
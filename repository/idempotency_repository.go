@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"subscription-service/db"
+	"subscription-service/models"
+)
+
+// abandonedReservationAge is how long a request may stay in progress before its
+// key can be claimed again, e.g. after the process handling it crashed
+const abandonedReservationAge = time.Minute
+
+// ErrReservationLost is returned when a request stores its response after its
+// reservation was abandoned and the key reserved again by another request
+var ErrReservationLost = errors.New("idempotency key was reserved again by another request")
+
+// IdempotencyStore keeps track of requests made with an Idempotency-Key.
+// Both IdempotencyRepository and MockIdempotencyRepository implement it.
+type IdempotencyStore interface {
+	// Reserve claims key for a new request and returns the reservation, whose
+	// CreatedAt identifies it to Complete and Release. If the key is already
+	// taken and has neither expired nor been abandoned, it returns the existing
+	// record and reserved is false.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (record *models.IdempotencyRecord, reserved bool, err error)
+	// Complete stores the response of a reserved request so it can be replayed.
+	// It returns ErrReservationLost if the key has been reserved again since.
+	Complete(ctx context.Context, key string, reservedAt time.Time, statusCode int, header http.Header, body []byte) error
+	// Release drops a reservation so that the request can be retried; a
+	// reservation the key no longer holds is left alone
+	Release(ctx context.Context, key string, reservedAt time.Time) error
+	// PurgeExpired removes keys whose TTL has passed
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+var (
+	_ IdempotencyStore = (*IdempotencyRepository)(nil)
+	_ IdempotencyStore = (*MockIdempotencyRepository)(nil)
+)
+
+// IdempotencyRepository handles database operations for idempotency keys
+type IdempotencyRepository struct {
+	db *db.PostgresDB
+}
+
+// NewIdempotencyRepository creates a new idempotency key repository
+func NewIdempotencyRepository(db *db.PostgresDB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// Reserve claims a key. The primary key makes concurrent reservations of the same
+// key race safely: exactly one INSERT wins, the others read the winner's record.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (_ *models.IdempotencyRecord, _ bool, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	// The winner may release its reservation between our INSERT and SELECT; try again then
+	for attempt := 0; attempt < 3; attempt++ {
+		record, reserved, err := r.reserve(ctx, key, fingerprint, ttl)
+		if err != sql.ErrNoRows {
+			return record, reserved, err
+		}
+	}
+
+	return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", sql.ErrNoRows)
+}
+
+// reserve makes a single reservation attempt; it returns sql.ErrNoRows if the
+// conflicting record disappeared before it could be read
+func (r *IdempotencyRepository) reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*models.IdempotencyRecord, bool, error) {
+	reservation := models.IdempotencyRecord{Key: key, Fingerprint: fingerprint}
+	err := r.db.DB.QueryRowContext(ctx,
+		`INSERT INTO idempotency_keys (key, fingerprint, expires_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + $3 * INTERVAL '1 second')
+		ON CONFLICT (key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint, expires_at = EXCLUDED.expires_at,
+				status_code = NULL, response_headers = NULL, response_body = NULL,
+				created_at = CURRENT_TIMESTAMP
+			WHERE idempotency_keys.expires_at < CURRENT_TIMESTAMP
+				OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < CURRENT_TIMESTAMP - $4 * INTERVAL '1 second')
+		RETURNING created_at, expires_at`,
+		key, fingerprint, int64(ttl/time.Second), int64(abandonedReservationAge/time.Second),
+	).Scan(&reservation.CreatedAt, &reservation.ExpiresAt)
+	if err == nil {
+		return &reservation, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	var record models.IdempotencyRecord
+	var statusCode sql.NullInt64
+	var header []byte
+
+	err = r.db.DB.QueryRowContext(ctx,
+		`SELECT key, fingerprint, status_code, response_headers, response_body, created_at, expires_at
+		FROM idempotency_keys WHERE key = $1`,
+		key,
+	).Scan(
+		&record.Key,
+		&record.Fingerprint,
+		&statusCode,
+		&header,
+		&record.Body,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, false, err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	if statusCode.Valid {
+		record.Completed = true
+		record.StatusCode = int(statusCode.Int64)
+	}
+	if len(header) > 0 {
+		if err := json.Unmarshal(header, &record.Header); err != nil {
+			return nil, false, fmt.Errorf("failed to decode stored headers: %w", err)
+		}
+	}
+
+	return &record, false, nil
+}
+
+// Complete stores the response of a reserved request unless the key has been
+// reserved again since
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, reservedAt time.Time, statusCode int, header http.Header, body []byte) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("failed to encode headers: %w", err)
+	}
+
+	result, err := r.db.DB.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status_code = $1, response_headers = $2, response_body = $3
+		WHERE key = $4 AND created_at = $5 AND status_code IS NULL`,
+		statusCode, string(encodedHeader), body, key, reservedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+
+	stored, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if stored == 0 {
+		return ErrReservationLost
+	}
+
+	return nil
+}
+
+// Release drops an unfinished reservation if the key still holds it
+func (r *IdempotencyRepository) Release(ctx context.Context, key string, reservedAt time.Time) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	_, err = r.db.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = $1 AND created_at = $2 AND status_code IS NULL", key, reservedAt)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeExpired removes keys whose TTL has passed
+func (r *IdempotencyRepository) PurgeExpired(ctx context.Context) (_ int64, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Batch)
+	defer func() { err = done(err) }()
+
+	result, err := r.db.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return purged, nil
+}
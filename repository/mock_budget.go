@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"subscription-service/models"
+)
+
+// budgetAlertKey identifies an alert of the mock repository
+type budgetAlertKey struct {
+	budgetID  int
+	month     string
+	threshold int
+}
+
+// CreateBudget adds a monthly budget for a user
+func (r *MockSubscriptionRepository) CreateBudget(ctx context.Context, req *models.CreateBudgetRequest) (*models.Budget, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if req.ServiceID != nil {
+		if _, ok := r.services[*req.ServiceID]; !ok {
+			return nil, ErrServiceNotFound
+		}
+	}
+
+	r.nextBudgetID++
+	now := time.Now()
+	budget := models.Budget{ID: r.nextBudgetID, UserID: req.UserID, CreatedAt: now}
+	setBudget(&budget, &req.UpdateBudgetRequest, now)
+	r.budgets[budget.ID] = budget
+
+	return copyBudget(budget), nil
+}
+
+// GetBudget gets a budget by ID
+func (r *MockSubscriptionRepository) GetBudget(ctx context.Context, id int) (*models.Budget, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	budget, ok := r.budgets[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyBudget(budget), nil
+}
+
+// ListBudgets lists budgets by ID, optionally of one user
+func (r *MockSubscriptionRepository) ListBudgets(ctx context.Context, filter *models.ListBudgetsRequest) ([]*models.Budget, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	budgets := []*models.Budget{}
+	for _, budget := range r.budgets {
+		if filter.UserID != nil && budget.UserID != *filter.UserID {
+			continue
+		}
+		budgets = append(budgets, copyBudget(budget))
+	}
+	slices.SortFunc(budgets, func(a, b *models.Budget) int { return a.ID - b.ID })
+
+	return budgets, nil
+}
+
+// UpdateBudget replaces a budget and forgets the alerts sent for it
+func (r *MockSubscriptionRepository) UpdateBudget(ctx context.Context, id int, req *models.UpdateBudgetRequest) (*models.Budget, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	budget, ok := r.budgets[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if req.ServiceID != nil {
+		if _, ok := r.services[*req.ServiceID]; !ok {
+			return nil, ErrServiceNotFound
+		}
+	}
+
+	setBudget(&budget, req, time.Now())
+	r.budgets[id] = budget
+	r.forgetBudgetAlerts(id)
+
+	return copyBudget(budget), nil
+}
+
+// DeleteBudget deletes a budget together with its alerts
+func (r *MockSubscriptionRepository) DeleteBudget(ctx context.Context, id int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.budgets[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.budgets, id)
+	r.forgetBudgetAlerts(id)
+
+	return nil
+}
+
+// ClaimBudgetAlert records an alert unless it was recorded before
+func (r *MockSubscriptionRepository) ClaimBudgetAlert(ctx context.Context, budgetID int, month string, threshold int) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.budgets[budgetID]; !ok {
+		return false, ErrNotFound
+	}
+
+	key := budgetAlertKey{budgetID: budgetID, month: month, threshold: threshold}
+	if _, claimed := r.budgetAlerts[key]; claimed {
+		return false, nil
+	}
+	r.budgetAlerts[key] = time.Now()
+
+	return true, nil
+}
+
+// ReleaseBudgetAlert forgets a claimed alert
+func (r *MockSubscriptionRepository) ReleaseBudgetAlert(ctx context.Context, budgetID int, month string, threshold int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.budgetAlerts, budgetAlertKey{budgetID: budgetID, month: month, threshold: threshold})
+	return nil
+}
+
+// forgetBudgetAlerts deletes the alerts of a budget; the caller must hold the mutex
+func (r *MockSubscriptionRepository) forgetBudgetAlerts(budgetID int) {
+	for key := range r.budgetAlerts {
+		if key.budgetID == budgetID {
+			delete(r.budgetAlerts, key)
+		}
+	}
+}
+
+// setBudget copies the fields of a request into a budget
+func setBudget(budget *models.Budget, req *models.UpdateBudgetRequest, now time.Time) {
+	budget.Scope = req.Scope
+	budget.Category = req.Category
+	budget.ServiceID = req.ServiceID
+	budget.Amount = req.Amount
+	budget.Thresholds = slices.Clone(req.Thresholds)
+	if budget.Thresholds == nil {
+		budget.Thresholds = []int{}
+	}
+	budget.Channel = req.Channel
+	budget.Target = req.Target
+	budget.UpdatedAt = now
+}
+
+// copyBudget copies a stored budget so callers cannot change it
+func copyBudget(budget models.Budget) *models.Budget {
+	budget.Thresholds = slices.Clone(budget.Thresholds)
+	if budget.Category != nil {
+		category := *budget.Category
+		budget.Category = &category
+	}
+	if budget.ServiceID != nil {
+		id := *budget.ServiceID
+		budget.ServiceID = &id
+	}
+	return &budget
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"subscription-service/models"
+)
+
+// MockIdempotencyRepository is an in-memory implementation of IdempotencyStore for testing
+type MockIdempotencyRepository struct {
+	records map[string]*models.IdempotencyRecord
+	mutex   sync.Mutex
+}
+
+// NewMockIdempotencyRepository creates a new instance of MockIdempotencyRepository
+func NewMockIdempotencyRepository() *MockIdempotencyRepository {
+	return &MockIdempotencyRepository{
+		records: make(map[string]*models.IdempotencyRecord),
+	}
+}
+
+// Reserve claims a key unless a live record already holds it
+func (r *MockIdempotencyRepository) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*models.IdempotencyRecord, bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	if existing, ok := r.records[key]; ok && existing.ExpiresAt.After(now) {
+		abandoned := !existing.Completed && existing.CreatedAt.Before(now.Add(-abandonedReservationAge))
+		if !abandoned {
+			record := *existing
+			return &record, false, nil
+		}
+	}
+
+	reservation := &models.IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	r.records[key] = reservation
+
+	record := *reservation
+	return &record, true, nil
+}
+
+// Complete stores the response of a reserved request unless the key has been
+// reserved again since
+func (r *MockIdempotencyRepository) Complete(ctx context.Context, key string, reservedAt time.Time, statusCode int, header http.Header, body []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	record, ok := r.records[key]
+	if !ok || record.Completed || !record.CreatedAt.Equal(reservedAt) {
+		return ErrReservationLost
+	}
+
+	record.Completed = true
+	record.StatusCode = statusCode
+	record.Header = header.Clone()
+	record.Body = append([]byte(nil), body...)
+
+	return nil
+}
+
+// Release drops an unfinished reservation if the key still holds it
+func (r *MockIdempotencyRepository) Release(ctx context.Context, key string, reservedAt time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if record, ok := r.records[key]; ok && !record.Completed && record.CreatedAt.Equal(reservedAt) {
+		delete(r.records, key)
+	}
+
+	return nil
+}
+
+// PurgeExpired removes keys whose TTL has passed
+func (r *MockIdempotencyRepository) PurgeExpired(ctx context.Context) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+
+	var purged int64
+	for key, record := range r.records {
+		if record.ExpiresAt.Before(now) {
+			delete(r.records, key)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
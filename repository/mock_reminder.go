@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subscription-service/models"
+)
+
+// GetReminderPreferences gets the reminder preferences of a user
+func (r *MockSubscriptionRepository) GetReminderPreferences(ctx context.Context, userID uuid.UUID) (*models.ReminderPreferences, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	preferences, ok := r.preferences[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &preferences, nil
+}
+
+// SaveReminderPreferences creates or replaces the reminder preferences of a user
+// and brings the pending jobs in line like SubscriptionRepository.SaveReminderPreferences
+func (r *MockSubscriptionRepository) SaveReminderPreferences(ctx context.Context, preferences *models.ReminderPreferences) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	preferences.UpdatedAt = time.Now()
+	r.preferences[preferences.UserID] = *preferences
+
+	for _, job := range r.reminders {
+		if job.UserID != preferences.UserID || job.Status != models.ReminderStatusPending {
+			continue
+		}
+		if !models.ReminderMatchesPreferences(job, preferences) {
+			job.Status = models.ReminderStatusCancelled
+			continue
+		}
+		job.Channel = preferences.Channel
+		job.Target = preferences.Target
+	}
+
+	return nil
+}
+
+// ListReminderTargets returns the live subscriptions whose reminder window is
+// open at now with their owners' preferences
+func (r *MockSubscriptionRepository) ListReminderTargets(ctx context.Context, now time.Time, defaults *models.ReminderPreferences) ([]*models.ReminderTarget, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	targets := []*models.ReminderTarget{}
+	for _, subscription := range r.sortedSubscriptions() {
+		if subscription.DeletedAt != nil {
+			continue
+		}
+
+		target := &models.ReminderTarget{Subscription: subscription}
+		window := defaults
+		if preferences, ok := r.preferences[subscription.UserID]; ok {
+			target.Preferences = &preferences
+			window = &preferences
+		}
+		if models.ReminderWindowOpen(subscription, window, now) {
+			targets = append(targets, target)
+		}
+	}
+
+	return targets, nil
+}
+
+// CreateReminderJobs stores planned jobs, skipping those planned before
+func (r *MockSubscriptionRepository) CreateReminderJobs(ctx context.Context, jobs []*models.ReminderJob) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	created := 0
+	for _, job := range jobs {
+		if r.hasReminder(job) {
+			continue
+		}
+
+		stored := *job
+		stored.ID = int64(len(r.reminders) + 1)
+		stored.Status = models.ReminderStatusPending
+		stored.NextAttemptAt = job.SendAt
+		stored.CreatedAt = time.Now()
+		stored.Subscription = nil
+		r.reminders = append(r.reminders, &stored)
+		created++
+	}
+
+	return created, nil
+}
+
+// ClaimDueReminders returns due jobs with their subscriptions and postpones them by lease
+func (r *MockSubscriptionRepository) ClaimDueReminders(ctx context.Context, limit int, lease time.Duration) ([]*models.ReminderJob, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+
+	due := []*models.ReminderJob{}
+	for _, job := range r.reminders {
+		if len(due) == limit {
+			break
+		}
+		if job.Status != models.ReminderStatusPending || job.NextAttemptAt.After(now) {
+			continue
+		}
+
+		job.NextAttemptAt = now.Add(lease)
+
+		claimed := *job
+		if subscription, ok := r.subscriptions[job.SubscriptionID]; ok {
+			claimed.Subscription = &subscription
+		}
+		due = append(due, &claimed)
+	}
+
+	return due, nil
+}
+
+// CompleteReminder moves a job to its final sent or cancelled state
+func (r *MockSubscriptionRepository) CompleteReminder(ctx context.Context, id int64, status string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if job := r.reminder(id); job != nil {
+		job.Status = status
+		job.Attempts++
+		if status == models.ReminderStatusSent {
+			now := time.Now()
+			job.SentAt = &now
+		}
+	}
+
+	return nil
+}
+
+// RecordReminderFailure stores a failed attempt and schedules the next one
+func (r *MockSubscriptionRepository) RecordReminderFailure(ctx context.Context, id int64, message string, nextAttemptAt *time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if job := r.reminder(id); job != nil {
+		job.Attempts++
+		job.LastError = message
+		if nextAttemptAt == nil {
+			job.Status = models.ReminderStatusFailed
+		} else {
+			job.NextAttemptAt = *nextAttemptAt
+		}
+	}
+
+	return nil
+}
+
+// ListReminders returns the most recent reminder jobs of a user
+func (r *MockSubscriptionRepository) ListReminders(ctx context.Context, userID uuid.UUID, limit int) ([]*models.ReminderJob, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	jobs := []*models.ReminderJob{}
+	for _, job := range r.reminders {
+		if job.UserID == userID {
+			copied := *job
+			jobs = append(jobs, &copied)
+		}
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].SendAt.After(jobs[j].SendAt)
+	})
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+
+	return jobs, nil
+}
+
+// hasReminder reports whether a job was planned before; the caller must hold the lock
+func (r *MockSubscriptionRepository) hasReminder(job *models.ReminderJob) bool {
+	for _, existing := range r.reminders {
+		if existing.SubscriptionID == job.SubscriptionID && existing.Kind == job.Kind &&
+			existing.DueOn.Equal(job.DueOn) && existing.LeadDays == job.LeadDays {
+			return true
+		}
+	}
+	return false
+}
+
+// reminder finds a job by ID; the caller must hold the lock
+func (r *MockSubscriptionRepository) reminder(id int64) *models.ReminderJob {
+	for _, job := range r.reminders {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
@@ -1,190 +1,712 @@
 package repository
 
 import (
+	"cmp"
+	"context"
 	"errors"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
 	"subscription-service/models"
+	"subscription-service/search"
 )
 
 // MockSubscriptionRepository is a mock implementation of the SubscriptionRepository for testing
 type MockSubscriptionRepository struct {
-	subscriptions map[string]models.Subscription
-	mutex         sync.RWMutex
+	subscriptions  map[int]models.Subscription
+	nextID         int
+	audit          []*models.AuditEntry
+	outbox         []*models.OutboxEvent
+	nextEventID    int64
+	preferences    map[uuid.UUID]models.ReminderPreferences
+	reminders      []*models.ReminderJob
+	listeners      map[int]func(*models.OutboxEvent)
+	nextListenerID int
+	services       map[int]models.Service
+	serviceAliases map[string]int // Service IDs by ServiceKey of their names
+	nextServiceID  int
+	tags           map[int]models.Tag
+	nextTagID      int
+	taggings       map[int][]int // Sorted tag IDs by subscription ID
+	budgets        map[int]models.Budget
+	nextBudgetID   int
+	budgetAlerts   map[budgetAlertKey]time.Time
+	mutex          sync.RWMutex
 }
 
 // NewMockSubscriptionRepository creates a new instance of MockSubscriptionRepository
 func NewMockSubscriptionRepository() *MockSubscriptionRepository {
 	return &MockSubscriptionRepository{
-		subscriptions: make(map[string]models.Subscription),
+		subscriptions:  make(map[int]models.Subscription),
+		preferences:    make(map[uuid.UUID]models.ReminderPreferences),
+		listeners:      make(map[int]func(*models.OutboxEvent)),
+		services:       make(map[int]models.Service),
+		serviceAliases: make(map[string]int),
+		tags:           make(map[int]models.Tag),
+		taggings:       make(map[int][]int),
+		budgets:        make(map[int]models.Budget),
+		budgetAlerts:   make(map[budgetAlertKey]time.Time),
 	}
 }
 
 // Create adds a new subscription to the mock repository
-func (r *MockSubscriptionRepository) Create(request *models.CreateSubscriptionRequest) (models.Subscription, error) {
+func (r *MockSubscriptionRepository) Create(ctx context.Context, request *models.CreateSubscriptionRequest, audit models.AuditInfo) (int, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	service, err := r.resolveService(request.ServiceID, request.ServiceName)
+	if err != nil {
+		return 0, err
+	}
+
 	// Create a new subscription from the request
-	newID := len(r.subscriptions) + 1
+	r.nextID++
 	now := time.Now()
 
 	subscription := models.Subscription{
-		ID:          newID,
-		ServiceName: request.ServiceName,
+		ID:          r.nextID,
+		ServiceID:   service.ID,
+		ServiceName: service.Name,
 		Price:       request.Price,
 		UserID:      request.UserID,
 		StartDate:   request.StartDate,
 		EndDate:     request.EndDate,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Version:     1,
 	}
 
-	// Store the subscription using string key
-	r.subscriptions[strconv.Itoa(newID)] = subscription
+	if err := r.recordChange(models.AuditActionCreate, audit, nil, &subscription); err != nil {
+		return 0, err
+	}
+	r.subscriptions[subscription.ID] = subscription
 
-	return subscription, nil
+	return subscription.ID, nil
 }
 
 // GetByID retrieves a subscription by its ID
-func (r *MockSubscriptionRepository) GetByID(id int) (models.Subscription, error) {
+func (r *MockSubscriptionRepository) GetByID(ctx context.Context, id int) (*models.Subscription, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	subscription, exists := r.subscriptions[strconv.Itoa(id)]
-	if !exists {
-		return models.Subscription{}, errors.New("subscription not found")
+	subscription, exists := r.subscriptions[id]
+	if !exists || subscription.DeletedAt != nil {
+		return nil, ErrNotFound
 	}
 
-	return subscription, nil
+	return &subscription, nil
 }
 
-// List returns all subscriptions with optional filtering
-func (r *MockSubscriptionRepository) List(userID, serviceName string) ([]models.Subscription, error) {
+// List returns a page of live subscriptions matching the filter in the order
+// of SubscriptionRepository.List
+func (r *MockSubscriptionRepository) List(ctx context.Context, filter *models.ListSubscriptionsRequest) (*models.SubscriptionPage, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	var result []models.Subscription
+	cursor, err := filter.ParseCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []*models.Subscription{}
+	for _, sub := range r.list(filter.UserID, filter.ServiceName) {
+		if matchesListFilter(sub, filter) && r.hasAnyTag(sub.ID, filter.TagIDs) {
+			matched = append(matched, sub)
+		}
+	}
 
-	for _, sub := range r.subscriptions {
+	// compare orders a before b in the requested direction
+	compare := func(aValue string, aID int, bValue string, bID int) int {
+		c := compareSortValues(filter.Sort, aValue, bValue)
+		if c == 0 {
+			c = cmp.Compare(aID, bID)
+		}
+		if filter.Order == models.SortDescending {
+			c = -c
+		}
+		return c
+	}
+	slices.SortFunc(matched, func(a, b *models.Subscription) int {
+		return compare(a.SortValue(filter.Sort), a.ID, b.SortValue(filter.Sort), b.ID)
+	})
+
+	page := &models.SubscriptionPage{Items: []*models.Subscription{}}
+	if filter.IncludeTotal {
+		total := len(matched)
+		page.Total = &total
+	}
+
+	for _, sub := range matched {
+		if cursor != nil && compare(sub.SortValue(filter.Sort), sub.ID, cursor.Value, cursor.ID) <= 0 {
+			continue
+		}
+		if len(page.Items) == filter.Limit {
+			page.NextCursor = filter.NextCursor(page.Items[len(page.Items)-1])
+			break
+		}
+		page.Items = append(page.Items, sub)
+	}
+
+	return page, nil
+}
+
+// matchesListFilter applies the filters of a list request beyond user and service name
+func matchesListFilter(sub *models.Subscription, filter *models.ListSubscriptionsRequest) bool {
+	if filter.ServicePrefix != "" && !strings.HasPrefix(strings.ToLower(sub.ServiceName), strings.ToLower(filter.ServicePrefix)) {
+		return false
+	}
+	if filter.MinPrice != nil && sub.Price < *filter.MinPrice {
+		return false
+	}
+	if filter.MaxPrice != nil && sub.Price > *filter.MaxPrice {
+		return false
+	}
+	if filter.ActiveIn != "" {
+		month := models.MonthKey(filter.ActiveIn)
+		if models.MonthKey(sub.StartDate) > month || (sub.EndDate != nil && models.MonthKey(*sub.EndDate) < month) {
+			return false
+		}
+	}
+	if filter.HasEndDate != nil && (sub.EndDate != nil) != *filter.HasEndDate {
+		return false
+	}
+	return true
+}
+
+// matchesServiceFilter reports whether the subscription is to the service
+// serviceID, if given, and to a service of the category, if given; the caller
+// must hold the mutex
+func (r *MockSubscriptionRepository) matchesServiceFilter(sub *models.Subscription, serviceID *int, category string) bool {
+	if serviceID != nil && sub.ServiceID != *serviceID {
+		return false
+	}
+	if category != "" {
+		serviceCategory := r.services[sub.ServiceID].Category
+		return serviceCategory != nil && *serviceCategory == category
+	}
+	return true
+}
+
+// compareSortValues compares two SortValues of the sort key sortBy
+func compareSortValues(sortBy, a, b string) int {
+	if sortBy == models.SortByPrice {
+		aPrice, _ := strconv.Atoi(a)
+		bPrice, _ := strconv.Atoi(b)
+		return cmp.Compare(aPrice, bPrice)
+	}
+	return strings.Compare(a, b)
+}
+
+// list filters live subscriptions; the caller must hold the mutex
+func (r *MockSubscriptionRepository) list(userID *uuid.UUID, serviceName *string) []*models.Subscription {
+	result := []*models.Subscription{}
+
+	for _, sub := range r.sortedSubscriptions() {
+		if sub.DeletedAt != nil {
+			continue
+		}
 		// Apply filters if provided
-		if userID != "" {
-			uid, err := uuid.Parse(userID)
-			if err != nil {
-				continue
-			}
-			if sub.UserID != uid {
-				continue
-			}
+		if userID != nil && sub.UserID != *userID {
+			continue
 		}
-		if serviceName != "" && sub.ServiceName != serviceName {
+		if serviceName != nil && *serviceName != "" && r.serviceAliases[models.ServiceKey(*serviceName)] != sub.ServiceID {
 			continue
 		}
 
 		result = append(result, sub)
 	}
 
+	return result
+}
+
+// Search ranks the live subscriptions whose service name matches the query
+// like SubscriptionRepository.Search does
+func (r *MockSubscriptionRepository) Search(ctx context.Context, req *models.SearchSubscriptionsRequest) ([]*models.SubscriptionSearchResult, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	query := search.Normalize(req.Query)
+	results := []*models.SubscriptionSearchResult{}
+	for _, sub := range r.list(req.UserID, nil) {
+		score := search.Score(query, search.Normalize(sub.ServiceName))
+		if score == 0 {
+			continue
+		}
+		results = append(results, &models.SubscriptionSearchResult{
+			Subscription: *sub,
+			Score:        score,
+			Highlight:    search.Highlight(sub.ServiceName, req.Query),
+		})
+	}
+
+	// list returns the subscriptions by ID, which breaks ties
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > req.Limit {
+		results = results[:req.Limit]
+	}
+
+	return results, nil
+}
+
+// ListDeleted returns soft-deleted subscriptions, most recently deleted first
+func (r *MockSubscriptionRepository) ListDeleted(ctx context.Context, userID *uuid.UUID) ([]*models.Subscription, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := []*models.Subscription{}
+	for _, sub := range r.sortedSubscriptions() {
+		if sub.DeletedAt == nil {
+			continue
+		}
+		if userID != nil && sub.UserID != *userID {
+			continue
+		}
+		result = append(result, sub)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].DeletedAt.After(*result[j].DeletedAt)
+	})
+
 	return result, nil
 }
 
-// Update modifies an existing subscription
-func (r *MockSubscriptionRepository) Update(id string, subscription models.Subscription) (models.Subscription, error) {
+// Update replaces an existing subscription
+func (r *MockSubscriptionRepository) Update(ctx context.Context, id int, request *models.UpdateSubscriptionRequest, expectedVersion *int, audit models.AuditInfo) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	_, exists := r.subscriptions[id]
-	if !exists {
-		return models.Subscription{}, errors.New("subscription not found")
+	subscription, exists := r.subscriptions[id]
+	if !exists || subscription.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if expectedVersion != nil && subscription.Version != *expectedVersion {
+		return ErrVersionConflict
+	}
+	before := subscription
+
+	service, err := r.resolveService(request.ServiceID, request.ServiceName)
+	if err != nil {
+		return err
 	}
 
-	// Update the subscription
-	idInt, _ := strconv.Atoi(id)
-	subscription.ID = idInt
+	subscription.ServiceID = service.ID
+	subscription.ServiceName = service.Name
+	subscription.Price = request.Price
+	subscription.UserID = request.UserID
+	subscription.StartDate = request.StartDate
+	subscription.EndDate = request.EndDate
 	subscription.UpdatedAt = time.Now()
+	subscription.Version++
+
+	if err := r.recordChange(models.AuditActionUpdate, audit, &before, &subscription); err != nil {
+		return err
+	}
 	r.subscriptions[id] = subscription
 
-	return subscription, nil
+	return nil
 }
 
-// Delete removes a subscription by its ID
-func (r *MockSubscriptionRepository) Delete(id string) error {
+// Delete soft-deletes a subscription by its ID
+func (r *MockSubscriptionRepository) Delete(ctx context.Context, id int, audit models.AuditInfo) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	_, exists := r.subscriptions[id]
-	if !exists {
-		return errors.New("subscription not found")
+	subscription, exists := r.subscriptions[id]
+	if !exists || subscription.DeletedAt != nil {
+		return ErrNotFound
+	}
+	before := subscription
+
+	now := time.Now()
+	subscription.DeletedAt = &now
+	subscription.Version++
+
+	if err := r.recordChange(models.AuditActionDelete, audit, &before, &subscription); err != nil {
+		return err
 	}
+	r.subscriptions[id] = subscription
 
-	delete(r.subscriptions, id)
 	return nil
 }
 
-// CalculateTotalCost calculates the total cost of subscriptions for a given period and filters
-func (r *MockSubscriptionRepository) CalculateTotalCost(userID, serviceName, startPeriod, endPeriod string) (int, error) {
+// Restore brings back a soft-deleted subscription
+func (r *MockSubscriptionRepository) Restore(ctx context.Context, id int, audit models.AuditInfo) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	subscription, exists := r.subscriptions[id]
+	if !exists || subscription.DeletedAt == nil {
+		return ErrNotFound
+	}
+	before := subscription
+
+	subscription.DeletedAt = nil
+	subscription.UpdatedAt = time.Now()
+	subscription.Version++
+
+	if err := r.recordChange(models.AuditActionRestore, audit, &before, &subscription); err != nil {
+		return err
+	}
+	r.subscriptions[id] = subscription
+
+	return nil
+}
+
+// PurgeDeleted permanently removes subscriptions soft-deleted longer than retention ago
+func (r *MockSubscriptionRepository) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cutoff := time.Now().Add(-retention)
+
+	var purged int64
+	for id, sub := range r.subscriptions {
+		if sub.DeletedAt != nil && sub.DeletedAt.Before(cutoff) {
+			delete(r.subscriptions, id)
+			delete(r.taggings, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// CalculateTotalCost calculates the total cost of subscriptions for a given period and filters,
+// in all and per tag
+func (r *MockSubscriptionRepository) CalculateTotalCost(ctx context.Context, req *models.CalculateCostRequest) (*models.CalculateCostResponse, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
 	// Parse start and end periods
-	startDate, err := time.Parse("01-2006", startPeriod)
+	startDate, err := time.Parse("01-2006", req.StartPeriod)
 	if err != nil {
-		return 0, errors.New("invalid start period format")
+		return nil, errors.New("invalid start period format")
 	}
 
-	endDate, err := time.Parse("01-2006", endPeriod)
+	endDate, err := time.Parse("01-2006", req.EndPeriod)
 	if err != nil {
-		return 0, errors.New("invalid end period format")
+		return nil, errors.New("invalid end period format")
 	}
 
 	if startDate.After(endDate) {
-		return 0, errors.New("start period cannot be after end period")
+		return nil, errors.New("start period cannot be after end period")
 	}
 
 	// Get subscriptions that match the filters
-	subscriptions, err := r.List(userID, serviceName)
-	if err != nil {
-		return 0, err
-	}
+	subscriptions := r.list(req.UserID, req.ServiceName)
 
 	// Calculate total cost
 	totalCost := 0
+	tagCosts := map[int]int{}
 	for _, sub := range subscriptions {
-		// Parse subscription start date
-		subStartDate, err := time.Parse("01-2006", sub.StartDate)
-		if err != nil {
+		if !r.hasAnyTag(sub.ID, req.TagIDs) || !r.matchesServiceFilter(sub, req.ServiceID, req.Category) {
 			continue
 		}
 
-		// Skip if subscription starts after the end period
-		if subStartDate.After(endDate) {
+		cost := sub.CostIn(req.StartPeriod, req.EndPeriod)
+		if cost == 0 {
 			continue
 		}
 
-		// Adjust start date if subscription starts after the requested start period
-		effectiveStartDate := startDate
-		if subStartDate.After(startDate) {
-			effectiveStartDate = subStartDate
+		totalCost += cost
+		for _, tagID := range r.taggings[sub.ID] {
+			if len(req.TagIDs) == 0 || slices.Contains(req.TagIDs, tagID) {
+				tagCosts[tagID] += cost
+			}
 		}
+	}
 
-		// Calculate effective end date
-		effectiveEndDate := endDate
-		if sub.EndDate != nil {
-			subEndDate, err := time.Parse("01-2006", *sub.EndDate)
-			if err == nil && subEndDate.Before(endDate) {
-				effectiveEndDate = subEndDate
-			}
+	byTag := []models.TagCost{}
+	for tagID, cost := range tagCosts {
+		byTag = append(byTag, models.TagCost{TagID: tagID, Name: r.tags[tagID].Name, TotalCost: cost})
+	}
+	slices.SortFunc(byTag, func(a, b models.TagCost) int {
+		return cmp.Or(strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), cmp.Compare(a.TagID, b.TagID))
+	})
+
+	return &models.CalculateCostResponse{TotalCost: totalCost, ByTag: byTag}, nil
+}
+
+// ListAudit returns a page of audit entries matching the filter, newest first
+func (r *MockSubscriptionRepository) ListAudit(ctx context.Context, filter *models.ListAuditRequest) ([]*models.AuditEntry, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	matched := []*models.AuditEntry{}
+	for i := len(r.audit) - 1; i >= 0; i-- {
+		entry := r.audit[i]
+		if filter.Actor != "" && entry.Actor != filter.Actor {
+			continue
+		}
+		if filter.EntityID != nil && entry.EntityID != *filter.EntityID {
+			continue
+		}
+		if filter.Action != "" && entry.Action != filter.Action {
+			continue
+		}
+		if filter.From != nil && entry.CreatedAt.Before(*filter.From) {
+			continue
+		}
+		if filter.To != nil && entry.CreatedAt.After(*filter.To) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+
+	total := len(matched)
+	if filter.Offset >= total {
+		return []*models.AuditEntry{}, total, nil
+	}
+
+	end := filter.Offset + filter.Limit
+	if end > total {
+		end = total
+	}
+
+	return matched[filter.Offset:end], total, nil
+}
+
+// ClaimPendingEvents returns the oldest due unpublished event of each aggregate
+// and postpones them by lease
+func (r *MockSubscriptionRepository) ClaimPendingEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	blocked := map[string]bool{}
+
+	events := []*models.OutboxEvent{}
+	for _, event := range r.outbox {
+		if len(events) == limit {
+			break
+		}
+		if event.PublishedAt != nil {
+			continue
+		}
+
+		aggregate := event.AggregateType + "/" + event.AggregateID
+		if blocked[aggregate] {
+			continue
+		}
+		blocked[aggregate] = true
+
+		if event.NextAttemptAt.After(now) {
+			continue
+		}
+
+		event.NextAttemptAt = now.Add(lease)
+		copied := *event
+		events = append(events, &copied)
+	}
+
+	return events, nil
+}
+
+// CompleteEvents records the outcome of publishing claimed events
+func (r *MockSubscriptionRepository) CompleteEvents(ctx context.Context, events []*models.OutboxEvent) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	byID := map[int64]*models.OutboxEvent{}
+	for _, event := range r.outbox {
+		byID[event.ID] = event
+	}
+
+	for _, completed := range events {
+		event, ok := byID[completed.ID]
+		if !ok || event.PublishedAt != nil {
+			continue
+		}
+
+		switch {
+		case completed.PublishedAt != nil:
+			publishedAt := *completed.PublishedAt
+			event.PublishedAt = &publishedAt
+		case completed.LastError != "":
+			event.Attempts++
+			event.LastError = completed.LastError
+			event.NextAttemptAt = completed.NextAttemptAt
+		}
+	}
+
+	return nil
+}
+
+// PurgePublished removes events published longer than retention ago
+func (r *MockSubscriptionRepository) PurgePublished(ctx context.Context, retention time.Duration) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cutoff := time.Now().Add(-retention)
+
+	var purged int64
+	kept := r.outbox[:0]
+	for _, event := range r.outbox {
+		if event.PublishedAt != nil && event.PublishedAt.Before(cutoff) {
+			purged++
+			continue
 		}
+		kept = append(kept, event)
+	}
+	r.outbox = kept
+
+	return purged, nil
+}
+
+// WithTx runs fn against a copy of the repository and keeps the copy's state
+// only if fn succeeds. Units of work run one at a time and block all other
+// access meanwhile, which makes them serializable.
+func (r *MockSubscriptionRepository) WithTx(ctx context.Context, fn func(tx Repository) error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tx := r.clone()
+	if err := fn(tx); err != nil {
+		return err
+	}
 
-		// Calculate months for this subscription
-		subMonths := (effectiveEndDate.Year()-effectiveStartDate.Year())*12 + int(effectiveEndDate.Month()-effectiveStartDate.Month()) + 1
-		if subMonths > 0 {
-			totalCost += sub.Price * subMonths
+	// Listeners learn about the events of a unit of work once it is committed
+	for _, event := range tx.outbox {
+		if event.ID <= r.nextEventID {
+			continue
+		}
+		for _, listener := range r.listeners {
+			copied := *event
+			listener(&copied)
 		}
 	}
 
-	return totalCost, nil
+	r.subscriptions = tx.subscriptions
+	r.nextID = tx.nextID
+	r.audit = tx.audit
+	r.outbox = tx.outbox
+	r.nextEventID = tx.nextEventID
+	r.preferences = tx.preferences
+	r.reminders = tx.reminders
+	r.services = tx.services
+	r.serviceAliases = tx.serviceAliases
+	r.nextServiceID = tx.nextServiceID
+	r.tags = tx.tags
+	r.nextTagID = tx.nextTagID
+	r.taggings = tx.taggings
+	r.budgets = tx.budgets
+	r.nextBudgetID = tx.nextBudgetID
+	r.budgetAlerts = tx.budgetAlerts
+
+	return nil
+}
+
+// clone copies the stored state into a repository without listeners; the
+// caller must hold the mutex
+func (r *MockSubscriptionRepository) clone() *MockSubscriptionRepository {
+	clone := NewMockSubscriptionRepository()
+	clone.nextID = r.nextID
+	clone.nextEventID = r.nextEventID
+	clone.nextServiceID = r.nextServiceID
+	clone.nextTagID = r.nextTagID
+	clone.nextBudgetID = r.nextBudgetID
+	clone.audit = append([]*models.AuditEntry{}, r.audit...)
+
+	for id, subscription := range r.subscriptions {
+		clone.subscriptions[id] = subscription
+	}
+	for userID, preferences := range r.preferences {
+		clone.preferences[userID] = preferences
+	}
+	for id, service := range r.services {
+		clone.services[id] = service
+	}
+	for alias, id := range r.serviceAliases {
+		clone.serviceAliases[alias] = id
+	}
+	for id, tag := range r.tags {
+		clone.tags[id] = tag
+	}
+	for id, tagIDs := range r.taggings {
+		clone.taggings[id] = slices.Clone(tagIDs)
+	}
+	for id, budget := range r.budgets {
+		budget.Thresholds = slices.Clone(budget.Thresholds)
+		clone.budgets[id] = budget
+	}
+	for key, sentAt := range r.budgetAlerts {
+		clone.budgetAlerts[key] = sentAt
+	}
+	for _, event := range r.outbox {
+		copied := *event
+		clone.outbox = append(clone.outbox, &copied)
+	}
+	for _, job := range r.reminders {
+		copied := *job
+		clone.reminders = append(clone.reminders, &copied)
+	}
+
+	return clone
+}
+
+// recordChange appends the audit entry and outbox events of a change; the caller
+// must hold the write lock
+func (r *MockSubscriptionRepository) recordChange(action string, info models.AuditInfo, before, after *models.Subscription) error {
+	id := 0
+	if after != nil {
+		id = after.ID
+	} else if before != nil {
+		id = before.ID
+	}
+
+	entry, err := models.NewSubscriptionAuditEntry(action, info, id, before, after)
+	if err != nil {
+		return err
+	}
+
+	events, err := models.NewSubscriptionOutboxEvents(action, before, after)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	entry.ID = int64(len(r.audit) + 1)
+	entry.CreatedAt = now
+	r.audit = append(r.audit, entry)
+
+	for _, event := range events {
+		r.nextEventID++
+		event.ID = r.nextEventID
+		event.CreatedAt = now
+		event.NextAttemptAt = now
+		r.outbox = append(r.outbox, event)
+
+		for _, listener := range r.listeners {
+			copied := *event
+			listener(&copied)
+		}
+	}
+
+	return nil
+}
+
+// sortedSubscriptions returns copies of all stored subscriptions ordered by ID;
+// the caller must hold the mutex
+func (r *MockSubscriptionRepository) sortedSubscriptions() []*models.Subscription {
+	result := make([]*models.Subscription, 0, len(r.subscriptions))
+	for _, sub := range r.subscriptions {
+		sub := sub
+		result = append(result, &sub)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result
 }
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"subscription-service/models"
+)
+
+// CreateService adds a service to the catalog; its name resolves to it as well
+// as its aliases
+func (r *MockSubscriptionRepository) CreateService(ctx context.Context, req *models.CreateServiceRequest) (*models.Service, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	name := models.CleanServiceName(req.Name)
+	keys := []string{}
+	for _, alias := range append([]string{name}, req.Aliases...) {
+		key := models.ServiceKey(alias)
+		if _, taken := r.serviceAliases[key]; taken {
+			return nil, ErrServiceExists
+		}
+		keys = append(keys, key)
+	}
+	for _, service := range r.services {
+		if service.Name == name {
+			return nil, ErrServiceExists
+		}
+	}
+
+	r.nextServiceID++
+	r.services[r.nextServiceID] = models.Service{
+		ID:           r.nextServiceID,
+		Name:         name,
+		Category:     req.Category,
+		LogoURL:      req.LogoURL,
+		DefaultPrice: req.DefaultPrice,
+		CreatedAt:    time.Now(),
+	}
+	for _, key := range keys {
+		r.serviceAliases[key] = r.nextServiceID
+	}
+
+	return r.service(r.nextServiceID), nil
+}
+
+// GetService gets a service of the catalog by ID
+func (r *MockSubscriptionRepository) GetService(ctx context.Context, id int) (*models.Service, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if _, ok := r.services[id]; !ok {
+		return nil, ErrServiceNotFound
+	}
+	return r.service(id), nil
+}
+
+// ListServices lists the services of the catalog by name, optionally of one category
+func (r *MockSubscriptionRepository) ListServices(ctx context.Context, filter *models.ListServicesRequest) ([]*models.Service, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	services := []*models.Service{}
+	for id, service := range r.services {
+		if filter.Category != "" && (service.Category == nil || *service.Category != filter.Category) {
+			continue
+		}
+		services = append(services, r.service(id))
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+
+	return services, nil
+}
+
+// AddServiceAlias makes alias resolve to a service of the catalog
+func (r *MockSubscriptionRepository) AddServiceAlias(ctx context.Context, id int, alias string) (*models.Service, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.services[id]; !ok {
+		return nil, ErrServiceNotFound
+	}
+
+	key := models.ServiceKey(alias)
+	if owner, taken := r.serviceAliases[key]; taken && owner != id {
+		return nil, ErrServiceExists
+	}
+	r.serviceAliases[key] = id
+
+	return r.service(id), nil
+}
+
+// ResolveService finds the service of a subscription like SubscriptionRepository.ResolveService
+func (r *MockSubscriptionRepository) ResolveService(ctx context.Context, id *int, name string) (*models.Service, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.resolveService(id, name)
+}
+
+// resolveService finds or registers the service of a subscription; the caller
+// must hold the write lock
+func (r *MockSubscriptionRepository) resolveService(id *int, name string) (*models.Service, error) {
+	key := models.ServiceKey(name)
+
+	if id != nil {
+		if _, ok := r.services[*id]; !ok {
+			return nil, ErrServiceNotFound
+		}
+		if owner, known := r.serviceAliases[key]; key != "" && (!known || owner != *id) {
+			return nil, ErrServiceMismatch
+		}
+		return r.service(*id), nil
+	}
+
+	if owner, known := r.serviceAliases[key]; known {
+		return r.service(owner), nil
+	}
+
+	r.nextServiceID++
+	r.services[r.nextServiceID] = models.Service{
+		ID:        r.nextServiceID,
+		Name:      models.CleanServiceName(name),
+		CreatedAt: time.Now(),
+	}
+	r.serviceAliases[key] = r.nextServiceID
+
+	return r.service(r.nextServiceID), nil
+}
+
+// service returns a copy of a stored service with its aliases; the caller must
+// hold the mutex
+func (r *MockSubscriptionRepository) service(id int) *models.Service {
+	service := r.services[id]
+	service.Aliases = []string{}
+	for alias, owner := range r.serviceAliases {
+		if owner == id {
+			service.Aliases = append(service.Aliases, alias)
+		}
+	}
+	sort.Strings(service.Aliases)
+
+	return &service
+}
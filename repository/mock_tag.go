@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subscription-service/models"
+)
+
+// CreateTag adds a tag for a user
+func (r *MockSubscriptionRepository) CreateTag(ctx context.Context, req *models.CreateTagRequest) (*models.Tag, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	name := models.CleanTagName(req.Name)
+	if r.tagTaken(0, req.UserID, name) {
+		return nil, ErrTagExists
+	}
+
+	r.nextTagID++
+	tag := models.Tag{ID: r.nextTagID, UserID: req.UserID, Name: name, CreatedAt: time.Now()}
+	r.tags[tag.ID] = tag
+
+	return &tag, nil
+}
+
+// GetTag gets a tag by ID
+func (r *MockSubscriptionRepository) GetTag(ctx context.Context, id int) (*models.Tag, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	tag, ok := r.tags[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &tag, nil
+}
+
+// ListTags lists tags by name, optionally of one user
+func (r *MockSubscriptionRepository) ListTags(ctx context.Context, filter *models.ListTagsRequest) ([]*models.Tag, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	tags := []*models.Tag{}
+	for _, tag := range r.tags {
+		if filter.UserID != nil && tag.UserID != *filter.UserID {
+			continue
+		}
+		copied := tag
+		tags = append(tags, &copied)
+	}
+	sortTags(tags)
+
+	return tags, nil
+}
+
+// RenameTag renames a tag
+func (r *MockSubscriptionRepository) RenameTag(ctx context.Context, id int, name string) (*models.Tag, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tag, ok := r.tags[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	name = models.CleanTagName(name)
+	if r.tagTaken(id, tag.UserID, name) {
+		return nil, ErrTagExists
+	}
+
+	tag.Name = name
+	r.tags[id] = tag
+
+	return &tag, nil
+}
+
+// DeleteTag deletes a tag and removes it from its subscriptions
+func (r *MockSubscriptionRepository) DeleteTag(ctx context.Context, id int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.tags[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(r.tags, id)
+	for subscriptionID, tagIDs := range r.taggings {
+		r.taggings[subscriptionID] = slices.DeleteFunc(tagIDs, func(tagID int) bool { return tagID == id })
+	}
+
+	return nil
+}
+
+// ListSubscriptionTags lists the tags of a live subscription by name
+func (r *MockSubscriptionRepository) ListSubscriptionTags(ctx context.Context, subscriptionID int) ([]*models.Tag, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if _, err := r.liveSubscription(subscriptionID); err != nil {
+		return nil, err
+	}
+
+	tags := []*models.Tag{}
+	for _, tagID := range r.taggings[subscriptionID] {
+		tag := r.tags[tagID]
+		tags = append(tags, &tag)
+	}
+	sortTags(tags)
+
+	return tags, nil
+}
+
+// TagSubscription puts a live subscription under a tag of its user
+func (r *MockSubscriptionRepository) TagSubscription(ctx context.Context, subscriptionID, tagID int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	sub, err := r.liveSubscription(subscriptionID)
+	if err != nil {
+		return err
+	}
+
+	tag, ok := r.tags[tagID]
+	if !ok {
+		return ErrTagNotFound
+	}
+	if tag.UserID != sub.UserID {
+		return ErrTagUserMismatch
+	}
+
+	tagIDs := r.taggings[subscriptionID]
+	if i, found := slices.BinarySearch(tagIDs, tagID); !found {
+		r.taggings[subscriptionID] = slices.Insert(tagIDs, i, tagID)
+	}
+
+	return nil
+}
+
+// UntagSubscription removes a tag from a live subscription
+func (r *MockSubscriptionRepository) UntagSubscription(ctx context.Context, subscriptionID, tagID int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, err := r.liveSubscription(subscriptionID); err != nil {
+		return err
+	}
+	if _, ok := r.tags[tagID]; !ok {
+		return ErrTagNotFound
+	}
+
+	r.taggings[subscriptionID] = slices.DeleteFunc(r.taggings[subscriptionID], func(id int) bool { return id == tagID })
+
+	return nil
+}
+
+// liveSubscription returns a subscription that has not been deleted; the
+// caller must hold the mutex
+func (r *MockSubscriptionRepository) liveSubscription(id int) (*models.Subscription, error) {
+	sub, ok := r.subscriptions[id]
+	if !ok || sub.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return &sub, nil
+}
+
+// hasAnyTag reports whether a subscription has one of the tags, or whether
+// tagIDs is empty; the caller must hold the mutex
+func (r *MockSubscriptionRepository) hasAnyTag(subscriptionID int, tagIDs []int) bool {
+	if len(tagIDs) == 0 {
+		return true
+	}
+	for _, tagID := range r.taggings[subscriptionID] {
+		if slices.Contains(tagIDs, tagID) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagTaken reports whether the user has a tag other than id with the name,
+// regardless of case; the caller must hold the mutex
+func (r *MockSubscriptionRepository) tagTaken(id int, userID uuid.UUID, name string) bool {
+	for _, tag := range r.tags {
+		if tag.ID != id && tag.UserID == userID && strings.EqualFold(tag.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortTags orders tags by name regardless of case, then by ID, like the
+// queries of SubscriptionRepository
+func sortTags(tags []*models.Tag) {
+	slices.SortFunc(tags, func(a, b *models.Tag) int {
+		return cmp.Or(strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), cmp.Compare(a.ID, b.ID))
+	})
+}
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"subscription-service/models"
+)
+
+// MockWebhookRepository is an in-memory implementation of WebhookStore for testing
+type MockWebhookRepository struct {
+	endpoints      map[int]models.WebhookEndpoint
+	deliveries     map[int64]models.WebhookDelivery
+	nextEndpointID int
+	nextDeliveryID int64
+	mutex          sync.Mutex
+}
+
+// NewMockWebhookRepository creates a new instance of MockWebhookRepository
+func NewMockWebhookRepository() *MockWebhookRepository {
+	return &MockWebhookRepository{
+		endpoints:  make(map[int]models.WebhookEndpoint),
+		deliveries: make(map[int64]models.WebhookDelivery),
+	}
+}
+
+// CreateEndpoint registers a webhook endpoint and fills in its ID and creation time
+func (r *MockWebhookRepository) CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.nextEndpointID++
+	endpoint.ID = r.nextEndpointID
+	endpoint.CreatedAt = time.Now()
+
+	stored := *endpoint
+	stored.Events = append([]string{}, endpoint.Events...)
+	r.endpoints[endpoint.ID] = stored
+
+	return nil
+}
+
+// GetEndpoint gets a webhook endpoint by ID
+func (r *MockWebhookRepository) GetEndpoint(ctx context.Context, id int) (*models.WebhookEndpoint, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	endpoint, ok := r.endpoints[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &endpoint, nil
+}
+
+// ListEndpoints gets all webhook endpoints
+func (r *MockWebhookRepository) ListEndpoints(ctx context.Context) ([]*models.WebhookEndpoint, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	endpoints := []*models.WebhookEndpoint{}
+	for _, endpoint := range r.endpoints {
+		endpoint := endpoint
+		endpoints = append(endpoints, &endpoint)
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].ID < endpoints[j].ID
+	})
+
+	return endpoints, nil
+}
+
+// DeleteEndpoint removes a webhook endpoint together with its deliveries
+func (r *MockWebhookRepository) DeleteEndpoint(ctx context.Context, id int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.endpoints[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(r.endpoints, id)
+	for deliveryID, delivery := range r.deliveries {
+		if delivery.EndpointID == id {
+			delete(r.deliveries, deliveryID)
+		}
+	}
+
+	return nil
+}
+
+// EnqueueEvent creates a pending delivery of event for every subscribed endpoint
+func (r *MockWebhookRepository) EnqueueEvent(ctx context.Context, event *models.Event) (int, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+
+	delivered := map[int]bool{}
+	for _, delivery := range r.deliveries {
+		if delivery.EventID == event.ID {
+			delivered[delivery.EndpointID] = true
+		}
+	}
+
+	enqueued := 0
+	for _, endpoint := range r.endpoints {
+		if !endpoint.Accepts(event.Type) || delivered[endpoint.ID] {
+			continue
+		}
+
+		r.nextDeliveryID++
+		r.deliveries[r.nextDeliveryID] = models.WebhookDelivery{
+			ID:            r.nextDeliveryID,
+			EndpointID:    endpoint.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        models.DeliveryStatusPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		enqueued++
+	}
+
+	return enqueued, nil
+}
+
+// ClaimDueDeliveries returns due deliveries and postpones them by lease
+func (r *MockWebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	leasedUntil := now.Add(lease)
+
+	due := []*models.WebhookDelivery{}
+	for _, delivery := range r.sortedDeliveries() {
+		if len(due) == limit {
+			break
+		}
+		if delivery.Status != models.DeliveryStatusPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+
+		delivery.NextAttemptAt = &leasedUntil
+		r.deliveries[delivery.ID] = *delivery
+		due = append(due, delivery)
+	}
+
+	return due, nil
+}
+
+// RecordAttempt stores the outcome of a delivery attempt
+func (r *MockWebhookRepository) RecordAttempt(ctx context.Context, id int64, result models.DeliveryResult) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return nil
+	}
+
+	delivery.Attempts++
+	delivery.LastStatusCode = result.StatusCode
+	delivery.LastError = result.Error
+	delivery.UpdatedAt = time.Now()
+
+	switch {
+	case result.Succeeded:
+		delivery.Status = models.DeliveryStatusSucceeded
+		delivery.NextAttemptAt = nil
+	case result.NextAttemptAt == nil:
+		delivery.Status = models.DeliveryStatusDead
+		delivery.NextAttemptAt = nil
+	default:
+		delivery.NextAttemptAt = result.NextAttemptAt
+	}
+
+	r.deliveries[id] = delivery
+
+	return nil
+}
+
+// ListDeliveries returns a page of deliveries matching the filter, newest first
+func (r *MockWebhookRepository) ListDeliveries(ctx context.Context, filter *models.ListDeliveriesRequest) ([]*models.WebhookDelivery, int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	sorted := r.sortedDeliveries()
+
+	matched := []*models.WebhookDelivery{}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		delivery := sorted[i]
+		if filter.EndpointID != nil && delivery.EndpointID != *filter.EndpointID {
+			continue
+		}
+		if filter.Status != "" && delivery.Status != filter.Status {
+			continue
+		}
+		matched = append(matched, delivery)
+	}
+
+	total := len(matched)
+	if filter.Offset >= total {
+		return []*models.WebhookDelivery{}, total, nil
+	}
+
+	end := filter.Offset + filter.Limit
+	if end > total {
+		end = total
+	}
+
+	return matched[filter.Offset:end], total, nil
+}
+
+// Redeliver schedules a delivery for immediate sending with a fresh set of attempts
+func (r *MockWebhookRepository) Redeliver(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	now := time.Now()
+	delivery.Status = models.DeliveryStatusPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.UpdatedAt = now
+	r.deliveries[id] = delivery
+
+	return &delivery, nil
+}
+
+// sortedDeliveries returns copies of all deliveries ordered by ID; the caller must hold the lock
+func (r *MockWebhookRepository) sortedDeliveries() []*models.WebhookDelivery {
+	deliveries := make([]*models.WebhookDelivery, 0, len(r.deliveries))
+	for _, delivery := range r.deliveries {
+		delivery := delivery
+		deliveries = append(deliveries, &delivery)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ID < deliveries[j].ID
+	})
+
+	return deliveries
+}
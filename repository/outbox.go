@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"subscription-service/db"
+	"subscription-service/models"
+)
+
+// OutboxStore gives the outbox relay access to unpublished events.
+// Both SubscriptionRepository and MockSubscriptionRepository implement it.
+type OutboxStore interface {
+	// ClaimPendingEvents returns the oldest due unpublished event of up to limit
+	// aggregates and postpones them by lease, so that concurrent relays skip them.
+	// An unpublished event holds back the later events of its aggregate, which
+	// keeps every aggregate's events in order.
+	ClaimPendingEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error)
+	// CompleteEvents stores the outcome of publishing claimed events: those with
+	// PublishedAt set are marked published, those with LastError set record a
+	// failed attempt and wait until NextAttemptAt, and the rest stay claimed
+	// until their lease runs out
+	CompleteEvents(ctx context.Context, events []*models.OutboxEvent) error
+	// PurgePublished removes events published longer than retention ago
+	PurgePublished(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+var (
+	_ OutboxStore = (*SubscriptionRepository)(nil)
+	_ OutboxStore = (*MockSubscriptionRepository)(nil)
+)
+
+// outboxColumns is the column list understood by scanOutboxEvent
+const outboxColumns = `id, aggregate_type, aggregate_id, event_id, event_type, payload, attempts, created_at`
+
+// ClaimPendingEvents locks due events with SKIP LOCKED and postpones them by lease
+func (r *SubscriptionRepository) ClaimPendingEvents(ctx context.Context, limit int, lease time.Duration) (_ []*models.OutboxEvent, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Batch)
+	defer func() { err = done(err) }()
+
+	// Changes to one subscription lock its row, so its events are inserted and
+	// committed in ID order; only the oldest unpublished one is eligible
+	rows, err := r.conn().QueryContext(ctx,
+		`UPDATE outbox
+		SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox o
+			WHERE published_at IS NULL AND next_attempt_at <= CURRENT_TIMESTAMP
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox p
+					WHERE p.published_at IS NULL
+						AND p.aggregate_type = o.aggregate_type
+						AND p.aggregate_id = o.aggregate_id
+						AND p.id < o.id
+				)
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+outboxColumns,
+		limit, lease.Milliseconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.OutboxEvent{}
+	for rows.Next() {
+		event, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+
+	// UPDATE ... RETURNING does not keep the order of the subquery
+	slices.SortFunc(events, func(a, b *models.OutboxEvent) int { return cmp.Compare(a.ID, b.ID) })
+
+	return events, nil
+}
+
+// CompleteEvents records the outcome of publishing claimed events in one transaction
+func (r *SubscriptionRepository) CompleteEvents(ctx context.Context, events []*models.OutboxEvent) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Batch)
+	defer func() { err = done(err) }()
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		for _, event := range events {
+			switch {
+			case event.PublishedAt != nil:
+				_, err := tx.ExecContext(ctx, "UPDATE outbox SET published_at = $1 WHERE id = $2", *event.PublishedAt, event.ID)
+				if err != nil {
+					return fmt.Errorf("failed to mark outbox event published: %w", err)
+				}
+			case event.LastError != "":
+				// A relay whose lease ran out may report a failure after another one published the event
+				_, err := tx.ExecContext(ctx,
+					`UPDATE outbox SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2
+					WHERE id = $3 AND published_at IS NULL`,
+					event.LastError, event.NextAttemptAt, event.ID,
+				)
+				if err != nil {
+					return fmt.Errorf("failed to reschedule outbox event: %w", err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// PurgePublished removes events published longer than retention ago
+func (r *SubscriptionRepository) PurgePublished(ctx context.Context, retention time.Duration) (_ int64, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Batch)
+	defer func() { err = done(err) }()
+
+	result, err := r.conn().ExecContext(ctx,
+		"DELETE FROM outbox WHERE published_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'",
+		int64(retention/time.Second),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox: %w", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return purged, nil
+}
+
+// insertOutboxEvents records the events describing a subscription change inside
+// the transaction that made it
+func insertOutboxEvents(ctx context.Context, tx *sql.Tx, action string, before, after *models.Subscription) error {
+	events, err := models.NewSubscriptionOutboxEvents(action, before, after)
+	if err != nil {
+		return fmt.Errorf("failed to build outbox events: %w", err)
+	}
+
+	for _, event := range events {
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO outbox (aggregate_type, aggregate_id, event_id, event_type, payload)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at`,
+			event.AggregateType, event.AggregateID, event.EventID, event.EventType, string(event.Payload),
+		).Scan(&event.ID, &event.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to write outbox event: %w", err)
+		}
+
+		if err := notifyOutboxEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanOutboxEvent scans a row selected with outboxColumns
+func scanOutboxEvent(row rowScanner) (*models.OutboxEvent, error) {
+	var event models.OutboxEvent
+	var payload []byte
+
+	err := row.Scan(
+		&event.ID,
+		&event.AggregateType,
+		&event.AggregateID,
+		&event.EventID,
+		&event.EventType,
+		&payload,
+		&event.Attempts,
+		&event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Payload = payload
+
+	return &event, nil
+}
@@ -0,0 +1,487 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"subscription-service/db"
+	"subscription-service/models"
+)
+
+// ReminderStore keeps reminder preferences and the reminder jobs planned from them.
+// Both SubscriptionRepository and MockSubscriptionRepository implement it.
+type ReminderStore interface {
+	GetReminderPreferences(ctx context.Context, userID uuid.UUID) (*models.ReminderPreferences, error)
+	SaveReminderPreferences(ctx context.Context, preferences *models.ReminderPreferences) error
+
+	// ListReminderTargets returns the live subscriptions whose reminder window is
+	// open at now, see models.ReminderWindowOpen, with their owners' preferences.
+	// Owners without preferences are treated as having defaults.
+	ListReminderTargets(ctx context.Context, now time.Time, defaults *models.ReminderPreferences) ([]*models.ReminderTarget, error)
+	// CreateReminderJobs stores planned jobs, skipping those planned before, and
+	// returns the number of new jobs
+	CreateReminderJobs(ctx context.Context, jobs []*models.ReminderJob) (int, error)
+	// ClaimDueReminders returns up to limit pending jobs that are due, together
+	// with their subscriptions, and postpones them by lease so that other
+	// replicas skip them
+	ClaimDueReminders(ctx context.Context, limit int, lease time.Duration) ([]*models.ReminderJob, error)
+	// CompleteReminder moves a job to its final sent or cancelled state
+	CompleteReminder(ctx context.Context, id int64, status string) error
+	// RecordReminderFailure stores a failed attempt; a nil nextAttemptAt marks the job failed
+	RecordReminderFailure(ctx context.Context, id int64, message string, nextAttemptAt *time.Time) error
+	ListReminders(ctx context.Context, userID uuid.UUID, limit int) ([]*models.ReminderJob, error)
+}
+
+var (
+	_ ReminderStore = (*SubscriptionRepository)(nil)
+	_ ReminderStore = (*MockSubscriptionRepository)(nil)
+)
+
+// reminderPreferencesColumns is the column list understood by scanReminderPreferences
+const reminderPreferencesColumns = `user_id, enabled, renewal_lead_days, end_lead_days, channel, target, updated_at`
+
+// reminderJobColumns is the column list understood by scanReminderJob
+const reminderJobColumns = `id, subscription_id, user_id, kind, due_on, lead_days, send_at, channel, target,
+	status, attempts, next_attempt_at, last_error, created_at, sent_at`
+
+// GetReminderPreferences gets the reminder preferences of a user
+func (r *SubscriptionRepository) GetReminderPreferences(ctx context.Context, userID uuid.UUID) (_ *models.ReminderPreferences, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	preferences, err := scanReminderPreferences(r.conn().QueryRowContext(ctx,
+		`SELECT `+reminderPreferencesColumns+` FROM reminder_preferences WHERE user_id = $1`,
+		userID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get reminder preferences: %w", err)
+	}
+
+	return preferences, nil
+}
+
+// SaveReminderPreferences creates or replaces the reminder preferences of a user.
+// Pending jobs are brought in line in the same transaction: those the new
+// preferences no longer want are cancelled and the rest go to the new target.
+func (r *SubscriptionRepository) SaveReminderPreferences(ctx context.Context, preferences *models.ReminderPreferences) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO reminder_preferences (user_id, enabled, renewal_lead_days, end_lead_days, channel, target)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_id) DO UPDATE
+				SET enabled = EXCLUDED.enabled, renewal_lead_days = EXCLUDED.renewal_lead_days,
+					end_lead_days = EXCLUDED.end_lead_days, channel = EXCLUDED.channel,
+					target = EXCLUDED.target, updated_at = CURRENT_TIMESTAMP
+			RETURNING updated_at`,
+			preferences.UserID, preferences.Enabled, pq.Array(preferences.RenewalLeadDays), pq.Array(preferences.EndLeadDays),
+			preferences.Channel, nullString(preferences.Target),
+		).Scan(&preferences.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to save reminder preferences: %w", err)
+		}
+
+		// Must match models.ReminderMatchesPreferences
+		_, err = tx.ExecContext(ctx,
+			`UPDATE reminder_jobs SET status = 'cancelled'
+			WHERE user_id = $1 AND status = 'pending'
+				AND (NOT $2 OR NOT lead_days = ANY(CASE kind WHEN 'end' THEN $4::bigint[] ELSE $3::bigint[] END))`,
+			preferences.UserID, preferences.Enabled, int64Array(preferences.RenewalLeadDays), int64Array(preferences.EndLeadDays),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to cancel reminder jobs: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE reminder_jobs SET channel = $2, target = $3 WHERE user_id = $1 AND status = 'pending'`,
+			preferences.UserID, preferences.Channel, nullString(preferences.Target),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to retarget reminder jobs: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ListReminderTargets returns the live subscriptions whose reminder window is
+// open at now with their owners' preferences. Must match models.ReminderWindowOpen.
+func (r *SubscriptionRepository) ListReminderTargets(ctx context.Context, now time.Time, defaults *models.ReminderPreferences) (_ []*models.ReminderTarget, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Batch)
+	defer func() { err = done(err) }()
+
+	// Renewals fall on the first day of a month, so only the next one or two
+	// can be within reach of any lead time
+	horizon := models.MaxReminderLeadDays
+	for _, lead := range append(append([]int{}, defaults.RenewalLeadDays...), defaults.EndLeadDays...) {
+		if lead > horizon {
+			horizon = lead
+		}
+	}
+
+	// A lead time of -1 reaches nothing: reminders are disabled or the kind has none
+	subscriptions, err := querySubscriptions(ctx, r.conn(),
+		`SELECT `+subscriptionColumns+` FROM subscriptions
+		CROSS JOIN LATERAL (
+			SELECT
+				COALESCE((
+					SELECT CASE WHEN enabled THEN COALESCE((SELECT max(lead) FROM unnest(renewal_lead_days) AS lead), -1) ELSE -1 END
+					FROM reminder_preferences WHERE reminder_preferences.user_id = subscriptions.user_id
+				), $3) AS renewal_lead,
+				COALESCE((
+					SELECT CASE WHEN enabled THEN COALESCE((SELECT max(lead) FROM unnest(end_lead_days) AS lead), -1) ELSE -1 END
+					FROM reminder_preferences WHERE reminder_preferences.user_id = subscriptions.user_id
+				), $4) AS end_lead
+		) AS leads
+		WHERE deleted_at IS NULL AND (
+			EXISTS (
+				SELECT 1 FROM unnest($2::date[]) AS renewal
+				WHERE renewal > to_date(start_date, 'MM-YYYY')
+					AND (end_date IS NULL OR renewal < to_date(end_date, 'MM-YYYY') + INTERVAL '1 month')
+					AND renewal <= $1::timestamp + leads.renewal_lead * INTERVAL '1 day'
+			)
+			OR (to_date(end_date, 'MM-YYYY') + INTERVAL '1 month' > $1::timestamp
+				AND to_date(end_date, 'MM-YYYY') + INTERVAL '1 month' <= $1::timestamp + leads.end_lead * INTERVAL '1 day')
+		)
+		ORDER BY id`,
+		now.UTC(), pq.Array(monthStarts(now, horizon)), maxLeadDays(defaults, models.ReminderKindRenewal), maxLeadDays(defaults, models.ReminderKindEnd),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(subscriptions) == 0 {
+		return []*models.ReminderTarget{}, nil
+	}
+
+	userIDs := make([]string, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		userIDs = append(userIDs, subscription.UserID.String())
+	}
+
+	rows, err := r.conn().QueryContext(ctx,
+		`SELECT `+reminderPreferencesColumns+` FROM reminder_preferences WHERE user_id = ANY($1::uuid[])`,
+		pq.Array(userIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reminder preferences: %w", err)
+	}
+	defer rows.Close()
+
+	preferences := map[uuid.UUID]*models.ReminderPreferences{}
+	for rows.Next() {
+		userPreferences, err := scanReminderPreferences(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reminder preferences: %w", err)
+		}
+		preferences[userPreferences.UserID] = userPreferences
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list reminder preferences: %w", err)
+	}
+
+	targets := make([]*models.ReminderTarget, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		targets = append(targets, &models.ReminderTarget{
+			Subscription: subscription,
+			Preferences:  preferences[subscription.UserID],
+		})
+	}
+
+	return targets, nil
+}
+
+// monthStarts lists the first days of the months from now up to days ahead
+func monthStarts(now time.Time, days int) []string {
+	now = now.UTC()
+	until := now.AddDate(0, 0, days)
+
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if month.Before(now) {
+		month = month.AddDate(0, 1, 0)
+	}
+
+	var starts []string
+	for ; !month.After(until); month = month.AddDate(0, 1, 0) {
+		starts = append(starts, month.Format("2006-01-02"))
+	}
+	return starts
+}
+
+// maxLeadDays returns the longest lead time of a kind, or -1 if there is none
+func maxLeadDays(preferences *models.ReminderPreferences, kind string) int {
+	longest := -1
+	if !preferences.Enabled {
+		return longest
+	}
+	for _, lead := range preferences.LeadDays(kind) {
+		if lead > longest {
+			longest = lead
+		}
+	}
+	return longest
+}
+
+// CreateReminderJobs stores planned jobs; the unique key on subscription, kind,
+// due date and lead time makes planning the same job twice a no-op
+func (r *SubscriptionRepository) CreateReminderJobs(ctx context.Context, jobs []*models.ReminderJob) (_ int, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Batch)
+	defer func() { err = done(err) }()
+
+	created := 0
+
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		for _, job := range jobs {
+			result, err := tx.ExecContext(ctx,
+				`INSERT INTO reminder_jobs (subscription_id, user_id, kind, due_on, lead_days, send_at, channel, target, next_attempt_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $6)
+				ON CONFLICT (subscription_id, kind, due_on, lead_days) DO NOTHING`,
+				job.SubscriptionID, job.UserID, job.Kind, job.DueOn, job.LeadDays, job.SendAt, job.Channel, nullString(job.Target),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create reminder job: %w", err)
+			}
+
+			inserted, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("failed to get rows affected: %w", err)
+			}
+			created += int(inserted)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return created, nil
+}
+
+// ClaimDueReminders locks due jobs with SKIP LOCKED and postpones them by lease
+func (r *SubscriptionRepository) ClaimDueReminders(ctx context.Context, limit int, lease time.Duration) (_ []*models.ReminderJob, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Batch)
+	defer func() { err = done(err) }()
+
+	rows, err := r.conn().QueryContext(ctx,
+		`UPDATE reminder_jobs
+		SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM reminder_jobs
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+reminderJobColumns,
+		limit, int64(lease/time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim reminder jobs: %w", err)
+	}
+
+	jobs, err := collectReminderJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return jobs, nil
+	}
+
+	ids := make([]int64, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, int64(job.SubscriptionID))
+	}
+
+	// Soft-deleted subscriptions are loaded as well so that their jobs can be cancelled
+	subscriptions, err := querySubscriptions(ctx, r.conn(),
+		`SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = ANY($1)`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[int]*models.Subscription{}
+	for _, subscription := range subscriptions {
+		byID[subscription.ID] = subscription
+	}
+	for _, job := range jobs {
+		job.Subscription = byID[job.SubscriptionID]
+	}
+
+	return jobs, nil
+}
+
+// CompleteReminder moves a job to its final sent or cancelled state
+func (r *SubscriptionRepository) CompleteReminder(ctx context.Context, id int64, status string) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	var sentAt interface{}
+	if status == models.ReminderStatusSent {
+		sentAt = time.Now()
+	}
+
+	_, err = r.conn().ExecContext(ctx,
+		`UPDATE reminder_jobs SET status = $1, sent_at = $2, attempts = attempts + 1 WHERE id = $3`,
+		status, sentAt, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete reminder job: %w", err)
+	}
+
+	return nil
+}
+
+// RecordReminderFailure stores a failed attempt and schedules the next one
+func (r *SubscriptionRepository) RecordReminderFailure(ctx context.Context, id int64, message string, nextAttemptAt *time.Time) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	status := models.ReminderStatusFailed
+	var next interface{}
+	if nextAttemptAt != nil {
+		status = models.ReminderStatusPending
+		next = *nextAttemptAt
+	}
+
+	_, err = r.conn().ExecContext(ctx,
+		`UPDATE reminder_jobs
+		SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = COALESCE($3, next_attempt_at)
+		WHERE id = $4`,
+		status, message, next, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record reminder failure: %w", err)
+	}
+
+	return nil
+}
+
+// ListReminders returns the most recent reminder jobs of a user
+func (r *SubscriptionRepository) ListReminders(ctx context.Context, userID uuid.UUID, limit int) (_ []*models.ReminderJob, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	rows, err := r.conn().QueryContext(ctx,
+		`SELECT `+reminderJobColumns+` FROM reminder_jobs WHERE user_id = $1 ORDER BY send_at DESC, id DESC LIMIT $2`,
+		userID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reminder jobs: %w", err)
+	}
+
+	return collectReminderJobs(rows)
+}
+
+// scanReminderPreferences scans a row selected with reminderPreferencesColumns
+func scanReminderPreferences(row rowScanner) (*models.ReminderPreferences, error) {
+	var preferences models.ReminderPreferences
+	var renewalLeadDays, endLeadDays pq.Int64Array
+	var target sql.NullString
+
+	err := row.Scan(
+		&preferences.UserID,
+		&preferences.Enabled,
+		&renewalLeadDays,
+		&endLeadDays,
+		&preferences.Channel,
+		&target,
+		&preferences.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences.RenewalLeadDays = intSlice(renewalLeadDays)
+	preferences.EndLeadDays = intSlice(endLeadDays)
+	preferences.Target = target.String
+
+	return &preferences, nil
+}
+
+// scanReminderJob scans a row selected with reminderJobColumns
+func scanReminderJob(row rowScanner) (*models.ReminderJob, error) {
+	var job models.ReminderJob
+	var target, lastError sql.NullString
+	var sentAt sql.NullTime
+
+	err := row.Scan(
+		&job.ID,
+		&job.SubscriptionID,
+		&job.UserID,
+		&job.Kind,
+		&job.DueOn,
+		&job.LeadDays,
+		&job.SendAt,
+		&job.Channel,
+		&target,
+		&job.Status,
+		&job.Attempts,
+		&job.NextAttemptAt,
+		&lastError,
+		&job.CreatedAt,
+		&sentAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Target = target.String
+	job.LastError = lastError.String
+	if sentAt.Valid {
+		job.SentAt = &sentAt.Time
+	}
+
+	return &job, nil
+}
+
+// collectReminderJobs scans and closes rows selected with reminderJobColumns
+func collectReminderJobs(rows *sql.Rows) ([]*models.ReminderJob, error) {
+	defer rows.Close()
+
+	jobs := []*models.ReminderJob{}
+	for rows.Next() {
+		job, err := scanReminderJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reminder job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read reminder jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// intSlice converts a scanned integer array
+func intSlice(values pq.Int64Array) []int {
+	result := make([]int, len(values))
+	for i, value := range values {
+		result[i] = int(value)
+	}
+	return result
+}
+
+// int64Array converts ints into an array parameter; unlike pq.Array it never
+// stores NULL
+func int64Array(values []int) pq.Int64Array {
+	array := make(pq.Int64Array, len(values))
+	for i, value := range values {
+		array[i] = int64(value)
+	}
+	return array
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"subscription-service/models"
+)
+
+var (
+	// ErrNotFound is returned when a subscription does not exist or has been deleted
+	ErrNotFound = errors.New("subscription not found")
+	// ErrVersionConflict is returned when a subscription changed since the version the caller expected
+	ErrVersionConflict = errors.New("subscription version conflict")
+)
+
+// Repository describes the subscription storage used by the HTTP handlers.
+// Both SubscriptionRepository and MockSubscriptionRepository implement it.
+// Every mutation is recorded in the audit log atomically with the change itself
+// and increments the subscription version. The context carries the trace the
+// queries are recorded in.
+type Repository interface {
+	Create(ctx context.Context, subscription *models.CreateSubscriptionRequest, audit models.AuditInfo) (int, error)
+	GetByID(ctx context.Context, id int) (*models.Subscription, error)
+	// ResolveService finds the catalog entry of a subscription's service by ID
+	// or by a name matching one of its aliases, adding unknown names to the
+	// catalog; Create and Update resolve the service the same way
+	ResolveService(ctx context.Context, id *int, name string) (*models.Service, error)
+	List(ctx context.Context, filter *models.ListSubscriptionsRequest) (*models.SubscriptionPage, error)
+	Update(ctx context.Context, id int, subscription *models.UpdateSubscriptionRequest, expectedVersion *int, audit models.AuditInfo) error
+	Delete(ctx context.Context, id int, audit models.AuditInfo) error
+	Restore(ctx context.Context, id int, audit models.AuditInfo) error
+	Search(ctx context.Context, req *models.SearchSubscriptionsRequest) ([]*models.SubscriptionSearchResult, error)
+	ListDeleted(ctx context.Context, userID *uuid.UUID) ([]*models.Subscription, error)
+	PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error)
+	CalculateTotalCost(ctx context.Context, req *models.CalculateCostRequest) (*models.CalculateCostResponse, error)
+
+	// WithTx runs fn as a unit of work: the changes made through tx are
+	// committed together if fn returns nil and discarded otherwise. fn may run
+	// more than once, when the transaction loses a conflict with a concurrent
+	// one, so it should have no other side effects.
+	WithTx(ctx context.Context, fn func(tx Repository) error) error
+}
+
+var (
+	_ Repository = (*SubscriptionRepository)(nil)
+	_ Repository = (*MockSubscriptionRepository)(nil)
+)
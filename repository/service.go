@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"subscription-service/db"
+	"subscription-service/models"
+)
+
+var (
+	// ErrServiceNotFound is returned when a service ID is not in the catalog
+	ErrServiceNotFound = errors.New("service not found")
+	// ErrServiceMismatch is returned when the service ID and name of a subscription refer to different services
+	ErrServiceMismatch = errors.New("service_id and service_name refer to different services")
+	// ErrServiceExists is returned when the name or an alias of a new service is already taken
+	ErrServiceExists = errors.New("service name or alias is already taken")
+)
+
+// ServiceCatalog keeps the catalog of services that subscriptions refer to.
+// Both SubscriptionRepository and MockSubscriptionRepository implement it.
+type ServiceCatalog interface {
+	// CreateService adds a service known by its name and aliases
+	CreateService(ctx context.Context, req *models.CreateServiceRequest) (*models.Service, error)
+	GetService(ctx context.Context, id int) (*models.Service, error)
+	ListServices(ctx context.Context, filter *models.ListServicesRequest) ([]*models.Service, error)
+	// AddServiceAlias makes alias resolve to the service and returns the service
+	AddServiceAlias(ctx context.Context, id int, alias string) (*models.Service, error)
+}
+
+var (
+	_ ServiceCatalog = (*SubscriptionRepository)(nil)
+	_ ServiceCatalog = (*MockSubscriptionRepository)(nil)
+)
+
+// selectService selects the columns understood by scanService
+const selectService = `SELECT id, name,
+	ARRAY(SELECT alias FROM service_aliases WHERE service_id = services.id ORDER BY alias),
+	category, logo_url, default_price, created_at FROM services`
+
+// SQLSTATEs of constraint violations
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// isUniqueViolation reports whether err is a duplicate key error
+func isUniqueViolation(err error) bool {
+	return hasSQLState(err, uniqueViolation)
+}
+
+// hasSQLState reports whether err is a PostgreSQL error with the SQLSTATE code
+func hasSQLState(err error, code string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && string(pqErr.Code) == code
+}
+
+// CreateService adds a service to the catalog; its name resolves to it as well
+// as its aliases
+func (r *SubscriptionRepository) CreateService(ctx context.Context, req *models.CreateServiceRequest) (_ *models.Service, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	var service *models.Service
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		name := models.CleanServiceName(req.Name)
+
+		var id int
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO services (name, category, logo_url, default_price) VALUES ($1, $2, $3, $4) RETURNING id`,
+			name, req.Category, req.LogoURL, req.DefaultPrice,
+		).Scan(&id)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return ErrServiceExists
+			}
+			return fmt.Errorf("failed to create service: %w", err)
+		}
+
+		for _, alias := range append([]string{name}, req.Aliases...) {
+			if err := addAlias(ctx, tx, id, alias); err != nil {
+				return err
+			}
+		}
+
+		service, err = getService(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
+
+// GetService gets a service of the catalog by ID
+func (r *SubscriptionRepository) GetService(ctx context.Context, id int) (_ *models.Service, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	var service *models.Service
+	err = r.read(ctx, "get_service", func(q querier) (err error) {
+		service, err = scanService(q.QueryRowContext(ctx, selectService+` WHERE id = $1`, id))
+		return err
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrServiceNotFound
+		}
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	return service, nil
+}
+
+// ListServices lists the services of the catalog by name, optionally of one category
+func (r *SubscriptionRepository) ListServices(ctx context.Context, filter *models.ListServicesRequest) (_ []*models.Service, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	query := selectService
+	args := []interface{}{}
+	if filter.Category != "" {
+		query += " WHERE category = $1"
+		args = append(args, filter.Category)
+	}
+	query += " ORDER BY name"
+
+	var services []*models.Service
+	err = r.read(ctx, "list_services", func(q querier) error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to list services: %w", err)
+		}
+		defer rows.Close()
+
+		services = []*models.Service{}
+		for rows.Next() {
+			service, err := scanService(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan service: %w", err)
+			}
+			services = append(services, service)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to list services: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return services, nil
+}
+
+// AddServiceAlias makes alias resolve to a service of the catalog
+func (r *SubscriptionRepository) AddServiceAlias(ctx context.Context, id int, alias string) (_ *models.Service, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	var service *models.Service
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := getService(ctx, tx, id); err != nil {
+			return err
+		}
+
+		if err := addAlias(ctx, tx, id, alias); err != nil {
+			return err
+		}
+
+		var err error
+		service, err = getService(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
+
+// ResolveService finds the service of a subscription by its catalog ID or by a
+// name that one of its aliases matches. When both are given they must agree.
+// A name the catalog does not know adds a service with that name.
+func (r *SubscriptionRepository) ResolveService(ctx context.Context, id *int, name string) (_ *models.Service, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	var service *models.Service
+	err = r.inTx(ctx, func(tx *sql.Tx) (err error) {
+		service, err = resolveService(ctx, tx, id, name)
+		return err
+	})
+	return service, err
+}
+
+// resolveService does the work of ResolveService inside a transaction
+func resolveService(ctx context.Context, tx *sql.Tx, id *int, name string) (*models.Service, error) {
+	key := models.ServiceKey(name)
+
+	if id != nil {
+		service, err := getService(ctx, tx, *id)
+		if err != nil {
+			return nil, err
+		}
+
+		if key != "" && !containsAlias(service.Aliases, key) {
+			return nil, ErrServiceMismatch
+		}
+		return service, nil
+	}
+
+	var serviceID int
+	err := tx.QueryRowContext(ctx, `SELECT service_id FROM service_aliases WHERE alias = $1`, key).Scan(&serviceID)
+	if err == nil {
+		return getService(ctx, tx, serviceID)
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to resolve service: %w", err)
+	}
+
+	// A concurrent registration of the same name is waited for and then reused
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO services (name) VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING id`,
+		models.CleanServiceName(name),
+	).Scan(&serviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register service: %w", err)
+	}
+
+	if err := addAlias(ctx, tx, serviceID, name); err != nil {
+		return nil, err
+	}
+
+	return getService(ctx, tx, serviceID)
+}
+
+// addAlias makes alias resolve to the service id; an alias that already
+// resolves to another service is ErrServiceExists
+func addAlias(ctx context.Context, tx *sql.Tx, id int, alias string) error {
+	var owner int
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO service_aliases (alias, service_id) VALUES ($1, $2)
+		ON CONFLICT (alias) DO UPDATE SET alias = EXCLUDED.alias RETURNING service_id`,
+		models.ServiceKey(alias), id,
+	).Scan(&owner)
+	if err != nil {
+		return fmt.Errorf("failed to add service alias: %w", err)
+	}
+
+	if owner != id {
+		return ErrServiceExists
+	}
+	return nil
+}
+
+// getService gets a service by ID with its aliases
+func getService(ctx context.Context, q querier, id int) (*models.Service, error) {
+	service, err := scanService(q.QueryRowContext(ctx, selectService+` WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrServiceNotFound
+		}
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	return service, nil
+}
+
+// scanService scans a row selected with selectService
+func scanService(row rowScanner) (*models.Service, error) {
+	var service models.Service
+	var aliases pq.StringArray
+	var category, logoURL sql.NullString
+	var defaultPrice sql.NullInt64
+
+	err := row.Scan(
+		&service.ID,
+		&service.Name,
+		&aliases,
+		&category,
+		&logoURL,
+		&defaultPrice,
+		&service.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	service.Aliases = []string(aliases)
+	if category.Valid {
+		service.Category = &category.String
+	}
+	if logoURL.Valid {
+		service.LogoURL = &logoURL.String
+	}
+	if defaultPrice.Valid {
+		price := int(defaultPrice.Int64)
+		service.DefaultPrice = &price
+	}
+
+	return &service, nil
+}
+
+// containsAlias reports whether key is one of aliases
+func containsAlias(aliases []string, key string) bool {
+	for _, alias := range aliases {
+		if alias == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"subscription-service/db"
+)
+
+// StatsStore provides aggregate figures about subscriptions for monitoring.
+// Both SubscriptionRepository and MockSubscriptionRepository implement it.
+type StatsStore interface {
+	// CountActiveByCategory returns the number of live subscriptions per catalog
+	// category; services without one are counted under ""
+	CountActiveByCategory(ctx context.Context) (map[string]int, error)
+}
+
+var (
+	_ StatsStore = (*SubscriptionRepository)(nil)
+	_ StatsStore = (*MockSubscriptionRepository)(nil)
+)
+
+// CountActiveByCategory returns the number of live subscriptions per catalog category
+func (r *SubscriptionRepository) CountActiveByCategory(ctx context.Context) (_ map[string]int, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Report)
+	defer func() { err = done(err) }()
+
+	var counts map[string]int
+	err = r.read(ctx, "count_active_by_category", func(q querier) (err error) {
+		counts, err = countActiveByCategory(ctx, q)
+		return err
+	})
+	return counts, err
+}
+
+// countActiveByCategory runs the query of CountActiveByCategory on q
+func countActiveByCategory(ctx context.Context, q querier) (map[string]int, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT services.category, COUNT(*)
+		FROM subscriptions JOIN services ON services.id = subscriptions.service_id
+		WHERE subscriptions.deleted_at IS NULL
+		GROUP BY services.category`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var category sql.NullString
+		var count int
+		if err := rows.Scan(&category, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan subscription count: %w", err)
+		}
+		counts[category.String] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count subscriptions: %w", err)
+	}
+
+	return counts, nil
+}
+
+// CountActiveByCategory returns the number of live subscriptions per catalog category
+func (r *MockSubscriptionRepository) CountActiveByCategory(ctx context.Context) (map[string]int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	counts := map[string]int{}
+	for _, subscription := range r.subscriptions {
+		if subscription.DeletedAt != nil {
+			continue
+		}
+
+		category := ""
+		if service := r.services[subscription.ServiceID]; service.Category != nil {
+			category = *service.Category
+		}
+		counts[category]++
+	}
+
+	return counts, nil
+}
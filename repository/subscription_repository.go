@@ -1,11 +1,13 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
 	"subscription-service/db"
 	"subscription-service/models"
+	"subscription-service/search"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +16,7 @@ import (
 // SubscriptionRepository handles database operations for subscriptions
 type SubscriptionRepository struct {
 	db *db.PostgresDB
+	tx *sql.Tx // Set inside a unit of work started by WithTx
 }
 
 // NewSubscriptionRepository creates a new subscription repository
@@ -21,201 +24,495 @@ func NewSubscriptionRepository(db *db.PostgresDB) *SubscriptionRepository {
 	return &SubscriptionRepository{db: db}
 }
 
-// Create creates a new subscription
-func (r *SubscriptionRepository) Create(subscription *models.CreateSubscriptionRequest) (int, error) {
+// Create creates a new subscription and records it in the audit log and outbox
+func (r *SubscriptionRepository) Create(ctx context.Context, subscription *models.CreateSubscriptionRequest, audit models.AuditInfo) (_ int, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
 	var id int
-	err := r.db.DB.QueryRow(
-		`INSERT INTO subscriptions (service_name, price, user_id, start_date, end_date) 
-		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
-		subscription.ServiceName, subscription.Price, subscription.UserID, subscription.StartDate, subscription.EndDate,
-	).Scan(&id)
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		service, err := resolveService(ctx, tx, subscription.ServiceID, subscription.ServiceName)
+		if err != nil {
+			return err
+		}
 
+		created, err := scanSubscription(tx.QueryRowContext(ctx,
+			`INSERT INTO subscriptions (service_id, service_name, price, user_id, start_date, end_date) 
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING `+subscriptionColumns,
+			service.ID, service.Name, subscription.Price, subscription.UserID, subscription.StartDate, subscription.EndDate,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to create subscription: %w", err)
+		}
+
+		id = created.ID
+		return recordChange(ctx, tx, models.AuditActionCreate, audit, nil, created)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to create subscription: %w", err)
+		return 0, err
 	}
 
 	return id, nil
 }
 
 // GetByID gets a subscription by ID
-func (r *SubscriptionRepository) GetByID(id int) (*models.Subscription, error) {
-	var subscription models.Subscription
-	var createdAt, updatedAt time.Time
-
-	err := r.db.DB.QueryRow(
-		`SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at 
-		FROM subscriptions WHERE id = $1`,
-		id,
-	).Scan(
-		&subscription.ID,
-		&subscription.ServiceName,
-		&subscription.Price,
-		&subscription.UserID,
-		&subscription.StartDate,
-		&subscription.EndDate,
-		&createdAt,
-		&updatedAt,
-	)
-
+func (r *SubscriptionRepository) GetByID(ctx context.Context, id int) (_ *models.Subscription, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	var subscription *models.Subscription
+	err = r.read(ctx, "get", func(q querier) (err error) {
+		subscription, err = scanSubscription(q.QueryRowContext(ctx,
+			`SELECT `+subscriptionColumns+` 
+			FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`,
+			id,
+		))
+		return err
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("subscription not found")
+			return nil, ErrNotFound
 		}
 		return nil, fmt.Errorf("failed to get subscription: %w", err)
 	}
 
-	subscription.CreatedAt = createdAt
-	subscription.UpdatedAt = updatedAt
+	return subscription, nil
+}
 
-	return &subscription, nil
+// sortExpressions maps the sort keys of subscription lists to the SQL they
+// order by; only these are ever put into a query. Start dates are stored as
+// MM-YYYY and ordered as YYYYMM, see models.MonthKey.
+var sortExpressions = map[string]string{
+	models.SortByPrice:       "price",
+	models.SortByStartDate:   startMonthKey,
+	models.SortByCreatedAt:   "created_at",
+	models.SortByServiceName: "service_name",
 }
 
-// List gets all subscriptions with optional filtering
-func (r *SubscriptionRepository) List(userID *uuid.UUID, serviceName *string) ([]*models.Subscription, error) {
-	query := `SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at FROM subscriptions`
+// serviceByAlias filters subscriptions by a service name given in any of the
+// spellings the catalog knows; its parameter is the ServiceKey of the name
+const serviceByAlias = "service_id = (SELECT service_id FROM service_aliases WHERE alias = $%d)"
+
+const (
+	// startMonthKey and endMonthKey are the dates of a subscription as YYYYMM
+	startMonthKey = "(substring(start_date from 4) || substring(start_date for 2))"
+	endMonthKey   = "(substring(end_date from 4) || substring(end_date for 2))"
+)
 
-	whereConditions := []string{}
+// periodCost is what a subscription costs in the period of costConditions, as
+// models.Subscription.CostIn computes it: its price for every month from the
+// later of its start and $1 to the earlier of its end and $2
+var periodCost = fmt.Sprintf("price * (%s - %s + 1)",
+	monthIndex("LEAST(COALESCE("+endMonthKey+", $2), $2)"),
+	monthIndex("GREATEST("+startMonthKey+", $1)"),
+)
+
+// monthIndex numbers the month of a YYYYMM expression so that consecutive
+// months differ by one
+func monthIndex(key string) string {
+	return fmt.Sprintf("(substring(%[1]s for 4)::int * 12 + substring(%[1]s from 5)::int)", key)
+}
+
+// List returns a page of live subscriptions matching the filter, ordered by its
+// sort key and then by ID. Pages are read by keyset: a page starts after the
+// subscription its cursor marks, so no rows are skipped or repeated when
+// subscriptions are created or deleted in between.
+func (r *SubscriptionRepository) List(ctx context.Context, filter *models.ListSubscriptionsRequest) (_ *models.SubscriptionPage, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	cursor, err := filter.ParseCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	sortExpression, ok := sortExpressions[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort key %q", filter.Sort)
+	}
+	direction, comparison := "ASC", ">"
+	if filter.Order == models.SortDescending {
+		direction, comparison = "DESC", "<"
+	}
+
+	whereConditions := []string{"deleted_at IS NULL"}
 	args := []interface{}{}
 	paramCounter := 1
 
-	if userID != nil {
+	if filter.UserID != nil {
 		whereConditions = append(whereConditions, fmt.Sprintf("user_id = $%d", paramCounter))
-		args = append(args, *userID)
+		args = append(args, *filter.UserID)
 		paramCounter++
 	}
 
-	if serviceName != nil && *serviceName != "" {
-		whereConditions = append(whereConditions, fmt.Sprintf("service_name = $%d", paramCounter))
-		args = append(args, *serviceName)
+	if filter.ServiceName != nil && *filter.ServiceName != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf(serviceByAlias, paramCounter))
+		args = append(args, models.ServiceKey(*filter.ServiceName))
 		paramCounter++
 	}
 
-	if len(whereConditions) > 0 {
-		query += " WHERE " + strings.Join(whereConditions, " AND ")
+	if filter.ServicePrefix != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf("lower(service_name) LIKE $%d", paramCounter))
+		args = append(args, escapeLike(strings.ToLower(filter.ServicePrefix))+"%")
+		paramCounter++
 	}
 
-	rows, err := r.db.DB.Query(query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	if filter.MinPrice != nil {
+		whereConditions = append(whereConditions, fmt.Sprintf("price >= $%d", paramCounter))
+		args = append(args, *filter.MinPrice)
+		paramCounter++
 	}
-	defer rows.Close()
 
-	subscriptions := []*models.Subscription{}
-	for rows.Next() {
-		var subscription models.Subscription
-		var createdAt, updatedAt time.Time
-
-		err := rows.Scan(
-			&subscription.ID,
-			&subscription.ServiceName,
-			&subscription.Price,
-			&subscription.UserID,
-			&subscription.StartDate,
-			&subscription.EndDate,
-			&createdAt,
-			&updatedAt,
-		)
+	if filter.MaxPrice != nil {
+		whereConditions = append(whereConditions, fmt.Sprintf("price <= $%d", paramCounter))
+		args = append(args, *filter.MaxPrice)
+		paramCounter++
+	}
+
+	if filter.ActiveIn != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf(
+			"%s <= $%d AND (end_date IS NULL OR %s >= $%d)",
+			startMonthKey, paramCounter, endMonthKey, paramCounter,
+		))
+		args = append(args, models.MonthKey(filter.ActiveIn))
+		paramCounter++
+	}
+
+	if filter.HasEndDate != nil {
+		if *filter.HasEndDate {
+			whereConditions = append(whereConditions, "end_date IS NOT NULL")
+		} else {
+			whereConditions = append(whereConditions, "end_date IS NULL")
+		}
+	}
+
+	if len(filter.TagIDs) > 0 {
+		whereConditions = append(whereConditions, fmt.Sprintf(subscriptionHasTag, paramCounter))
+		args = append(args, int64Array(filter.TagIDs))
+		paramCounter++
+	}
+
+	// The total counts every page, so it ignores the cursor
+	countQuery := "SELECT COUNT(*) FROM subscriptions WHERE " + strings.Join(whereConditions, " AND ")
+	countArgs := args
+
+	if cursor != nil {
+		value, err := cursor.SortArg()
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan subscription: %w", err)
+			return nil, err
+		}
+		whereConditions = append(whereConditions, fmt.Sprintf(
+			"(%s, id) %s ($%d, $%d)", sortExpression, comparison, paramCounter, paramCounter+1,
+		))
+		args = append(args, value, cursor.ID)
+		paramCounter += 2
+	}
+
+	// One row more than the page tells whether another page follows
+	query := fmt.Sprintf(
+		"SELECT %s FROM subscriptions WHERE %s ORDER BY %s %s, id %s LIMIT $%d",
+		subscriptionColumns, strings.Join(whereConditions, " AND "),
+		sortExpression, direction, direction, paramCounter,
+	)
+	args = append(args, filter.Limit+1)
+
+	page := &models.SubscriptionPage{}
+	err = r.read(ctx, "list", func(q querier) (err error) {
+		page.Items, err = querySubscriptions(ctx, q, query, args...)
+		if err != nil || !filter.IncludeTotal {
+			return err
 		}
 
-		subscription.CreatedAt = createdAt
-		subscription.UpdatedAt = updatedAt
-		subscriptions = append(subscriptions, &subscription)
+		var total int
+		if err := q.QueryRowContext(ctx, countQuery, countArgs...).Scan(&total); err != nil {
+			return fmt.Errorf("failed to count subscriptions: %w", err)
+		}
+		page.Total = &total
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return subscriptions, nil
+	if len(page.Items) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		page.NextCursor = filter.NextCursor(page.Items[filter.Limit-1])
+	}
+
+	return page, nil
 }
 
-// Update updates a subscription
-func (r *SubscriptionRepository) Update(id int, subscription *models.UpdateSubscriptionRequest) error {
-	setClauses := []string{}
-	args := []interface{}{}
-	paramCounter := 1
+// escapeLike escapes the wildcards of a LIKE pattern so that s matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
 
-	if subscription.ServiceName != "" {
-		setClauses = append(setClauses, fmt.Sprintf("service_name = $%d", paramCounter))
-		args = append(args, subscription.ServiceName)
-		paramCounter++
-	}
+// Search ranks the live subscriptions whose service name matches the query:
+// names with a word starting with each word of the query score 1, names that
+// are similar by trigrams their similarity. Names and query are compared in
+// the Latin spelling of the search_name column, see search.Normalize.
+func (r *SubscriptionRepository) Search(ctx context.Context, req *models.SearchSubscriptionsRequest) (_ []*models.SubscriptionSearchResult, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	// $1 is the normalized query and $2 the full-text query built from it;
+	// % and <% match above the pg_trgm thresholds
+	query := search.Normalize(req.Query)
+	args := []interface{}{query, search.PrefixQuery(query)}
+	paramCounter := 3
 
-	if subscription.Price != nil {
-		setClauses = append(setClauses, fmt.Sprintf("price = $%d", paramCounter))
-		args = append(args, *subscription.Price)
-		paramCounter++
+	fullText := "to_tsvector('simple', search_name) @@ to_tsquery('simple', $2)"
+	whereConditions := []string{
+		"deleted_at IS NULL",
+		"(search_name % $1 OR $1 <% search_name OR " + fullText + ")",
 	}
 
-	if subscription.UserID != uuid.Nil {
-		setClauses = append(setClauses, fmt.Sprintf("user_id = $%d", paramCounter))
-		args = append(args, subscription.UserID)
+	if req.UserID != nil {
+		whereConditions = append(whereConditions, fmt.Sprintf("user_id = $%d", paramCounter))
+		args = append(args, *req.UserID)
 		paramCounter++
 	}
 
-	if subscription.StartDate != "" {
-		setClauses = append(setClauses, fmt.Sprintf("start_date = $%d", paramCounter))
-		args = append(args, subscription.StartDate)
-		paramCounter++
+	statement := fmt.Sprintf(
+		`SELECT %s, CASE WHEN %s THEN 1
+			ELSE GREATEST(similarity(search_name, $1), word_similarity($1, search_name)) END AS score
+		FROM subscriptions WHERE %s ORDER BY score DESC, id LIMIT $%d`,
+		subscriptionColumns, fullText, strings.Join(whereConditions, " AND "), paramCounter,
+	)
+	args = append(args, req.Limit)
+
+	var results []*models.SubscriptionSearchResult
+	err = r.read(ctx, "search", func(q querier) error {
+		rows, err := q.QueryContext(ctx, statement, args...)
+		if err != nil {
+			return fmt.Errorf("failed to search subscriptions: %w", err)
+		}
+		defer rows.Close()
+
+		results = []*models.SubscriptionSearchResult{}
+		for rows.Next() {
+			var result models.SubscriptionSearchResult
+			subscription, err := scanSubscription(scoredRow{rows, &result.Score})
+			if err != nil {
+				return fmt.Errorf("failed to scan subscription: %w", err)
+			}
+			result.Subscription = *subscription
+			result.Highlight = search.Highlight(subscription.ServiceName, req.Query)
+			results = append(results, &result)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to search subscriptions: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	setClauses = append(setClauses, fmt.Sprintf("end_date = $%d", paramCounter))
-	args = append(args, subscription.EndDate)
-	paramCounter++
+	return results, nil
+}
 
-	setClauses = append(setClauses, fmt.Sprintf("updated_at = $%d", paramCounter))
-	args = append(args, time.Now())
-	paramCounter++
+// scoredRow scans a row of subscriptionColumns followed by a score
+type scoredRow struct {
+	row   rowScanner
+	score *float64
+}
 
-	args = append(args, id)
+func (r scoredRow) Scan(dest ...interface{}) error {
+	return r.row.Scan(append(dest, r.score)...)
+}
 
-	query := fmt.Sprintf(
-		"UPDATE subscriptions SET %s WHERE id = $%d",
-		strings.Join(setClauses, ", "),
-		paramCounter,
-	)
+// ListDeleted gets all soft-deleted subscriptions, most recently deleted first
+func (r *SubscriptionRepository) ListDeleted(ctx context.Context, userID *uuid.UUID) (_ []*models.Subscription, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
 
-	result, err := r.db.DB.Exec(query, args...)
-	if err != nil {
-		return fmt.Errorf("failed to update subscription: %w", err)
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE deleted_at IS NOT NULL`
+	args := []interface{}{}
+
+	if userID != nil {
+		query += " AND user_id = $1"
+		args = append(args, *userID)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	query += " ORDER BY deleted_at DESC"
+
+	var subscriptions []*models.Subscription
+	err = r.read(ctx, "list_deleted", func(q querier) (err error) {
+		subscriptions, err = querySubscriptions(ctx, q, query, args...)
+		return err
+	})
+	return subscriptions, err
+}
+
+// querySubscriptions runs a SELECT over subscriptionColumns on q and scans every row
+func querySubscriptions(ctx context.Context, q querier, query string, args ...interface{}) ([]*models.Subscription, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
 	}
+	defer rows.Close()
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("subscription not found")
+	subscriptions := []*models.Subscription{}
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan subscription: %w", err)
+		}
+		subscriptions = append(subscriptions, subscription)
 	}
 
-	return nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+
+	return subscriptions, nil
 }
 
-// Delete deletes a subscription
-func (r *SubscriptionRepository) Delete(id int) error {
-	result, err := r.db.DB.Exec("DELETE FROM subscriptions WHERE id = $1", id)
+// Update replaces a subscription and records the change in the audit log.
+// When expectedVersion is set the update fails with ErrVersionConflict unless
+// it matches the stored version.
+func (r *SubscriptionRepository) Update(ctx context.Context, id int, subscription *models.UpdateSubscriptionRequest, expectedVersion *int, audit models.AuditInfo) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	query := `UPDATE subscriptions 
+		SET service_id = $1, service_name = $2, price = $3, user_id = $4, start_date = $5, end_date = $6,
+			updated_at = $7, version = version + 1
+		WHERE id = $8 AND deleted_at IS NULL RETURNING ` + subscriptionColumns
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockSubscription(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+
+		if expectedVersion != nil && before.Version != *expectedVersion {
+			return ErrVersionConflict
+		}
+
+		service, err := resolveService(ctx, tx, subscription.ServiceID, subscription.ServiceName)
+		if err != nil {
+			return err
+		}
+
+		after, err := scanSubscription(tx.QueryRowContext(ctx, query,
+			service.ID, service.Name, subscription.Price, subscription.UserID, subscription.StartDate, subscription.EndDate,
+			time.Now(), id,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to update subscription: %w", err)
+		}
+
+		return recordChange(ctx, tx, models.AuditActionUpdate, audit, before, after)
+	})
+}
+
+// Delete soft-deletes a subscription; the row is kept until it is purged
+func (r *SubscriptionRepository) Delete(ctx context.Context, id int, audit models.AuditInfo) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockSubscription(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+
+		after, err := scanSubscription(tx.QueryRowContext(ctx,
+			"UPDATE subscriptions SET deleted_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = $1 RETURNING "+subscriptionColumns,
+			id,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to delete subscription: %w", err)
+		}
+
+		return recordChange(ctx, tx, models.AuditActionDelete, audit, before, after)
+	})
+}
+
+// Restore brings back a soft-deleted subscription
+func (r *SubscriptionRepository) Restore(ctx context.Context, id int, audit models.AuditInfo) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockSubscription(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+
+		after, err := scanSubscription(tx.QueryRowContext(ctx,
+			"UPDATE subscriptions SET deleted_at = NULL, updated_at = $1, version = version + 1 WHERE id = $2 RETURNING "+subscriptionColumns,
+			time.Now(), id,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to restore subscription: %w", err)
+		}
+
+		return recordChange(ctx, tx, models.AuditActionRestore, audit, before, after)
+	})
+}
+
+// PurgeDeleted permanently removes subscriptions soft-deleted longer than retention ago
+func (r *SubscriptionRepository) PurgeDeleted(ctx context.Context, retention time.Duration) (_ int64, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Batch)
+	defer func() { err = done(err) }()
+
+	result, err := r.conn().ExecContext(ctx,
+		`DELETE FROM subscriptions 
+		WHERE deleted_at IS NOT NULL AND deleted_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'`,
+		int64(retention/time.Second),
+	)
 	if err != nil {
-		return fmt.Errorf("failed to delete subscription: %w", err)
+		return 0, fmt.Errorf("failed to purge subscriptions: %w", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	purged, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("subscription not found")
+	return purged, nil
+}
+
+// CalculateTotalCost sums what the matching subscriptions cost in a period, see
+// periodCost, in all and per tag
+func (r *SubscriptionRepository) CalculateTotalCost(ctx context.Context, req *models.CalculateCostRequest) (_ *models.CalculateCostResponse, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Report)
+	defer func() { err = done(err) }()
+
+	conditions, args := costConditions(req)
+
+	response := &models.CalculateCostResponse{}
+	err = r.read(ctx, "calculate_total_cost", func(q querier) error {
+		var totalCost sql.NullInt64
+		if err := q.QueryRowContext(ctx, `SELECT SUM(`+periodCost+`) FROM subscriptions WHERE `+conditions, args...).Scan(&totalCost); err != nil {
+			return fmt.Errorf("failed to calculate total cost: %w", err)
+		}
+		response.TotalCost = int(totalCost.Int64)
+
+		var err error
+		response.ByTag, err = costByTag(ctx, q, conditions, args, req.TagIDs)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return response, nil
 }
 
-// CalculateTotalCost calculates the total cost of subscriptions for a period
-func (r *SubscriptionRepository) CalculateTotalCost(req *models.CalculateCostRequest) (int, error) {
-	query := `SELECT SUM(price) FROM subscriptions WHERE `
+// costConditions returns the conditions selecting the subscriptions a cost
+// calculation sums, with their arguments. $1 and $2 are the first and the last
+// month of the period as YYYYMM, which periodCost relies on.
+func costConditions(req *models.CalculateCostRequest) (string, []interface{}) {
 	whereConditions := []string{
-		"(start_date <= $1 AND (end_date IS NULL OR end_date >= $2))",
+		"deleted_at IS NULL",
+		fmt.Sprintf("(%s <= $2 AND (end_date IS NULL OR %s >= $1))", startMonthKey, endMonthKey),
 	}
-	args := []interface{}{req.EndPeriod, req.StartPeriod}
+	args := []interface{}{models.MonthKey(req.StartPeriod), models.MonthKey(req.EndPeriod)}
 	paramCounter := 3
 
 	if req.UserID != nil {
@@ -225,22 +522,159 @@ func (r *SubscriptionRepository) CalculateTotalCost(req *models.CalculateCostReq
 	}
 
 	if req.ServiceName != nil && *req.ServiceName != "" {
-		whereConditions = append(whereConditions, fmt.Sprintf("service_name = $%d", paramCounter))
-		args = append(args, *req.ServiceName)
+		whereConditions = append(whereConditions, fmt.Sprintf(serviceByAlias, paramCounter))
+		args = append(args, models.ServiceKey(*req.ServiceName))
 		paramCounter++
 	}
 
-	query += strings.Join(whereConditions, " AND ")
+	if req.ServiceID != nil {
+		whereConditions = append(whereConditions, fmt.Sprintf("service_id = $%d", paramCounter))
+		args = append(args, *req.ServiceID)
+		paramCounter++
+	}
+
+	if req.Category != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf("service_id IN (SELECT id FROM services WHERE category = $%d)", paramCounter))
+		args = append(args, req.Category)
+		paramCounter++
+	}
+
+	if len(req.TagIDs) > 0 {
+		whereConditions = append(whereConditions, fmt.Sprintf(subscriptionHasTag, paramCounter))
+		args = append(args, int64Array(req.TagIDs))
+	}
 
-	var totalCost sql.NullInt64
-	err := r.db.DB.QueryRow(query, args...).Scan(&totalCost)
+	return strings.Join(whereConditions, " AND "), args
+}
+
+// subscriptionColumns is the column list understood by scanSubscription
+const subscriptionColumns = `id, service_id, service_name, price, user_id, start_date, end_date, created_at, updated_at, deleted_at, version`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// scanSubscription scans a row selected with subscriptionColumns
+func scanSubscription(row rowScanner) (*models.Subscription, error) {
+	var subscription models.Subscription
+	var deletedAt sql.NullTime
+
+	err := row.Scan(
+		&subscription.ID,
+		&subscription.ServiceID,
+		&subscription.ServiceName,
+		&subscription.Price,
+		&subscription.UserID,
+		&subscription.StartDate,
+		&subscription.EndDate,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+		&deletedAt,
+		&subscription.Version,
+	)
 	if err != nil {
-		return 0, fmt.Errorf("failed to calculate total cost: %w", err)
+		return nil, err
+	}
+
+	if deletedAt.Valid {
+		subscription.DeletedAt = &deletedAt.Time
+	}
+
+	return &subscription, nil
+}
+
+// WithTx runs fn as a unit of work in a transaction at the configured isolation
+// level. A transaction aborted by a serialization failure or a deadlock is run
+// again, so fn may be called more than once. Called inside a unit of work, fn
+// joins the running transaction.
+func (r *SubscriptionRepository) WithTx(ctx context.Context, fn func(tx Repository) error) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return fn(&SubscriptionRepository{db: r.db, tx: tx})
+	})
+}
+
+// conn returns the transaction of the unit of work, if any, or else the pool
+func (r *SubscriptionRepository) conn() querier {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db.DB
+}
+
+// read runs the read-only fn on a read replica, see db.PostgresDB.Read, or
+// inside a unit of work on its transaction
+func (r *SubscriptionRepository) read(ctx context.Context, operation string, fn func(q querier) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+	return r.db.Read(ctx, operation, func(conn *sql.DB) error {
+		return fn(conn)
+	})
+}
+
+// inTx runs fn inside a transaction, committing on success and rolling back on
+// error; retryable failures run it again. Inside a unit of work fn runs in its
+// transaction, which the unit of work commits.
+func (r *SubscriptionRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+
+	return db.Retry(ctx, r.db.TxMaxRetries, func() error {
+		tx, err := r.db.DB.BeginTx(ctx, r.db.TxOptions)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// recordChange writes the audit entry and outbox events of a subscription change
+// inside the transaction that made it
+func recordChange(ctx context.Context, tx *sql.Tx, action string, info models.AuditInfo, before, after *models.Subscription) error {
+	if err := insertAuditEntry(ctx, tx, action, info, before, after); err != nil {
+		return err
 	}
 
-	if !totalCost.Valid {
-		return 0, nil
+	return insertOutboxEvents(ctx, tx, action, before, after)
+}
+
+// lockSubscription loads a subscription and locks its row until the transaction ends.
+// When deleted is true only a soft-deleted row matches, otherwise only a live one.
+func lockSubscription(ctx context.Context, tx *sql.Tx, id int, deleted bool) (*models.Subscription, error) {
+	condition := "deleted_at IS NULL"
+	if deleted {
+		condition = "deleted_at IS NOT NULL"
 	}
 
-	return int(totalCost.Int64), nil
-}
\ No newline at end of file
+	subscription, err := scanSubscription(tx.QueryRowContext(ctx,
+		`SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = $1 AND `+condition+` FOR UPDATE`,
+		id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+
+	return subscription, nil
+}
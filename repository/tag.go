@@ -0,0 +1,343 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"subscription-service/db"
+	"subscription-service/models"
+)
+
+var (
+	// ErrTagNotFound is returned when a subscription is tagged with a tag that does not exist
+	ErrTagNotFound = errors.New("tag not found")
+	// ErrTagExists is returned when the user already has a tag of that name
+	ErrTagExists = errors.New("tag name is already taken")
+	// ErrTagUserMismatch is returned when a subscription is tagged with a tag of another user
+	ErrTagUserMismatch = errors.New("tag belongs to another user")
+)
+
+// TagStore keeps the tags users group their subscriptions by.
+// Both SubscriptionRepository and MockSubscriptionRepository implement it.
+type TagStore interface {
+	CreateTag(ctx context.Context, req *models.CreateTagRequest) (*models.Tag, error)
+	GetTag(ctx context.Context, id int) (*models.Tag, error)
+	ListTags(ctx context.Context, filter *models.ListTagsRequest) ([]*models.Tag, error)
+	RenameTag(ctx context.Context, id int, name string) (*models.Tag, error)
+	// DeleteTag deletes a tag and removes it from its subscriptions
+	DeleteTag(ctx context.Context, id int) error
+
+	// ListSubscriptionTags lists the tags of a live subscription
+	ListSubscriptionTags(ctx context.Context, subscriptionID int) ([]*models.Tag, error)
+	// TagSubscription puts a subscription under a tag of its user; tagging twice is harmless
+	TagSubscription(ctx context.Context, subscriptionID, tagID int) error
+	// UntagSubscription removes a tag from a subscription; removing a tag it does not have is harmless
+	UntagSubscription(ctx context.Context, subscriptionID, tagID int) error
+}
+
+var (
+	_ TagStore = (*SubscriptionRepository)(nil)
+	_ TagStore = (*MockSubscriptionRepository)(nil)
+)
+
+// tagColumns is the column list understood by scanTag
+const tagColumns = `id, user_id, name, created_at`
+
+// subscriptionHasTag restricts subscriptions to those with any of the tag IDs
+// in the array parameter it is formatted with
+const subscriptionHasTag = "id IN (SELECT subscription_id FROM subscription_tags WHERE tag_id = ANY($%d))"
+
+// CreateTag adds a tag for a user
+func (r *SubscriptionRepository) CreateTag(ctx context.Context, req *models.CreateTagRequest) (_ *models.Tag, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	tag, err := scanTag(r.conn().QueryRowContext(ctx,
+		`INSERT INTO tags (user_id, name) VALUES ($1, $2) RETURNING `+tagColumns,
+		req.UserID, models.CleanTagName(req.Name),
+	))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrTagExists
+		}
+		return nil, fmt.Errorf("failed to create tag: %w", err)
+	}
+
+	return tag, nil
+}
+
+// GetTag gets a tag by ID
+func (r *SubscriptionRepository) GetTag(ctx context.Context, id int) (_ *models.Tag, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	var tag *models.Tag
+	err = r.read(ctx, "get_tag", func(q querier) error {
+		var err error
+		tag, err = scanTag(q.QueryRowContext(ctx, `SELECT `+tagColumns+` FROM tags WHERE id = $1`, id))
+		return err
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get tag: %w", err)
+	}
+
+	return tag, nil
+}
+
+// ListTags lists tags by name, optionally of one user
+func (r *SubscriptionRepository) ListTags(ctx context.Context, filter *models.ListTagsRequest) (_ []*models.Tag, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	query := `SELECT ` + tagColumns + ` FROM tags`
+	args := []interface{}{}
+	if filter.UserID != nil {
+		query += " WHERE user_id = $1"
+		args = append(args, *filter.UserID)
+	}
+	query += " ORDER BY lower(name), id"
+
+	var tags []*models.Tag
+	err = r.read(ctx, "list_tags", func(q querier) (err error) {
+		tags, err = queryTags(ctx, q, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// RenameTag renames a tag
+func (r *SubscriptionRepository) RenameTag(ctx context.Context, id int, name string) (_ *models.Tag, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	tag, err := scanTag(r.conn().QueryRowContext(ctx,
+		`UPDATE tags SET name = $2 WHERE id = $1 RETURNING `+tagColumns,
+		id, models.CleanTagName(name),
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		if isUniqueViolation(err) {
+			return nil, ErrTagExists
+		}
+		return nil, fmt.Errorf("failed to rename tag: %w", err)
+	}
+
+	return tag, nil
+}
+
+// DeleteTag deletes a tag; its subscriptions lose it by the cascading foreign key
+func (r *SubscriptionRepository) DeleteTag(ctx context.Context, id int) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	result, err := r.conn().ExecContext(ctx, `DELETE FROM tags WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListSubscriptionTags lists the tags of a live subscription by name
+func (r *SubscriptionRepository) ListSubscriptionTags(ctx context.Context, subscriptionID int) (_ []*models.Tag, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	var tags []*models.Tag
+	err = r.read(ctx, "list_subscription_tags", func(q querier) error {
+		var exists bool
+		err := q.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM subscriptions WHERE id = $1 AND deleted_at IS NULL)`, subscriptionID,
+		).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to get subscription: %w", err)
+		}
+		if !exists {
+			// Final on every replica, so the read is not tried on the primary
+			return sql.ErrNoRows
+		}
+
+		tags, err = queryTags(ctx, q,
+			`SELECT `+tagColumns+` FROM tags
+			WHERE id IN (SELECT tag_id FROM subscription_tags WHERE subscription_id = $1)
+			ORDER BY lower(name), id`,
+			subscriptionID,
+		)
+		return err
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// TagSubscription puts a live subscription under a tag of its user
+func (r *SubscriptionRepository) TagSubscription(ctx context.Context, subscriptionID, tagID int) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		userID, err := subscriptionUser(ctx, tx, subscriptionID)
+		if err != nil {
+			return err
+		}
+
+		var tagUserID uuid.UUID
+		err = tx.QueryRowContext(ctx, `SELECT user_id FROM tags WHERE id = $1 FOR SHARE`, tagID).Scan(&tagUserID)
+		if err == sql.ErrNoRows {
+			return ErrTagNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get tag: %w", err)
+		}
+
+		if tagUserID != userID {
+			return ErrTagUserMismatch
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO subscription_tags (subscription_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			subscriptionID, tagID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to tag subscription: %w", err)
+		}
+		return nil
+	})
+}
+
+// UntagSubscription removes a tag from a live subscription
+func (r *SubscriptionRepository) UntagSubscription(ctx context.Context, subscriptionID, tagID int) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := subscriptionUser(ctx, tx, subscriptionID); err != nil {
+			return err
+		}
+
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM tags WHERE id = $1)`, tagID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to get tag: %w", err)
+		}
+		if !exists {
+			return ErrTagNotFound
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM subscription_tags WHERE subscription_id = $1 AND tag_id = $2`,
+			subscriptionID, tagID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to untag subscription: %w", err)
+		}
+		return nil
+	})
+}
+
+// subscriptionUser returns the user of a live subscription
+func subscriptionUser(ctx context.Context, q querier, id int) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := q.QueryRowContext(ctx, `SELECT user_id FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	return userID, nil
+}
+
+// costByTag sums the period cost of the subscriptions matching the conditions
+// and arguments of costConditions per tag, restricted to the tag IDs if any are given
+func costByTag(ctx context.Context, q querier, conditions string, args []interface{}, tagIDs []int) ([]models.TagCost, error) {
+	query := `SELECT tags.id, tags.name, SUM(matched.cost)
+		FROM (SELECT id, ` + periodCost + ` AS cost FROM subscriptions WHERE ` + conditions + `) AS matched
+		JOIN subscription_tags ON subscription_tags.subscription_id = matched.id
+		JOIN tags ON tags.id = subscription_tags.tag_id`
+	if len(tagIDs) > 0 {
+		query += fmt.Sprintf(" WHERE tags.id = ANY($%d)", len(args)+1)
+		args = append(args, int64Array(tagIDs))
+	}
+	query += " GROUP BY tags.id, tags.name ORDER BY lower(tags.name), tags.id"
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate cost by tag: %w", err)
+	}
+	defer rows.Close()
+
+	costs := []models.TagCost{}
+	for rows.Next() {
+		var cost models.TagCost
+		if err := rows.Scan(&cost.TagID, &cost.Name, &cost.TotalCost); err != nil {
+			return nil, fmt.Errorf("failed to scan tag cost: %w", err)
+		}
+		costs = append(costs, cost)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to calculate cost by tag: %w", err)
+	}
+
+	return costs, nil
+}
+
+// queryTags runs a query selecting tagColumns and scans every row
+func queryTags(ctx context.Context, q querier, query string, args ...interface{}) ([]*models.Tag, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []*models.Tag{}
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+// scanTag scans a row selected with tagColumns
+func scanTag(row rowScanner) (*models.Tag, error) {
+	var tag models.Tag
+	if err := row.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
@@ -0,0 +1,387 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"subscription-service/db"
+	"subscription-service/models"
+)
+
+// WebhookStore keeps webhook endpoints and the deliveries of events to them.
+// Both WebhookRepository and MockWebhookRepository implement it.
+type WebhookStore interface {
+	CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error
+	GetEndpoint(ctx context.Context, id int) (*models.WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context) ([]*models.WebhookEndpoint, error)
+	DeleteEndpoint(ctx context.Context, id int) error
+
+	// EnqueueEvent creates a pending delivery of event for every active endpoint
+	// subscribed to its type and returns the number of deliveries created. An
+	// endpoint that already has a delivery of the event is skipped.
+	EnqueueEvent(ctx context.Context, event *models.Event) (int, error)
+	// ClaimDueDeliveries returns up to limit pending deliveries whose next attempt
+	// is due and postpones them by lease, so that concurrent dispatchers skip them
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	// RecordAttempt stores the outcome of a delivery attempt
+	RecordAttempt(ctx context.Context, id int64, result models.DeliveryResult) error
+	ListDeliveries(ctx context.Context, filter *models.ListDeliveriesRequest) ([]*models.WebhookDelivery, int, error)
+	// Redeliver schedules a delivery for immediate sending with a fresh set of attempts
+	Redeliver(ctx context.Context, id int64) (*models.WebhookDelivery, error)
+}
+
+var (
+	_ WebhookStore = (*WebhookRepository)(nil)
+	_ WebhookStore = (*MockWebhookRepository)(nil)
+)
+
+// WebhookRepository handles database operations for webhooks
+type WebhookRepository struct {
+	db *db.PostgresDB
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *db.PostgresDB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// webhookEndpointColumns is the column list understood by scanWebhookEndpoint
+const webhookEndpointColumns = `id, url, events, secret, active, created_at`
+
+// webhookDeliveryColumns is the column list understood by scanWebhookDelivery
+const webhookDeliveryColumns = `id, endpoint_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_status_code, last_error, created_at, updated_at`
+
+// CreateEndpoint registers a webhook endpoint and fills in its ID and creation time
+func (r *WebhookRepository) CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	err = r.db.DB.QueryRowContext(ctx,
+		`INSERT INTO webhook_endpoints (url, events, secret, active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		endpoint.URL, pq.Array(endpoint.Events), endpoint.Secret, endpoint.Active,
+	).Scan(&endpoint.ID, &endpoint.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+
+	return nil
+}
+
+// GetEndpoint gets a webhook endpoint by ID
+func (r *WebhookRepository) GetEndpoint(ctx context.Context, id int) (_ *models.WebhookEndpoint, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	endpoint, err := scanWebhookEndpoint(r.db.DB.QueryRowContext(ctx,
+		`SELECT `+webhookEndpointColumns+` FROM webhook_endpoints WHERE id = $1`,
+		id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook endpoint: %w", err)
+	}
+
+	return endpoint, nil
+}
+
+// ListEndpoints gets all webhook endpoints
+func (r *WebhookRepository) ListEndpoints(ctx context.Context) (_ []*models.WebhookEndpoint, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	rows, err := r.db.DB.QueryContext(ctx, `SELECT `+webhookEndpointColumns+` FROM webhook_endpoints ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	endpoints := []*models.WebhookEndpoint{}
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook endpoint: %w", err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list webhook endpoints: %w", err)
+	}
+
+	return endpoints, nil
+}
+
+// DeleteEndpoint removes a webhook endpoint together with its deliveries
+func (r *WebhookRepository) DeleteEndpoint(ctx context.Context, id int) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	result, err := r.db.DB.ExecContext(ctx, "DELETE FROM webhook_endpoints WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// EnqueueEvent creates a pending delivery of event for every subscribed endpoint
+func (r *WebhookRepository) EnqueueEvent(ctx context.Context, event *models.Event) (_ int, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	result, err := r.db.DB.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT id, $1, $2, $3 FROM webhook_endpoints
+		WHERE active AND (cardinality(events) = 0 OR $2 = ANY(events))
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING`,
+		event.ID, event.Type, string(payload),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+
+	enqueued, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(enqueued), nil
+}
+
+// ClaimDueDeliveries locks due deliveries with SKIP LOCKED and postpones them by lease
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) (_ []*models.WebhookDelivery, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Batch)
+	defer func() { err = done(err) }()
+
+	rows, err := r.db.DB.QueryContext(ctx,
+		`UPDATE webhook_deliveries
+		SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+webhookDeliveryColumns,
+		limit, int64(lease/time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	return collectWebhookDeliveries(rows)
+}
+
+// RecordAttempt stores the outcome of a delivery attempt
+func (r *WebhookRepository) RecordAttempt(ctx context.Context, id int64, result models.DeliveryResult) (err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	status := models.DeliveryStatusPending
+	switch {
+	case result.Succeeded:
+		status = models.DeliveryStatusSucceeded
+	case result.NextAttemptAt == nil:
+		status = models.DeliveryStatusDead
+	}
+
+	var nextAttemptAt interface{}
+	if status == models.DeliveryStatusPending {
+		nextAttemptAt = *result.NextAttemptAt
+	}
+
+	var statusCode interface{}
+	if result.StatusCode != nil {
+		statusCode = *result.StatusCode
+	}
+
+	_, err = r.db.DB.ExecContext(ctx,
+		`UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, next_attempt_at = $2,
+			last_status_code = $3, last_error = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5`,
+		status, nextAttemptAt, statusCode, nullString(result.Error), id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery attempt: %w", err)
+	}
+
+	return nil
+}
+
+// ListDeliveries returns a page of deliveries matching the filter, newest first,
+// together with the total number of matching deliveries
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, filter *models.ListDeliveriesRequest) (_ []*models.WebhookDelivery, _ int, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Read)
+	defer func() { err = done(err) }()
+
+	whereConditions := []string{}
+	args := []interface{}{}
+	paramCounter := 1
+
+	if filter.EndpointID != nil {
+		whereConditions = append(whereConditions, fmt.Sprintf("endpoint_id = $%d", paramCounter))
+		args = append(args, *filter.EndpointID)
+		paramCounter++
+	}
+
+	if filter.Status != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf("status = $%d", paramCounter))
+		args = append(args, filter.Status)
+		paramCounter++
+	}
+
+	where := ""
+	if len(whereConditions) > 0 {
+		where = " WHERE " + strings.Join(whereConditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM webhook_deliveries"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count webhook deliveries: %w", err)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s FROM webhook_deliveries%s ORDER BY id DESC LIMIT $%d OFFSET $%d",
+		webhookDeliveryColumns, where, paramCounter, paramCounter+1,
+	)
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	deliveries, err := collectWebhookDeliveries(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, total, nil
+}
+
+// Redeliver schedules a delivery for immediate sending with a fresh set of attempts
+func (r *WebhookRepository) Redeliver(ctx context.Context, id int64) (_ *models.WebhookDelivery, err error) {
+	ctx, done := db.WithTimeout(ctx, r.db.Timeouts.Write)
+	defer func() { err = done(err) }()
+
+	delivery, err := scanWebhookDelivery(r.db.DB.QueryRowContext(ctx,
+		`UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+webhookDeliveryColumns,
+		id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to schedule webhook redelivery: %w", err)
+	}
+
+	return delivery, nil
+}
+
+// scanWebhookEndpoint scans a row selected with webhookEndpointColumns
+func scanWebhookEndpoint(row rowScanner) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+
+	err := row.Scan(
+		&endpoint.ID,
+		&endpoint.URL,
+		pq.Array(&endpoint.Events),
+		&endpoint.Secret,
+		&endpoint.Active,
+		&endpoint.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &endpoint, nil
+}
+
+// scanWebhookDelivery scans a row selected with webhookDeliveryColumns
+func scanWebhookDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var payload []byte
+	var nextAttemptAt sql.NullTime
+	var lastStatusCode sql.NullInt64
+	var lastError sql.NullString
+
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.EndpointID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&nextAttemptAt,
+		&lastStatusCode,
+		&lastError,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Payload = payload
+	delivery.LastError = lastError.String
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if lastStatusCode.Valid {
+		code := int(lastStatusCode.Int64)
+		delivery.LastStatusCode = &code
+	}
+
+	return &delivery, nil
+}
+
+// collectWebhookDeliveries scans and closes rows selected with webhookDeliveryColumns
+func collectWebhookDeliveries(rows *sql.Rows) ([]*models.WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,228 @@
+// Package search matches free text against service names written in Latin or
+// Cyrillic letters. It mirrors the search over the subscriptions table in
+// PostgreSQL, which uses pg_trgm and full-text search, so that the in-memory
+// repository finds and ranks the same subscriptions.
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	// SimilarityThreshold is the similarity a fuzzy match needs, the default
+	// of pg_trgm.similarity_threshold
+	SimilarityThreshold = 0.3
+	// WordSimilarityThreshold is the word similarity a fuzzy match needs, the
+	// default of pg_trgm.word_similarity_threshold
+	WordSimilarityThreshold = 0.6
+)
+
+// cyrillic spells the lowercase Cyrillic letters in Latin ones
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "",
+	'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// word is a word of a text together with its normalized spelling
+type word struct {
+	start, end int // Byte offsets in the text
+	normalized string
+}
+
+// Normalize lowercases text, spells Cyrillic letters in Latin ones and reduces
+// it to words of letters and digits separated by single spaces. It does what
+// the translit function of the database does to fill the search_name column.
+// "x" is spelled "ks", so that "Yandex" and "Яндекс" are spelled alike.
+func Normalize(text string) string {
+	words := []string{}
+	for _, w := range splitWords(text) {
+		words = append(words, w.normalized)
+	}
+	return strings.Join(words, " ")
+}
+
+// splitWords splits text into runs of letters and digits; words that
+// normalize to nothing, such as a lone soft sign, are left out
+func splitWords(text string) []word {
+	var words []word
+	var current strings.Builder
+	start := -1
+
+	flush := func(end int) {
+		if start >= 0 && current.Len() > 0 {
+			words = append(words, word{start: start, end: end, normalized: current.String()})
+		}
+		current.Reset()
+		start = -1
+	}
+
+	for i, r := range text {
+		latin, ok := normalizeRune(r)
+		if !ok {
+			flush(i)
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		current.WriteString(latin)
+	}
+	flush(len(text))
+
+	return words
+}
+
+// normalizeRune spells r in lowercase Latin letters and digits; ok is false
+// for runes that separate words
+func normalizeRune(r rune) (latin string, ok bool) {
+	r = unicode.ToLower(r)
+	switch {
+	case r == 'x':
+		return "ks", true
+	case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		return string(r), true
+	}
+	latin, ok = cyrillic[r]
+	return latin, ok
+}
+
+// trigrams returns the trigrams of the words of a normalized text the way
+// pg_trgm forms them: each word is padded with two spaces in front and one
+// behind
+func trigrams(text string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(text) {
+		padded := "  " + w + " "
+		for i := 0; i+3 <= len(padded); i++ {
+			set[padded[i:i+3]] = true
+		}
+	}
+	return set
+}
+
+// Similarity is the share of the trigrams of the normalized texts a and b that
+// both have, like similarity of pg_trgm
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+// WordSimilarity is the share of the trigrams of the normalized query that the
+// normalized text has. Like word_similarity of pg_trgm, which it approximates,
+// it is high when the query matches a part of the text.
+func WordSimilarity(query, text string) float64 {
+	tq, tt := trigrams(query), trigrams(text)
+	if len(tq) == 0 {
+		return 0
+	}
+
+	found := 0
+	for t := range tq {
+		if tt[t] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(tq))
+}
+
+// PrefixMatch reports whether every word of the normalized query starts a word
+// of the normalized text, as the full-text query built by PrefixQuery does
+func PrefixMatch(query, text string) bool {
+	queryWords := strings.Fields(query)
+	if len(queryWords) == 0 {
+		return false
+	}
+
+	textWords := strings.Fields(text)
+	for _, q := range queryWords {
+		if !startsAny(textWords, q) {
+			return false
+		}
+	}
+	return true
+}
+
+// startsAny reports whether prefix starts one of words
+func startsAny(words []string, prefix string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrefixQuery returns the tsquery that matches texts with a word starting
+// with each word of the normalized query, e.g. "yandeks:* & plyus:*".
+// Normalized words hold only letters and digits, so it needs no quoting.
+func PrefixQuery(query string) string {
+	words := strings.Fields(query)
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// Score ranks how well the normalized text matches the normalized query,
+// from 0 to 1, where 0 is no match. A prefix match scores 1, fuzzy matches
+// their similarity.
+func Score(query, text string) float64 {
+	if PrefixMatch(query, text) {
+		return 1
+	}
+
+	similarity, wordSimilarity := Similarity(query, text), WordSimilarity(query, text)
+	if similarity < SimilarityThreshold && wordSimilarity < WordSimilarityThreshold {
+		return 0
+	}
+	return max(similarity, wordSimilarity)
+}
+
+// Highlight returns text with the words that match query, which need not be
+// normalized, wrapped in <b> and </b> like ts_headline does. The rest of the
+// text is HTML-escaped.
+func Highlight(text, query string) string {
+	queryWords := strings.Fields(Normalize(query))
+
+	var out strings.Builder
+	last := 0
+	for _, w := range splitWords(text) {
+		if !matchesWord(w.normalized, queryWords) {
+			continue
+		}
+		out.WriteString(html.EscapeString(text[last:w.start]))
+		out.WriteString("<b>")
+		out.WriteString(html.EscapeString(text[w.start:w.end]))
+		out.WriteString("</b>")
+		last = w.end
+	}
+	out.WriteString(html.EscapeString(text[last:]))
+
+	return out.String()
+}
+
+// matchesWord reports whether one of the query words starts the normalized
+// word or is similar to it
+func matchesWord(normalized string, queryWords []string) bool {
+	for _, q := range queryWords {
+		if strings.HasPrefix(normalized, q) || Similarity(q, normalized) >= SimilarityThreshold {
+			return true
+		}
+	}
+	return false
+}
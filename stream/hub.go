@@ -0,0 +1,182 @@
+// Package stream fans subscription events out to Server-Sent Events clients.
+package stream
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"subscription-service/models"
+)
+
+// subscriberBuffer is how many events a client may fall behind before it is disconnected
+const subscriberBuffer = 64
+
+// defaultBufferSize is used when the configured replay buffer size is not positive
+const defaultBufferSize = 1024
+
+// Event is a subscription event as sent to clients
+type Event struct {
+	ID     int64 // The outbox ID, which is the same on every replica
+	Type   string
+	UserID uuid.UUID
+	Data   json.RawMessage // The encoded models.Event
+}
+
+// Subscriber receives the events of one user. Events is closed when the
+// subscriber falls too far behind; the client should reconnect with Last-Event-ID.
+type Subscriber struct {
+	Events <-chan *Event
+	events chan *Event
+	userID uuid.UUID
+}
+
+// Hub keeps the latest events in a bounded replay buffer and passes new ones
+// on to the subscribers of their user
+type Hub struct {
+	mutex       sync.Mutex
+	buffer      []*Event // Ring buffer ordered by arrival
+	next        int      // Position of the next event in buffer
+	full        bool
+	subscribers map[*Subscriber]struct{}
+	closed      bool
+}
+
+// NewHub creates a hub that can replay the last size events
+func NewHub(size int) *Hub {
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+
+	return &Hub{
+		buffer:      make([]*Event, size),
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+// Publish adds an outbox event to the replay buffer and sends it to subscribers.
+// Events already in the buffer are ignored, so a feed may deliver an event twice.
+func (h *Hub) Publish(outboxEvent *models.OutboxEvent) {
+	if outboxEvent.AggregateType != models.OutboxAggregateSubscription {
+		return
+	}
+
+	var decoded models.Event
+	if err := json.Unmarshal(outboxEvent.Payload, &decoded); err != nil || decoded.Data == nil {
+		return
+	}
+
+	event := &Event{
+		ID:     outboxEvent.ID,
+		Type:   outboxEvent.EventType,
+		UserID: decoded.Data.UserID,
+		Data:   outboxEvent.Payload,
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, buffered := range h.buffered() {
+		if buffered.ID == event.ID {
+			return
+		}
+	}
+
+	h.buffer[h.next] = event
+	h.next = (h.next + 1) % len(h.buffer)
+	if h.next == 0 {
+		h.full = true
+	}
+
+	for subscriber := range h.subscribers {
+		if subscriber.userID != event.UserID {
+			continue
+		}
+
+		select {
+		case subscriber.events <- event:
+		default:
+			// Never block publishing on a slow client
+			delete(h.subscribers, subscriber)
+			close(subscriber.events)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for the events of userID and returns the
+// buffered events that followed lastEventID; a lastEventID of 0 replays nothing
+func (h *Hub) Subscribe(userID uuid.UUID, lastEventID int64) (*Subscriber, []*Event) {
+	events := make(chan *Event, subscriberBuffer)
+	subscriber := &Subscriber{Events: events, events: events, userID: userID}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var replay []*Event
+	if lastEventID > 0 {
+		buffered := h.buffered()
+
+		// Resume after the last event the client saw; if it has left the buffer
+		// every buffered event newer than it is replayed
+		start := -1
+		for i, event := range buffered {
+			if event.ID == lastEventID {
+				start = i + 1
+				break
+			}
+		}
+
+		for i, event := range buffered {
+			if event.UserID != userID {
+				continue
+			}
+			if (start >= 0 && i >= start) || (start < 0 && event.ID > lastEventID) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	if h.closed {
+		close(events)
+		return subscriber, replay
+	}
+	h.subscribers[subscriber] = struct{}{}
+
+	return subscriber, replay
+}
+
+// Unsubscribe removes a subscriber
+func (h *Hub) Unsubscribe(subscriber *Subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.subscribers[subscriber]; ok {
+		delete(h.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
+
+// Close disconnects every subscriber, and any that subscribes later at once,
+// so that open streams end when the server shuts down
+func (h *Hub) Close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.closed = true
+	for subscriber := range h.subscribers {
+		delete(h.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
+
+// buffered returns the buffered events oldest first; the caller must hold the lock
+func (h *Hub) buffered() []*Event {
+	if !h.full {
+		return h.buffer[:h.next]
+	}
+
+	events := make([]*Event, 0, len(h.buffer))
+	events = append(events, h.buffer[h.next:]...)
+	return append(events, h.buffer[:h.next]...)
+}
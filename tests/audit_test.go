@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/models"
+)
+
+func TestAuditLogRecordsMutations(t *testing.T) {
+	r := setupTestRouter()
+
+	// Create a subscription on behalf of an actor
+	subscription := models.CreateSubscriptionRequest{
+		ServiceName: "Netflix",
+		Price:       599,
+		UserID:      uuid.New(),
+		StartDate:   "01-2024",
+	}
+
+	jsonValue, _ := json.Marshal(subscription)
+	req, _ := http.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Actor", "alice")
+	req.Header.Set("X-Request-ID", "req-1")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var created models.Subscription
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	// Change the price, then delete it
+	req, _ = http.NewRequest("PATCH", fmt.Sprintf("/api/v1/subscriptions/%d", created.ID), bytes.NewBufferString(`{"price": 699}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("X-Actor", "bob")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/v1/subscriptions/%d", created.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// All three changes are listed, newest first
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/v1/audit?entity_id=%d", created.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var page models.ListAuditResponse
+	err := json.Unmarshal(w.Body.Bytes(), &page)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	if assert.Len(t, page.Items, 3) {
+		assert.Equal(t, models.AuditActionDelete, page.Items[0].Action)
+		assert.Equal(t, "anonymous", page.Items[0].Actor)
+
+		update := page.Items[1]
+		assert.Equal(t, models.AuditActionUpdate, update.Action)
+		assert.Equal(t, "bob", update.Actor)
+		assert.Equal(t, models.FieldChange{From: float64(599), To: float64(699)}, update.Changes["price"])
+
+		create := page.Items[2]
+		assert.Equal(t, models.AuditActionCreate, create.Action)
+		assert.Equal(t, "alice", create.Actor)
+		assert.Equal(t, "req-1", create.RequestID)
+		assert.Empty(t, create.Before)
+	}
+
+	// Filters and pagination apply
+	req, _ = http.NewRequest("GET", "/api/v1/audit?actor=bob&limit=1", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	err = json.Unmarshal(w.Body.Bytes(), &page)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, page.Total)
+	assert.Len(t, page.Items, 1)
+
+	req, _ = http.NewRequest("GET", "/api/v1/audit?action=rename", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/budgets"
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/notify"
+	"subscription-service/repository"
+)
+
+// recordingNotifier keeps the messages it is asked to send, or fails with err
+type recordingNotifier struct {
+	messages []*notify.Message
+	err      error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, message *notify.Message) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func createBudget(t *testing.T, r *gin.Engine, req models.CreateBudgetRequest) models.Budget {
+	w := postJSON(r, "/api/v1/budgets", req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var budget models.Budget
+	json.Unmarshal(w.Body.Bytes(), &budget)
+	return budget
+}
+
+func budgetStatus(t *testing.T, r *gin.Engine, id int, month string) models.BudgetStatus {
+	w := sendRequest(r, "GET", fmt.Sprintf("/api/v1/budgets/%d/status?month=%s", id, month))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var status models.BudgetStatus
+	json.Unmarshal(w.Body.Bytes(), &status)
+	return status
+}
+
+func TestBudgets(t *testing.T) {
+	r := setupTestRouter()
+
+	video, music := "video", "music"
+	var netflix, spotify models.Service
+	json.Unmarshal(postJSON(r, "/api/v1/services", models.CreateServiceRequest{Name: "Netflix", Category: &video}).Body.Bytes(), &netflix)
+	json.Unmarshal(postJSON(r, "/api/v1/services", models.CreateServiceRequest{Name: "Spotify", Category: &music}).Body.Bytes(), &spotify)
+
+	userID := uuid.New()
+	for _, sub := range []models.CreateSubscriptionRequest{
+		{UserID: userID, ServiceName: "Netflix", Price: 600},
+		{UserID: userID, ServiceName: "Spotify", Price: 300},
+		{UserID: userID, ServiceName: "Kinopoisk", Price: 100},
+		{UserID: uuid.New(), ServiceName: "Netflix", Price: 600},
+	} {
+		sub.StartDate = "01-2024"
+		assert.Equal(t, http.StatusCreated, postJSON(r, "/api/v1/subscriptions", sub).Code)
+	}
+
+	overall := createBudget(t, r, models.CreateBudgetRequest{UserID: userID, UpdateBudgetRequest: models.UpdateBudgetRequest{
+		Scope: models.BudgetScopeOverall, Amount: 1000, Channel: models.NotifyChannelLog,
+	}})
+	assert.Equal(t, []int{}, overall.Thresholds)
+	videoBudget := createBudget(t, r, models.CreateBudgetRequest{UserID: userID, UpdateBudgetRequest: models.UpdateBudgetRequest{
+		Scope: models.BudgetScopeCategory, Category: &video, Amount: 500, Thresholds: []int{50}, Channel: models.NotifyChannelLog,
+	}})
+	spotifyBudget := createBudget(t, r, models.CreateBudgetRequest{UserID: userID, UpdateBudgetRequest: models.UpdateBudgetRequest{
+		Scope: models.BudgetScopeService, ServiceID: &spotify.ID, Amount: 1000, Channel: models.NotifyChannelLog,
+	}})
+
+	// Spend is the cost of the month of the subscriptions in scope, and the
+	// configured thresholds apply to budgets without their own
+	status := budgetStatus(t, r, overall.ID, "03-2024")
+	assert.Equal(t, 1000, status.Spend)
+	assert.Equal(t, 0, status.Remaining)
+	assert.Equal(t, 100, status.PercentUsed)
+	assert.False(t, status.Exceeded)
+	assert.Equal(t, []int{80, 100}, status.Thresholds)
+	assert.Equal(t, []int{80, 100}, status.Reached)
+
+	status = budgetStatus(t, r, videoBudget.ID, "03-2024")
+	assert.Equal(t, 600, status.Spend)
+	assert.Equal(t, -100, status.Remaining)
+	assert.Equal(t, 120, status.PercentUsed)
+	assert.True(t, status.Exceeded)
+	assert.Equal(t, []int{50}, status.Reached)
+
+	status = budgetStatus(t, r, spotifyBudget.ID, "03-2024")
+	assert.Equal(t, 300, status.Spend)
+	assert.Equal(t, []int{}, status.Reached)
+
+	status = budgetStatus(t, r, overall.ID, "12-2023")
+	assert.Equal(t, 0, status.Spend)
+
+	// Months compare by time across years
+	end := "01-2025"
+	assert.Equal(t, http.StatusCreated, postJSON(r, "/api/v1/subscriptions", models.CreateSubscriptionRequest{
+		UserID: userID, ServiceName: "Okko", Price: 50, StartDate: "06-2024", EndDate: &end,
+	}).Code)
+	assert.Equal(t, 1050, budgetStatus(t, r, overall.ID, "01-2025").Spend)
+	assert.Equal(t, 1000, budgetStatus(t, r, overall.ID, "02-2025").Spend)
+
+	assert.Equal(t, http.StatusBadRequest, sendRequest(r, "GET", fmt.Sprintf("/api/v1/budgets/%d/status?month=2024-03", overall.ID)).Code)
+	assert.Equal(t, http.StatusNotFound, sendRequest(r, "GET", "/api/v1/budgets/999/status").Code)
+
+	// Invalid budgets are rejected
+	missing := 999
+	for _, req := range []models.UpdateBudgetRequest{
+		{Scope: "weekly", Amount: 100, Channel: models.NotifyChannelLog},
+		{Scope: models.BudgetScopeOverall, Amount: 0, Channel: models.NotifyChannelLog},
+		{Scope: models.BudgetScopeOverall, Category: &video, Amount: 100, Channel: models.NotifyChannelLog},
+		{Scope: models.BudgetScopeCategory, Amount: 100, Channel: models.NotifyChannelLog},
+		{Scope: models.BudgetScopeService, ServiceID: &missing, Amount: 100, Channel: models.NotifyChannelLog},
+		{Scope: models.BudgetScopeOverall, Amount: 100, Thresholds: []int{100, 80}, Channel: models.NotifyChannelLog},
+		{Scope: models.BudgetScopeOverall, Amount: 100, Channel: models.NotifyChannelWebhook},
+	} {
+		w := postJSON(r, "/api/v1/budgets", models.CreateBudgetRequest{UserID: userID, UpdateBudgetRequest: req})
+		assert.Equal(t, http.StatusBadRequest, w.Code, "%+v", req)
+	}
+
+	// Updating replaces the budget
+	w := putJSON(r, fmt.Sprintf("/api/v1/budgets/%d", spotifyBudget.ID), models.UpdateBudgetRequest{
+		Scope: models.BudgetScopeCategory, Category: &music, Amount: 200, Channel: models.NotifyChannelLog,
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	status = budgetStatus(t, r, spotifyBudget.ID, "03-2024")
+	assert.Equal(t, 300, status.Spend)
+	assert.True(t, status.Exceeded)
+	assert.Equal(t, http.StatusNotFound, putJSON(r, "/api/v1/budgets/999", models.UpdateBudgetRequest{
+		Scope: models.BudgetScopeOverall, Amount: 100, Channel: models.NotifyChannelLog,
+	}).Code)
+
+	w = sendRequest(r, "GET", "/api/v1/budgets?user_id="+userID.String())
+	var list []models.Budget
+	json.Unmarshal(w.Body.Bytes(), &list)
+	assert.Len(t, list, 3)
+	assert.Equal(t, http.StatusBadRequest, sendRequest(r, "GET", "/api/v1/budgets?user_id=abc").Code)
+
+	assert.Equal(t, http.StatusNoContent, sendRequest(r, "DELETE", fmt.Sprintf("/api/v1/budgets/%d", overall.ID)).Code)
+	assert.Equal(t, http.StatusNotFound, sendRequest(r, "GET", fmt.Sprintf("/api/v1/budgets/%d", overall.ID)).Code)
+	assert.Equal(t, http.StatusNotFound, sendRequest(r, "DELETE", fmt.Sprintf("/api/v1/budgets/%d", overall.ID)).Code)
+}
+
+func TestBudgetAlerts(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMockSubscriptionRepository()
+	notifier := &recordingNotifier{}
+	evaluator := budgets.NewEvaluator(repo, notifier, config.BudgetsConfig{Thresholds: []int{80, 100}}, logger.NewLogger())
+
+	userID := uuid.New()
+	subscribe := func(price int) {
+		_, err := repo.Create(ctx, &models.CreateSubscriptionRequest{
+			UserID: userID, ServiceName: "Netflix", Price: price, StartDate: budgets.CurrentMonth(),
+		}, models.AuditInfo{})
+		assert.NoError(t, err)
+	}
+
+	budget, err := repo.CreateBudget(ctx, &models.CreateBudgetRequest{UserID: userID, UpdateBudgetRequest: models.UpdateBudgetRequest{
+		Scope: models.BudgetScopeOverall, Amount: 1000, Channel: models.NotifyChannelEmail, Target: "user@example.com",
+	}})
+	assert.NoError(t, err)
+
+	// Nothing is sent below the lowest threshold
+	subscribe(500)
+	assert.NoError(t, evaluator.Run(ctx))
+	assert.Empty(t, notifier.messages)
+
+	// Each threshold alerts once
+	subscribe(350)
+	assert.NoError(t, evaluator.Run(ctx))
+	assert.NoError(t, evaluator.Run(ctx))
+	if assert.Len(t, notifier.messages, 1) {
+		assert.Equal(t, models.NotifyChannelEmail, notifier.messages[0].Channel)
+		assert.Equal(t, "user@example.com", notifier.messages[0].Target)
+		assert.Equal(t, 80, notifier.messages[0].Payload.(budgets.Payload).Threshold)
+	}
+
+	// An alert that cannot be sent is sent by the next evaluation
+	subscribe(200)
+	notifier.err = errors.New("smtp unavailable")
+	assert.NoError(t, evaluator.Run(ctx))
+	notifier.err = nil
+	assert.NoError(t, evaluator.Run(ctx))
+	if assert.Len(t, notifier.messages, 2) {
+		payload := notifier.messages[1].Payload.(budgets.Payload)
+		assert.Equal(t, 100, payload.Threshold)
+		assert.True(t, payload.Status.Exceeded)
+		assert.Contains(t, notifier.messages[1].Subject, "exceeded")
+	}
+
+	// Updating a budget re-arms its thresholds; the highest reached one is sent
+	_, err = repo.UpdateBudget(ctx, budget.ID, &models.UpdateBudgetRequest{
+		Scope: models.BudgetScopeOverall, Amount: 1000, Thresholds: []int{50, 90}, Channel: models.NotifyChannelLog,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, evaluator.Run(ctx))
+	if assert.Len(t, notifier.messages, 3) {
+		assert.Equal(t, 90, notifier.messages[2].Payload.(budgets.Payload).Threshold)
+	}
+	assert.NoError(t, evaluator.Run(ctx))
+	assert.Len(t, notifier.messages, 3)
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/config"
+)
+
+// writeFile writes content to a file in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  host: file-host
+  port: 9000
+  read_timeout: 20s
+database:
+  host: file-db
+log:
+  format: json
+`)
+	t.Setenv("SERVER_PORT", "9001")
+	t.Setenv("DB_HOST", "env-db")
+
+	cfg, err := config.LoadConfig(&config.Flags{ConfigPath: path})
+	assert.NoError(t, err)
+	assert.Equal(t, "file-host", cfg.Server.Host)
+	assert.Equal(t, 20*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, "9001", cfg.Server.Port)
+	assert.Equal(t, "env-db", cfg.Database.Host)
+	assert.Equal(t, 5*time.Second, cfg.Server.ReadHeaderTimeout)
+	assert.Equal(t, "json", cfg.Log.Format)
+
+	flags, err := config.ParseFlags([]string{"--config", path, "--port", "9002", "--log-format", "text"}, &bytes.Buffer{})
+	assert.NoError(t, err)
+	cfg, err = config.LoadConfig(flags)
+	assert.NoError(t, err)
+	assert.Equal(t, "9002", cfg.Server.Port)
+	assert.Equal(t, "text", cfg.Log.Format)
+
+	// A config file given explicitly must exist
+	_, err = config.LoadConfig(&config.Flags{ConfigPath: filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.Error(t, err)
+}
+
+func TestConfigSecretFiles(t *testing.T) {
+	t.Setenv("CONFIG_PATH", filepath.Join(t.TempDir(), "none.yaml"))
+	t.Setenv("DB_PASSWORD", "")
+	t.Setenv("DB_PASSWORD_FILE", writeFile(t, "db_password", "s3cret\n"))
+
+	cfg, err := config.LoadConfig(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", cfg.Database.Password)
+
+	t.Setenv("DB_PASSWORD", "other")
+	_, err = config.LoadConfig(nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "DB_PASSWORD and DB_PASSWORD_FILE are both set")
+	}
+}
+
+func TestConfigValidationReportsEveryError(t *testing.T) {
+	t.Setenv("CONFIG_PATH", filepath.Join(t.TempDir(), "none.yaml"))
+	t.Setenv("SERVER_PORT", "70000")
+	t.Setenv("DB_SSLMODE", "prefer")
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_USERNAME", "mailer")
+	t.Setenv("DB_READ_TIMEOUT", "-1s")
+	t.Setenv("DB_TX_ISOLATION", "snapshot")
+	t.Setenv("LOG_FORMAT", "logfmt")
+
+	_, err := config.LoadConfig(nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `server.port: "70000" is not a port`)
+		assert.Contains(t, err.Error(), `database.sslmode: "prefer" is not one of`)
+		assert.Contains(t, err.Error(), "smtp.password: is required")
+		assert.Contains(t, err.Error(), "database.query_timeouts.read: must not be negative")
+		assert.Contains(t, err.Error(), `database.tx_isolation: "snapshot" is not one of`)
+		assert.Contains(t, err.Error(), `log.format: "logfmt" is not one of text or json`)
+	}
+
+	// Values that do not parse are reported rather than ignored
+	t.Setenv("SERVER_PORT", "8080")
+	t.Setenv("WEBHOOK_BATCH_SIZE", "many")
+	t.Setenv("PURGE_INTERVAL", "hourly")
+	_, err = config.LoadConfig(nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `WEBHOOK_BATCH_SIZE: "many" is not an integer`)
+		assert.Contains(t, err.Error(), `PURGE_INTERVAL: "hourly" is not a duration`)
+	}
+}
+
+func TestConfigPrintRedactsSecrets(t *testing.T) {
+	cfg := config.Default()
+	cfg.SMTP.Password = "mail-secret"
+
+	var out bytes.Buffer
+	assert.NoError(t, cfg.Print(&out))
+	assert.NotContains(t, out.String(), "mail-secret")
+	assert.Contains(t, out.String(), "password: '[REDACTED]'")
+	assert.Contains(t, out.String(), "read_timeout: 15s")
+
+	// The configuration itself is left alone
+	assert.Equal(t, "postgres", cfg.Database.Password)
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/health"
+	"subscription-service/logger"
+	"subscription-service/workers"
+)
+
+func probe(t *testing.T, r *gin.Engine, path string) (int, health.Response) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+	var response health.Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return w.Code, response
+}
+
+func TestHealthProbes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var databaseErr error
+	checker := health.NewChecker(50 * time.Millisecond)
+	checker.Register("database", func(ctx context.Context) error { return databaseErr })
+	checker.Register("migrations", func(ctx context.Context) error { return nil })
+
+	r := gin.New()
+	r.GET("/livez", checker.Liveness)
+	r.GET("/readyz", checker.Readiness)
+
+	code, response := probe(t, r, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOK, response.Status)
+	assert.Equal(t, health.StatusOK, response.Checks["database"].Status)
+	assert.Equal(t, health.StatusOK, response.Checks["migrations"].Status)
+
+	// A failing dependency fails readiness but not liveness
+	databaseErr = errors.New("connection refused")
+	code, response = probe(t, r, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusUnavailable, response.Status)
+	assert.Equal(t, health.CheckResult{Status: health.StatusFailing, Error: "connection refused", DurationMS: response.Checks["database"].DurationMS}, response.Checks["database"])
+	assert.Equal(t, health.StatusOK, response.Checks["migrations"].Status)
+
+	code, response = probe(t, r, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOK, response.Status)
+
+	// A check that hangs times out
+	databaseErr = nil
+	release := make(chan struct{})
+	defer close(release)
+	checker.Register("broker", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	code, response = probe(t, r, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, context.DeadlineExceeded.Error(), response.Checks["broker"].Error)
+}
+
+func TestReadinessFailsDuringShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	checker := health.NewChecker(time.Second)
+	r := gin.New()
+	r.GET("/readyz", checker.Readiness)
+
+	code, _ := probe(t, r, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+
+	checker.SetShuttingDown()
+	code, response := probe(t, r, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusFailing, response.Checks["shutdown"].Status)
+}
+
+func TestWorkerGroupCheck(t *testing.T) {
+	group := workers.NewGroup(logger.NewLogger())
+	group.Go("relay", func(ctx context.Context) { <-ctx.Done() })
+	assert.NoError(t, group.Check(context.Background()))
+
+	// A worker returning on its own is reported until it is restarted
+	group.Go("event-feed", func(ctx context.Context) {})
+	assert.Eventually(t, func() bool { return group.Check(context.Background()) != nil }, time.Second, time.Millisecond)
+	assert.Contains(t, group.Check(context.Background()).Error(), "event-feed")
+
+	// Workers stopped on purpose are not
+	assert.NoError(t, group.Stop(context.Background()))
+	err := group.Check(context.Background())
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "relay")
+	}
+}
+
+func TestWorkerGroupRestartsWorkers(t *testing.T) {
+	group := workers.NewGroup(logger.NewLogger())
+	defer group.Stop(context.Background())
+
+	// The event feed gives up once and then keeps running
+	var runs atomic.Int32
+	group.Go("event-feed", func(ctx context.Context) {
+		if runs.Add(1) == 1 {
+			return
+		}
+		<-ctx.Done()
+	})
+
+	assert.Eventually(t, func() bool { return group.Check(context.Background()) != nil }, time.Second, time.Millisecond)
+
+	// Readiness recovers once the worker runs again
+	assert.Eventually(t, func() bool { return group.Check(context.Background()) == nil }, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), runs.Load())
+}
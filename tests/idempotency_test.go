@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/handlers"
+	"subscription-service/logger"
+	"subscription-service/middleware"
+	"subscription-service/models"
+	"subscription-service/repository"
+)
+
+func setupIdempotencyRouter(store repository.IdempotencyStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	log := logger.NewLogger()
+	handler := handlers.NewSubscriptionHandler(repository.NewMockSubscriptionRepository(), log)
+
+	r := gin.Default()
+	r.POST("/api/v1/subscriptions", middleware.Idempotency(store, time.Hour, log), handler.Create)
+
+	return r
+}
+
+func postWithKey(r *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.IdempotencyKeyHeader, key)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestIdempotentCreate(t *testing.T) {
+	store := repository.NewMockIdempotencyRepository()
+	r := setupIdempotencyRouter(store)
+
+	body := `{"service_name": "Netflix", "price": 599, "user_id": "60601fee-2bf1-4721-ae6f-7636e79a0cba", "start_date": "01-2024"}`
+
+	// First request creates the subscription
+	w := postWithKey(r, "create-1", body)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(middleware.IdempotentReplayedHeader))
+
+	var created models.Subscription
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	// A retry with reordered fields replays the stored response
+	retry := `{"start_date": "01-2024", "user_id": "60601fee-2bf1-4721-ae6f-7636e79a0cba", "price": 599, "service_name": "Netflix"}`
+	w = postWithKey(r, "create-1", retry)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, fmt.Sprintf("%q", fmt.Sprint(created.Version)), w.Header().Get("ETag"))
+
+	var replayed models.Subscription
+	json.Unmarshal(w.Body.Bytes(), &replayed)
+	assert.Equal(t, created.ID, replayed.ID)
+
+	// Reusing the key for another request is rejected
+	w = postWithKey(r, "create-1", `{"service_name": "Spotify", "price": 199, "user_id": "60601fee-2bf1-4721-ae6f-7636e79a0cba", "start_date": "01-2024"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestIdempotencyKeyInProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+
+	// The first request blocks until the second one has been answered
+	r := gin.Default()
+	r.POST("/api/v1/subscriptions", middleware.Idempotency(repository.NewMockIdempotencyRepository(), time.Hour, logger.NewLogger()), func(c *gin.Context) {
+		close(started)
+		<-finish
+		c.JSON(http.StatusCreated, gin.H{"id": 1})
+	})
+
+	body := `{"service_name": "Netflix"}`
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() {
+		first <- postWithKey(r, "create-2", body)
+	}()
+	<-started
+
+	w := postWithKey(r, "create-2", body)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(finish)
+	assert.Equal(t, http.StatusCreated, (<-first).Code)
+}
+
+func TestIdempotentClientErrorIsReplayed(t *testing.T) {
+	r := setupIdempotencyRouter(repository.NewMockIdempotencyRepository())
+
+	// Client errors are stored and replayed like any other response
+	w := postWithKey(r, "invalid-1", `{"service_name": "Netflix"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postWithKey(r, "invalid-1", `{"service_name": "Netflix"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "true", w.Header().Get(middleware.IdempotentReplayedHeader))
+}
+
+// cancellingRepository fails its next units of work as if the client had gone away
+type cancellingRepository struct {
+	repository.Repository
+	cancels int
+}
+
+func (r *cancellingRepository) WithTx(ctx context.Context, fn func(tx repository.Repository) error) error {
+	if r.cancels > 0 {
+		r.cancels--
+		return context.Canceled
+	}
+	return r.Repository.WithTx(ctx, fn)
+}
+
+func TestIdempotentCancelledRequestIsRetried(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	log := logger.NewLogger()
+	handler := handlers.NewSubscriptionHandler(&cancellingRepository{Repository: repository.NewMockSubscriptionRepository(), cancels: 1}, log)
+
+	r := gin.New()
+	r.POST("/api/v1/subscriptions", middleware.Idempotency(repository.NewMockIdempotencyRepository(), time.Hour, log), handler.Create)
+
+	body := `{"service_name": "Netflix", "price": 599, "user_id": "60601fee-2bf1-4721-ae6f-7636e79a0cba", "start_date": "01-2024"}`
+
+	// The client gave up on the first attempt, so its outcome is not stored
+	w := postWithKey(r, "cancelled-1", body)
+	assert.Equal(t, middleware.StatusClientClosedRequest, w.Code)
+
+	w = postWithKey(r, "cancelled-1", body)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(middleware.IdempotentReplayedHeader))
+}
+
+func TestIdempotencyReservationIsOwned(t *testing.T) {
+	store := repository.NewMockIdempotencyRepository()
+	ctx := context.Background()
+
+	reservation, reserved, err := store.Reserve(ctx, "owned-1", "fingerprint", time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+
+	// A request whose reservation was taken over can neither store its
+	// response nor release the key of the request that took it
+	stale := reservation.CreatedAt.Add(-2 * time.Minute)
+	err = store.Complete(ctx, "owned-1", stale, http.StatusCreated, nil, []byte(`{"id":1}`))
+	assert.ErrorIs(t, err, repository.ErrReservationLost)
+	assert.NoError(t, store.Release(ctx, "owned-1", stale))
+
+	record, reserved, err := store.Reserve(ctx, "owned-1", "fingerprint", time.Hour)
+	assert.NoError(t, err)
+	assert.False(t, reserved)
+	assert.False(t, record.Completed)
+
+	assert.NoError(t, store.Complete(ctx, "owned-1", reservation.CreatedAt, http.StatusCreated, nil, []byte(`{"id":2}`)))
+
+	record, _, err = store.Reserve(ctx, "owned-1", "fingerprint", time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, record.Completed)
+	assert.Equal(t, `{"id":2}`, string(record.Body))
+}
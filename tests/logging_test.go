@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/handlers"
+	"subscription-service/logger"
+	"subscription-service/middleware"
+	"subscription-service/repository"
+)
+
+// decodeLogEntries parses JSON log output into one map per entry
+func decodeLogEntries(t *testing.T, output string) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRequestLogging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	log := logger.NewLogger()
+	log.SetOutput(&buf)
+	log.SetFormatter(&logrus.JSONFormatter{})
+
+	repo := repository.NewMockSubscriptionRepository()
+	handler := handlers.NewSubscriptionHandler(repo, log)
+	auditHandler := handlers.NewAuditHandler(repo, log)
+
+	r := gin.New()
+	r.Use(middleware.RequestID(), middleware.RequestLogger(log))
+	r.POST("/api/v1/subscriptions", handler.Create)
+	r.GET("/api/v1/audit", auditHandler.List)
+
+	// A caller-supplied request ID is kept and echoed back
+	body := `{"service_name":"Netflix","price":599,"user_id":"60601fee-2bf1-4721-ae6f-7636e79a0cba","start_date":"01-2024"}`
+	req := httptest.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBufferString(body))
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "req-42", w.Header().Get(middleware.RequestIDHeader))
+
+	entries := decodeLogEntries(t, buf.String())
+	if assert.Len(t, entries, 2) {
+		handlerEntry, final := entries[0], entries[1]
+		assert.Equal(t, "Created subscription with ID: 1", handlerEntry["msg"])
+		assert.Equal(t, "req-42", handlerEntry["request_id"])
+		assert.Equal(t, "/api/v1/subscriptions", handlerEntry["route"])
+		assert.Equal(t, "60601fee-2bf1-4721-ae6f-7636e79a0cba", handlerEntry["user_id"])
+
+		assert.Equal(t, "Request completed", final["msg"])
+		assert.Equal(t, "req-42", final["request_id"])
+		assert.Equal(t, "60601fee-2bf1-4721-ae6f-7636e79a0cba", final["user_id"])
+		assert.Equal(t, float64(http.StatusCreated), final["status"])
+		assert.Contains(t, final, "latency_ms")
+	}
+
+	// The ID is recorded in the audit log
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/audit?entity_id=1", nil))
+	assert.Contains(t, w.Body.String(), `"request_id":"req-42"`)
+
+	// Otherwise an ID is generated; unusable ones are replaced
+	buf.Reset()
+	req = httptest.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBufferString(`{}`))
+	req.Header.Set(middleware.RequestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	generated := w.Header().Get(middleware.RequestIDHeader)
+	assert.Len(t, generated, 36)
+
+	entries = decodeLogEntries(t, buf.String())
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, generated, entries[0]["request_id"])
+		assert.Equal(t, "Request rejected", entries[1]["msg"])
+		assert.Equal(t, "warning", entries[1]["level"])
+	}
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/handlers"
+	"subscription-service/logger"
+	"subscription-service/metrics"
+	"subscription-service/models"
+	"subscription-service/repository"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := sql.Open("postgres", "host=localhost dbname=unused sslmode=disable")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	log := logger.NewLogger()
+	repo := repository.NewMockSubscriptionRepository()
+	video := "video"
+	_, err = repo.CreateService(context.Background(), &models.CreateServiceRequest{Name: "Netflix", Category: &video})
+	assert.NoError(t, err)
+	serviceMetrics := metrics.New()
+	serviceMetrics.RegisterDBStats(db)
+	serviceMetrics.RegisterSubscriptionStats(repo)
+	handler := handlers.NewSubscriptionHandler(serviceMetrics.InstrumentRepository(repo), log)
+
+	r := gin.New()
+	r.Use(serviceMetrics.Middleware())
+	r.GET("/metrics", serviceMetrics.Handler(log))
+	r.POST("/api/v1/subscriptions", handler.Create)
+	r.GET("/api/v1/subscriptions/:id", handler.Get)
+
+	body := `{"service_name":"Netflix","price":599,"user_id":"60601fee-2bf1-4721-ae6f-7636e79a0cba","start_date":"01-2024"}`
+	other := `{"service_name":"Okko","price":299,"user_id":"60601fee-2bf1-4721-ae6f-7636e79a0cba","start_date":"01-2024"}`
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBufferString(body)),
+		httptest.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBufferString(other)),
+		httptest.NewRequest("GET", "/api/v1/subscriptions/1", nil),
+		httptest.NewRequest("GET", "/api/v1/subscriptions/3", nil),
+		httptest.NewRequest("GET", "/missing", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+
+	exposition := w.Body.String()
+	assert.Contains(t, exposition, "# TYPE http_requests_total counter\n")
+	assert.Contains(t, exposition, `http_requests_total{method="POST",route="/api/v1/subscriptions",status="201"} 2`)
+	assert.Contains(t, exposition, `http_requests_total{method="GET",route="/api/v1/subscriptions/:id",status="200"} 1`)
+	assert.Contains(t, exposition, `http_requests_total{method="GET",route="/api/v1/subscriptions/:id",status="404"} 1`)
+	assert.Contains(t, exposition, `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, exposition, "# TYPE http_request_duration_seconds histogram\n")
+	assert.Contains(t, exposition, `http_request_duration_seconds_bucket{method="POST",route="/api/v1/subscriptions",status="201",le="+Inf"} 2`)
+	assert.Contains(t, exposition, `repository_query_duration_seconds_count{operation="create",outcome="success"} 2`)
+	// A missing subscription is an expected outcome, not a failed query
+	assert.NotContains(t, exposition, `repository_query_duration_seconds_count{operation="get",outcome="error"}`)
+	// Subscription counts are labelled by catalog category, which keeps their series bounded
+	assert.Contains(t, exposition, "subscriptions_created_total 2\n")
+	assert.Contains(t, exposition, `subscriptions_active{category="video"} 1`)
+	assert.Contains(t, exposition, `subscriptions_active{category="uncategorized"} 1`)
+	assert.Contains(t, exposition, "# TYPE go_goroutines gauge\n")
+	assert.Contains(t, exposition, "db_open_connections 0\n")
+	assert.Contains(t, exposition, "# TYPE db_wait_count_total counter\n")
+}
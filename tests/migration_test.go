@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/config"
+	"subscription-service/db"
+	"subscription-service/logger"
+)
+
+// migrationTestDB connects to the scratch database named by TEST_DATABASE_URL
+// and empties it; tests that need one are skipped without it
+func migrationTestDB(t *testing.T) *db.PostgresDB {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	cfg := config.Default().Database
+	cfg.URL = url
+	cfg.ConnectTimeout = 5 * time.Second
+
+	postgres, err := db.NewPostgresDB(context.Background(), cfg, logger.NewLogger())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { postgres.Close() })
+
+	_, err = postgres.DB.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return postgres
+}
+
+func TestMigrationMapsBlankServiceNames(t *testing.T) {
+	postgres := migrationTestDB(t)
+
+	// Before the catalog a blank service name was accepted
+	assert.NoError(t, postgres.MigrateTo(10))
+	for _, name := range []string{"Netflix", "Netflix", " netflix ", "   "} {
+		_, err := postgres.DB.Exec(
+			`INSERT INTO subscriptions (service_name, price, user_id, start_date) VALUES ($1, 100, $2, '01-2024')`,
+			name, uuid.New(),
+		)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, postgres.RunMigrations())
+
+	rows, err := postgres.DB.Query(
+		`SELECT subscriptions.service_name, services.name FROM subscriptions
+		JOIN services ON services.id = subscriptions.service_id ORDER BY subscriptions.id`,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer rows.Close()
+
+	var names [][2]string
+	for rows.Next() {
+		var subscriptionName, serviceName string
+		assert.NoError(t, rows.Scan(&subscriptionName, &serviceName))
+		names = append(names, [2]string{subscriptionName, serviceName})
+	}
+	assert.NoError(t, rows.Err())
+
+	assert.Equal(t, [][2]string{
+		{"Netflix", "Netflix"},
+		{"Netflix", "Netflix"},
+		{"Netflix", "Netflix"},
+		{"Unknown", "Unknown"},
+	}, names)
+}
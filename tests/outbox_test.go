@@ -0,0 +1,296 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/outbox"
+	"subscription-service/repository"
+	"subscription-service/webhooks"
+)
+
+// flakyPublisher fails the first publish of an event of one aggregate
+type flakyPublisher struct {
+	failing   string
+	failed    bool
+	published []*models.OutboxEvent
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	if event.AggregateID == p.failing && !p.failed {
+		p.failed = true
+		return errors.New("broker unavailable")
+	}
+
+	p.published = append(p.published, event)
+	return nil
+}
+
+func createTestSubscription(t *testing.T, repo repository.Repository, serviceName string) int {
+	id, err := repo.Create(context.Background(), &models.CreateSubscriptionRequest{
+		ServiceName: serviceName,
+		Price:       100,
+		UserID:      uuid.New(),
+		StartDate:   "01-2024",
+	}, models.AuditInfo{Actor: "test"})
+	assert.NoError(t, err)
+
+	return id
+}
+
+func TestOutboxOrderingPerAggregate(t *testing.T) {
+	repo := repository.NewMockSubscriptionRepository()
+
+	first := createTestSubscription(t, repo, "Netflix")
+	createTestSubscription(t, repo, "Spotify")
+	assert.NoError(t, repo.Delete(context.Background(), first, models.AuditInfo{Actor: "test"}))
+
+	publisher := &flakyPublisher{failing: "1"}
+	cfg := config.OutboxConfig{BatchSize: 10, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+
+	// The failed event holds back the later events of its subscription only
+	published, err := outbox.NewRelay(repo, publisher, cfg, logger.NewLogger()).RelayPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, models.EventSubscriptionCreated, publisher.published[0].EventType)
+	assert.Equal(t, "2", publisher.published[0].AggregateID)
+
+	// Without a backoff the retry is due at once and the rest follows in order
+	cfg.InitialBackoff, cfg.MaxBackoff = 0, 0
+	repo = repository.NewMockSubscriptionRepository()
+	first = createTestSubscription(t, repo, "Netflix")
+	createTestSubscription(t, repo, "Spotify")
+	assert.NoError(t, repo.Delete(context.Background(), first, models.AuditInfo{Actor: "test"}))
+
+	publisher = &flakyPublisher{failing: "1"}
+	published, err = outbox.NewRelay(repo, publisher, cfg, logger.NewLogger()).RelayPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, published)
+
+	var firstEvents []string
+	for _, event := range publisher.published {
+		if event.AggregateID == "1" {
+			firstEvents = append(firstEvents, event.EventType)
+		}
+	}
+	assert.Equal(t, []string{models.EventSubscriptionCreated, models.EventSubscriptionDeleted}, firstEvents)
+
+	// Nothing is published twice
+	published, err = outbox.NewRelay(repo, publisher, cfg, logger.NewLogger()).RelayPending(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, published)
+}
+
+// claimingPublisher claims pending events while it publishes, as a concurrent relay would
+type claimingPublisher struct {
+	store   repository.OutboxStore
+	claimed int
+}
+
+func (p *claimingPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	events, err := p.store.ClaimPendingEvents(ctx, 10, time.Minute)
+	if err != nil {
+		return err
+	}
+	p.claimed += len(events)
+	return nil
+}
+
+func TestOutboxClaimedEventsAreSkipped(t *testing.T) {
+	repo := repository.NewMockSubscriptionRepository()
+	createTestSubscription(t, repo, "Netflix")
+	createTestSubscription(t, repo, "Spotify")
+
+	// Events are published outside the claim, and other relays skip them meanwhile
+	publisher := &claimingPublisher{store: repo}
+	published, err := outbox.NewRelay(repo, publisher, config.OutboxConfig{BatchSize: 10, Timeout: time.Minute}, logger.NewLogger()).RelayPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.Zero(t, publisher.claimed)
+
+	events, err := repo.ClaimPendingEvents(context.Background(), 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestOutboxWebhookPublisherDeduplicates(t *testing.T) {
+	repo := repository.NewMockSubscriptionRepository()
+	store := repository.NewMockWebhookRepository()
+	assert.NoError(t, store.CreateEndpoint(context.Background(), &models.WebhookEndpoint{URL: "http://example.com", Active: true}))
+
+	createTestSubscription(t, repo, "Netflix")
+
+	memory := outbox.NewInMemoryPublisher()
+	_, err := outbox.NewRelay(repo, memory, config.OutboxConfig{BatchSize: 10}, logger.NewLogger()).RelayPending(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, memory.Events(), 1)
+
+	// At-least-once delivery may hand the same event over twice
+	publisher := webhooks.NewPublisher(store, logger.NewLogger())
+	assert.NoError(t, publisher.Publish(context.Background(), memory.Events()[0]))
+	assert.NoError(t, publisher.Publish(context.Background(), memory.Events()[0]))
+
+	_, total, err := store.ListDeliveries(context.Background(), &models.ListDeliveriesRequest{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+}
+
+func TestOutboxHTTPPublisher(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	event := &models.OutboxEvent{
+		AggregateType: models.OutboxAggregateSubscription,
+		AggregateID:   "7",
+		EventID:       uuid.New(),
+		EventType:     models.EventSubscriptionCreated,
+		Payload:       []byte(`{"type":"subscription.created"}`),
+	}
+
+	err := outbox.NewHTTPPublisher(server.URL, time.Second).Publish(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, event.EventID.String(), received.Header.Get(outbox.EventIDHeader))
+	assert.Equal(t, "7", received.Header.Get(outbox.AggregateIDHeader))
+	assert.JSONEq(t, string(event.Payload), string(body))
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	err = outbox.NewHTTPPublisher(failing.URL, time.Second).Publish(context.Background(), event)
+	assert.Error(t, err)
+}
+
+// natsMessage is a message received by fakeJetStream
+type natsMessage struct {
+	Subject string
+	MsgID   string
+	Payload string
+}
+
+// fakeJetStream accepts one connection, records the messages published on it
+// and answers each with ack, in which %d is replaced by the stream sequence
+func fakeJetStream(t *testing.T, ack string) (string, <-chan natsMessage) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan natsMessage, 10)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("INFO {\"headers\":true,\"max_payload\":1048576,\"proto\":1}\r\n"))
+
+		inboxSID, sequence := "", 0
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+
+			switch fields[0] {
+			case "PING":
+				conn.Write([]byte("PONG\r\n"))
+			case "SUB":
+				inboxSID = fields[len(fields)-1]
+			case "HPUB":
+				// HPUB <subject> <reply> <header length> <total length>
+				headerLength, _ := strconv.Atoi(fields[3])
+				totalLength, _ := strconv.Atoi(fields[4])
+				body := make([]byte, totalLength+2)
+				if _, err := io.ReadFull(reader, body); err != nil {
+					return
+				}
+
+				// The header block is a NATS/1.0 status line followed by MIME headers
+				headers := textproto.NewReader(bufio.NewReader(bytes.NewReader(body[:headerLength])))
+				headers.ReadLine()
+				header, _ := headers.ReadMIMEHeader()
+				messages <- natsMessage{
+					Subject: fields[1],
+					MsgID:   header.Get("Nats-Msg-Id"),
+					Payload: string(body[headerLength:totalLength]),
+				}
+
+				sequence++
+				reply := strings.ReplaceAll(ack, "%d", strconv.Itoa(sequence))
+				fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", fields[2], inboxSID, len(reply), reply)
+			}
+		}
+	}()
+
+	return "nats://" + listener.Addr().String(), messages
+}
+
+func TestOutboxNATSPublisher(t *testing.T) {
+	serverURL, messages := fakeJetStream(t, `{"stream":"EVENTS","seq":%d}`)
+
+	publisher, err := outbox.NewNATSPublisher(serverURL, "events", time.Second)
+	assert.NoError(t, err)
+	defer publisher.Close()
+
+	var eventIDs []uuid.UUID
+	for _, eventType := range []string{models.EventSubscriptionCreated, models.EventSubscriptionDeleted} {
+		eventIDs = append(eventIDs, uuid.New())
+		err := publisher.Publish(context.Background(), &models.OutboxEvent{
+			EventID:   eventIDs[len(eventIDs)-1],
+			EventType: eventType,
+			Payload:   []byte(`{"type":"` + eventType + `"}`),
+		})
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, natsMessage{"events.subscription.created", eventIDs[0].String(), `{"type":"subscription.created"}`}, <-messages)
+	assert.Equal(t, natsMessage{"events.subscription.deleted", eventIDs[1].String(), `{"type":"subscription.deleted"}`}, <-messages)
+}
+
+func TestOutboxNATSPublisherNotStored(t *testing.T) {
+	// A message the stream refuses to store is not published
+	serverURL, _ := fakeJetStream(t, `{"error":{"code":503,"err_code":10077,"description":"maximum messages exceeded"}}`)
+
+	publisher, err := outbox.NewNATSPublisher(serverURL, "events", time.Second)
+	assert.NoError(t, err)
+	defer publisher.Close()
+
+	err = publisher.Publish(context.Background(), &models.OutboxEvent{
+		EventID:   uuid.New(),
+		EventType: models.EventSubscriptionCreated,
+		Payload:   []byte(`{}`),
+	})
+	assert.ErrorContains(t, err, "maximum messages exceeded")
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/middleware"
+)
+
+func TestConfigReload(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+database:
+  host: db-1
+log:
+  level: info
+`)
+	flags := &config.Flags{ConfigPath: path}
+	cfg, err := config.LoadConfig(flags)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	log := logger.NewLogger()
+	log.SetOutput(&buf)
+
+	watcher := config.NewWatcher(cfg, flags, log)
+	watcher.OnReload(func(cfg *config.Config) {
+		log.SetLevelName(cfg.Log.Level)
+		log.SetFormatName(cfg.Log.Format)
+	})
+
+	// Reloadable settings are swapped in; the database host is kept
+	assert.NoError(t, os.WriteFile(path, []byte(`
+database:
+  host: db-2
+log:
+  level: debug
+  format: json
+features:
+  search: false
+`), 0o600))
+	assert.NoError(t, watcher.Reload())
+
+	current := watcher.Current()
+	assert.Equal(t, "debug", current.Log.Level)
+	assert.False(t, current.Features.Search)
+	assert.True(t, current.Features.EventStream)
+	assert.Equal(t, "db-1", current.Database.Host)
+	assert.Equal(t, logrus.DebugLevel, log.GetLevel())
+	assert.IsType(t, &logrus.JSONFormatter{}, log.Formatter)
+	assert.Contains(t, buf.String(), "Ignoring changes to database.host")
+	assert.Equal(t, "db-1", cfg.Database.Host, "the previous configuration is not modified")
+
+	// An invalid file leaves the configuration in place
+	assert.NoError(t, os.WriteFile(path, []byte("log:\n  level: loud\n"), 0o600))
+	assert.Error(t, watcher.Reload())
+	assert.Equal(t, "debug", watcher.Current().Log.Level)
+}
+
+func TestConfigWatcherPollsFile(t *testing.T) {
+	path := writeFile(t, "config.yaml", "reload:\n  interval: 10ms\n")
+	flags := &config.Flags{ConfigPath: path}
+	cfg, err := config.LoadConfig(flags)
+	assert.NoError(t, err)
+
+	watcher := config.NewWatcher(cfg, flags, logger.NewLogger())
+	reloaded := make(chan *config.Config, 1)
+	watcher.OnReload(func(cfg *config.Config) { reloaded <- cfg })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.Run(ctx)
+
+	assert.NoError(t, os.WriteFile(path, []byte("reload:\n  interval: 10ms\nfeatures:\n  event_stream: false\n"), 0o600))
+	select {
+	case cfg := <-reloaded:
+		assert.False(t, cfg.Features.EventStream)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the changed file was not reloaded")
+	}
+}
+
+func TestFeatureFlag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	enabled := true
+	r := gin.New()
+	r.GET("/api/v1/subscriptions/search", middleware.Feature(func() bool { return enabled }), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/subscriptions/search", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request())
+
+	// Switching a feature off applies at once
+	enabled = false
+	assert.Equal(t, http.StatusNotFound, request())
+}
@@ -0,0 +1,337 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/config"
+	"subscription-service/handlers"
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/notify"
+	"subscription-service/reminders"
+	"subscription-service/repository"
+)
+
+func reminderConfig() config.RemindersConfig {
+	return config.RemindersConfig{
+		BatchSize:       10,
+		RenewalLeadDays: []int{3},
+		EndLeadDays:     []int{7, 1},
+		MaxAttempts:     2,
+		Timeout:         time.Second,
+	}
+}
+
+// dueRenewalReminder stores a renewal reminder of a subscription that is due now
+func dueRenewalReminder(t *testing.T, repo *repository.MockSubscriptionRepository, id int, channel, target string) {
+	subscription, err := repo.GetByID(context.Background(), id)
+	assert.NoError(t, err)
+
+	renewal, ok := subscription.NextRenewal(time.Now())
+	assert.True(t, ok)
+
+	created, err := repo.CreateReminderJobs(context.Background(), []*models.ReminderJob{{
+		SubscriptionID: id,
+		UserID:         subscription.UserID,
+		Kind:           models.ReminderKindRenewal,
+		DueOn:          renewal,
+		LeadDays:       3,
+		SendAt:         time.Now().Add(-time.Hour),
+		Channel:        channel,
+		Target:         target,
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+}
+
+func TestPlanReminders(t *testing.T) {
+	endDate := "03-2025"
+	target := &models.ReminderTarget{
+		Subscription: &models.Subscription{ID: 1, UserID: uuid.New(), StartDate: "01-2025", EndDate: &endDate},
+		Preferences: &models.ReminderPreferences{
+			Enabled:         true,
+			RenewalLeadDays: []int{7, 3},
+			EndLeadDays:     []int{7, 1},
+			Channel:         models.NotifyChannelLog,
+		},
+	}
+
+	// Both renewal lead times are still ahead, as are both end lead times
+	jobs := models.PlanReminders(target, time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC))
+	assert.Len(t, jobs, 4)
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), jobs[0].DueOn)
+	assert.Equal(t, time.Date(2025, 1, 25, 0, 0, 0, 0, time.UTC), jobs[0].SendAt)
+	assert.Equal(t, models.ReminderKindEnd, jobs[2].Kind)
+	assert.Equal(t, time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), jobs[2].DueOn)
+
+	// Once both renewal lead times have passed only the latest is still sent
+	jobs = models.PlanReminders(target, time.Date(2025, 1, 30, 0, 0, 0, 0, time.UTC))
+	assert.Len(t, jobs, 3)
+	assert.Equal(t, 3, jobs[0].LeadDays)
+
+	// There is no renewal after the end month
+	jobs = models.PlanReminders(target, time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC))
+	for _, job := range jobs {
+		assert.Equal(t, models.ReminderKindEnd, job.Kind)
+	}
+
+	target.Preferences.Enabled = false
+	assert.Empty(t, models.PlanReminders(target, time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestReminderWindow(t *testing.T) {
+	endDate := "03-2025"
+	subscription := &models.Subscription{ID: 1, UserID: uuid.New(), StartDate: "01-2025", EndDate: &endDate}
+	preferences := &models.ReminderPreferences{
+		Enabled:         true,
+		RenewalLeadDays: []int{7, 3},
+		EndLeadDays:     []int{10},
+		Channel:         models.NotifyChannelLog,
+	}
+
+	// The renewal on February 1 is out of reach until its longest lead time
+	assert.False(t, models.ReminderWindowOpen(subscription, preferences, time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, models.ReminderWindowOpen(subscription, preferences, time.Date(2025, 1, 25, 0, 0, 0, 0, time.UTC)))
+
+	// After the last renewal on March 1 only the end on April 1 is left
+	assert.False(t, models.ReminderWindowOpen(subscription, preferences, time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, models.ReminderWindowOpen(subscription, preferences, time.Date(2025, 3, 22, 0, 0, 0, 0, time.UTC)))
+
+	preferences.Enabled = false
+	assert.False(t, models.ReminderWindowOpen(subscription, preferences, time.Date(2025, 1, 25, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestReminderPlanningIsDeduplicated(t *testing.T) {
+	repo := repository.NewMockSubscriptionRepository()
+	createTestSubscription(t, repo, "Netflix")
+
+	// A lead time of a month keeps the next renewal within reach whatever the day
+	cfg := reminderConfig()
+	cfg.RenewalLeadDays = []int{31}
+	scheduler := reminders.NewScheduler(repo, notify.Router{}, cfg, logger.NewLogger())
+
+	created, err := scheduler.Plan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+
+	// Another replica planning the same reminders adds nothing
+	created, err = scheduler.Plan(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+}
+
+func TestReminderIsSentOnce(t *testing.T) {
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	repo := repository.NewMockSubscriptionRepository()
+	id := createTestSubscription(t, repo, "Netflix")
+	dueRenewalReminder(t, repo, id, models.NotifyChannelWebhook, server.URL)
+
+	log := logger.NewLogger()
+	scheduler := reminders.NewScheduler(repo, notify.Router{
+		models.NotifyChannelWebhook: notify.NewWebhookNotifier(time.Second),
+	}, reminderConfig(), log)
+
+	assert.NoError(t, scheduler.Deliver(context.Background()))
+	assert.NoError(t, scheduler.Deliver(context.Background()))
+
+	receiver.mutex.Lock()
+	assert.Len(t, receiver.bodies, 1)
+	var payload reminders.Payload
+	assert.NoError(t, json.Unmarshal(receiver.bodies[0], &payload))
+	receiver.mutex.Unlock()
+	assert.Equal(t, models.ReminderKindRenewal, payload.Kind)
+	assert.Equal(t, id, payload.Subscription.ID)
+
+	subscription, _ := repo.GetByID(context.Background(), id)
+	jobs, err := repo.ListReminders(context.Background(), subscription.UserID, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReminderStatusSent, jobs[0].Status)
+	assert.NotNil(t, jobs[0].SentAt)
+}
+
+func TestReminderFailuresAreRetried(t *testing.T) {
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	repo := repository.NewMockSubscriptionRepository()
+	id := createTestSubscription(t, repo, "Netflix")
+	dueRenewalReminder(t, repo, id, models.NotifyChannelWebhook, server.URL)
+
+	scheduler := reminders.NewScheduler(repo, notify.Router{
+		models.NotifyChannelWebhook: notify.NewWebhookNotifier(time.Second),
+	}, reminderConfig(), logger.NewLogger())
+
+	subscription, _ := repo.GetByID(context.Background(), id)
+
+	assert.NoError(t, scheduler.Deliver(context.Background()))
+	jobs, _ := repo.ListReminders(context.Background(), subscription.UserID, 10)
+	assert.Equal(t, models.ReminderStatusPending, jobs[0].Status)
+	assert.Equal(t, 1, jobs[0].Attempts)
+
+	assert.NoError(t, scheduler.Deliver(context.Background()))
+	jobs, _ = repo.ListReminders(context.Background(), subscription.UserID, 10)
+	assert.Equal(t, models.ReminderStatusFailed, jobs[0].Status)
+	assert.Equal(t, 2, jobs[0].Attempts)
+	assert.Contains(t, jobs[0].LastError, "500")
+}
+
+func TestReminderOfDeletedSubscriptionIsCancelled(t *testing.T) {
+	repo := repository.NewMockSubscriptionRepository()
+	id := createTestSubscription(t, repo, "Netflix")
+	dueRenewalReminder(t, repo, id, models.NotifyChannelLog, "")
+
+	subscription, _ := repo.GetByID(context.Background(), id)
+	assert.NoError(t, repo.Delete(context.Background(), id, models.AuditInfo{Actor: "test"}))
+
+	// No log notifier is configured, so a delivery attempt would fail
+	scheduler := reminders.NewScheduler(repo, notify.Router{}, reminderConfig(), logger.NewLogger())
+	assert.NoError(t, scheduler.Deliver(context.Background()))
+
+	jobs, _ := repo.ListReminders(context.Background(), subscription.UserID, 10)
+	assert.Equal(t, models.ReminderStatusCancelled, jobs[0].Status)
+}
+
+func TestReminderOptOutIsHonoured(t *testing.T) {
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	repo := repository.NewMockSubscriptionRepository()
+	id := createTestSubscription(t, repo, "Netflix")
+	dueRenewalReminder(t, repo, id, models.NotifyChannelWebhook, server.URL)
+
+	subscription, _ := repo.GetByID(context.Background(), id)
+
+	// Reminders planned before the user opted out are not sent
+	assert.NoError(t, repo.SaveReminderPreferences(context.Background(), &models.ReminderPreferences{
+		UserID:          subscription.UserID,
+		Enabled:         false,
+		RenewalLeadDays: []int{3},
+		Channel:         models.NotifyChannelWebhook,
+		Target:          server.URL,
+	}))
+
+	scheduler := reminders.NewScheduler(repo, notify.Router{
+		models.NotifyChannelWebhook: notify.NewWebhookNotifier(time.Second),
+	}, reminderConfig(), logger.NewLogger())
+	assert.NoError(t, scheduler.Deliver(context.Background()))
+
+	receiver.mutex.Lock()
+	assert.Empty(t, receiver.bodies)
+	receiver.mutex.Unlock()
+
+	jobs, _ := repo.ListReminders(context.Background(), subscription.UserID, 10)
+	assert.Equal(t, models.ReminderStatusCancelled, jobs[0].Status)
+}
+
+func TestReminderFollowsNewTarget(t *testing.T) {
+	old := &webhookReceiver{status: http.StatusOK}
+	oldServer := httptest.NewServer(old)
+	defer oldServer.Close()
+	current := &webhookReceiver{status: http.StatusOK}
+	currentServer := httptest.NewServer(current)
+	defer currentServer.Close()
+
+	repo := repository.NewMockSubscriptionRepository()
+	id := createTestSubscription(t, repo, "Netflix")
+	dueRenewalReminder(t, repo, id, models.NotifyChannelWebhook, oldServer.URL)
+
+	subscription, _ := repo.GetByID(context.Background(), id)
+
+	// A planned reminder goes to the target the user has moved to
+	assert.NoError(t, repo.SaveReminderPreferences(context.Background(), &models.ReminderPreferences{
+		UserID:          subscription.UserID,
+		Enabled:         true,
+		RenewalLeadDays: []int{3},
+		Channel:         models.NotifyChannelWebhook,
+		Target:          currentServer.URL,
+	}))
+
+	scheduler := reminders.NewScheduler(repo, notify.Router{
+		models.NotifyChannelWebhook: notify.NewWebhookNotifier(time.Second),
+	}, reminderConfig(), logger.NewLogger())
+	assert.NoError(t, scheduler.Deliver(context.Background()))
+
+	old.mutex.Lock()
+	assert.Empty(t, old.bodies)
+	old.mutex.Unlock()
+	current.mutex.Lock()
+	assert.Len(t, current.bodies, 1)
+	current.mutex.Unlock()
+
+	// Removing the lead time cancels the reminders planned for it
+	planned := &models.ReminderJob{
+		SubscriptionID: id,
+		UserID:         subscription.UserID,
+		Kind:           models.ReminderKindRenewal,
+		DueOn:          time.Now().AddDate(0, 1, 0),
+		LeadDays:       3,
+		SendAt:         time.Now().AddDate(0, 0, 20),
+		Channel:        models.NotifyChannelWebhook,
+		Target:         currentServer.URL,
+	}
+	_, err := repo.CreateReminderJobs(context.Background(), []*models.ReminderJob{planned})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.SaveReminderPreferences(context.Background(), &models.ReminderPreferences{
+		UserID:          subscription.UserID,
+		Enabled:         true,
+		RenewalLeadDays: []int{1},
+		Channel:         models.NotifyChannelWebhook,
+		Target:          currentServer.URL,
+	}))
+
+	jobs, _ := repo.ListReminders(context.Background(), subscription.UserID, 10)
+	assert.Equal(t, models.ReminderStatusCancelled, jobs[0].Status)
+}
+
+func TestReminderPreferencesEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := repository.NewMockSubscriptionRepository()
+	handler := handlers.NewReminderHandler(repo, reminderConfig(), logger.NewLogger())
+
+	r := gin.Default()
+	r.GET("/users/:user_id/reminder-preferences", handler.GetPreferences)
+	r.PUT("/users/:user_id/reminder-preferences", handler.UpdatePreferences)
+
+	userID := uuid.New()
+	path := "/users/" + userID.String() + "/reminder-preferences"
+
+	// Users without preferences get the defaults
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var preferences models.ReminderPreferences
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &preferences))
+	assert.True(t, preferences.Enabled)
+	assert.Equal(t, []int{7, 1}, preferences.EndLeadDays)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", path, bytes.NewBufferString(`{"enabled":true,"renewal_lead_days":[1],"channel":"email","target":"not-an-address"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", path, bytes.NewBufferString(`{"enabled":true,"renewal_lead_days":[1],"channel":"email","target":"user@example.com"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &preferences))
+	assert.Equal(t, models.NotifyChannelEmail, preferences.Channel)
+	assert.Equal(t, []int{1}, preferences.RenewalLeadDays)
+	assert.Empty(t, preferences.EndLeadDays)
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/models"
+	"subscription-service/search"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "yandeks plyus", search.Normalize("Яндекс Плюс"))
+	assert.Equal(t, "yandeks plus", search.Normalize("  Yandex.Plus!"))
+	assert.Equal(t, "obem 2", search.Normalize("Объём-2"))
+	assert.Equal(t, "shchi", search.Normalize("ЩИ"))
+	assert.Equal(t, "", search.Normalize("—"))
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, search.Similarity("netfliks", "netfliks"))
+	assert.Zero(t, search.Similarity("netfliks", "spotify"))
+	assert.Greater(t, search.Similarity("netflks", "netfliks"), search.SimilarityThreshold)
+	assert.Equal(t, 1.0, search.WordSimilarity("yandeks", "yandeks plyus"))
+
+	assert.True(t, search.PrefixMatch("yand pl", "yandeks plyus"))
+	assert.False(t, search.PrefixMatch("yand music", "yandeks plyus"))
+	assert.Equal(t, "yandeks:* & pl:*", search.PrefixQuery("yandeks pl"))
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "<b>Яндекс</b> Плюс", search.Highlight("Яндекс Плюс", "yandex"))
+	assert.Equal(t, "<b>Netflix</b> &amp; Chill", search.Highlight("Netflix & Chill", "netflx"))
+	assert.Equal(t, "Spotify", search.Highlight("Spotify", "netflix"))
+}
+
+func TestSearchSubscriptions(t *testing.T) {
+	r := setupTestRouter()
+
+	userID := uuid.New()
+	for _, name := range []string{"Яндекс Плюс", "Netflix", "Yandex Music", "Spotify", "Нетфликс"} {
+		jsonValue, _ := json.Marshal(models.CreateSubscriptionRequest{ServiceName: name, Price: 100, UserID: userID, StartDate: "01-2024"})
+		req, _ := http.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	find := func(query string) ([]*models.SubscriptionSearchResult, int) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/subscriptions/search?user_id="+userID.String()+"&q="+url.QueryEscape(query), nil))
+		var response models.SearchSubscriptionsResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Items, w.Code
+	}
+	names := func(results []*models.SubscriptionSearchResult) []string {
+		found := []string{}
+		for _, result := range results {
+			found = append(found, result.ServiceName)
+		}
+		return found
+	}
+
+	// Either alphabet finds both spellings
+	results, code := find("yandex")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"Яндекс Плюс", "Yandex Music"}, names(results))
+	assert.Equal(t, 1.0, results[0].Score)
+	assert.Equal(t, "<b>Яндекс</b> Плюс", results[0].Highlight)
+
+	// Names sharing only some words are similar enough to follow
+	results, _ = find("Яндекс Плюс")
+	assert.Equal(t, []string{"Яндекс Плюс", "Yandex Music"}, names(results))
+	assert.Equal(t, 1.0, results[0].Score)
+	assert.Less(t, results[1].Score, 1.0)
+
+	// Typos are tolerated but rank below exact matches
+	results, _ = find("netflx")
+	assert.Equal(t, []string{"Netflix", "Нетфликс"}, names(results))
+	assert.Less(t, results[0].Score, 1.0)
+
+	results, _ = find("нетфликс")
+	assert.Equal(t, []string{"Netflix", "Нетфликс"}, names(results))
+	assert.Equal(t, "<b>Netflix</b>", results[0].Highlight)
+
+	results, _ = find("hbo")
+	assert.Empty(t, results)
+
+	for _, query := range []string{"", "!!!"} {
+		_, code = find(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/models"
+)
+
+func postJSON(r *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	return sendJSON(r, "POST", path, body)
+}
+
+func putJSON(r *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	return sendJSON(r, "PUT", path, body)
+}
+
+func sendJSON(r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	jsonValue, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestServiceCatalog(t *testing.T) {
+	r := setupTestRouter()
+
+	category, price := "video", 599
+	w := postJSON(r, "/api/v1/services", models.CreateServiceRequest{
+		Name:         " Netflix ",
+		Aliases:      []string{"Нетфликс"},
+		Category:     &category,
+		DefaultPrice: &price,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var netflix models.Service
+	json.Unmarshal(w.Body.Bytes(), &netflix)
+	assert.Equal(t, "Netflix", netflix.Name)
+	assert.Equal(t, []string{"netflix", "нетфликс"}, netflix.Aliases)
+
+	// Names and aliases resolve to a single service
+	w = postJSON(r, "/api/v1/services", models.CreateServiceRequest{Name: "NETFLIX"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = postJSON(r, "/api/v1/services", models.CreateServiceRequest{Name: "Spotify"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var spotify models.Service
+	json.Unmarshal(w.Body.Bytes(), &spotify)
+
+	w = postJSON(r, fmt.Sprintf("/api/v1/services/%d/aliases", spotify.ID), models.AddServiceAliasRequest{Alias: "Спотифай"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postJSON(r, fmt.Sprintf("/api/v1/services/%d/aliases", spotify.ID), models.AddServiceAliasRequest{Alias: "netflix"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = postJSON(r, "/api/v1/services/999/aliases", models.AddServiceAliasRequest{Alias: "other"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/v1/services/%d", spotify.ID), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &spotify)
+	assert.Equal(t, []string{"spotify", "спотифай"}, spotify.Aliases)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/services/999", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"Service not found"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/services?category=video", nil))
+	var services []models.Service
+	json.Unmarshal(w.Body.Bytes(), &services)
+	if assert.Len(t, services, 1) {
+		assert.Equal(t, netflix.ID, services[0].ID)
+	}
+
+	// Invalid services are rejected
+	w = postJSON(r, "/api/v1/services", models.CreateServiceRequest{Name: "  "})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	logo := "ftp://example.com/logo.png"
+	w = postJSON(r, "/api/v1/services", models.CreateServiceRequest{Name: "Kinopoisk", LogoURL: &logo})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCreateSubscriptionResolvesService(t *testing.T) {
+	r := setupTestRouter()
+
+	price := 599
+	w := postJSON(r, "/api/v1/services", models.CreateServiceRequest{Name: "Netflix", DefaultPrice: &price})
+	var netflix models.Service
+	json.Unmarshal(w.Body.Bytes(), &netflix)
+
+	userID := uuid.New()
+	create := func(req models.CreateSubscriptionRequest) (*httptest.ResponseRecorder, models.Subscription) {
+		req.UserID = userID
+		req.StartDate = "01-2025"
+		w := postJSON(r, "/api/v1/subscriptions", req)
+
+		var created models.Subscription
+		if w.Code == http.StatusCreated {
+			json.Unmarshal(w.Body.Bytes(), &created)
+			get := httptest.NewRecorder()
+			r.ServeHTTP(get, httptest.NewRequest("GET", fmt.Sprintf("/api/v1/subscriptions/%d", created.ID), nil))
+			json.Unmarshal(get.Body.Bytes(), &created)
+		}
+		return w, created
+	}
+
+	// A name that differs in case and whitespace gets the canonical name and
+	// the default price
+	w, created := create(models.CreateSubscriptionRequest{ServiceName: "  NETFLIX "})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, netflix.ID, created.ServiceID)
+	assert.Equal(t, "Netflix", created.ServiceName)
+	assert.Equal(t, 599, created.Price)
+
+	// The catalog ID works on its own
+	w, created = create(models.CreateSubscriptionRequest{ServiceID: &netflix.ID, Price: 499})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "Netflix", created.ServiceName)
+	assert.Equal(t, 499, created.Price)
+
+	// Unknown names join the catalog, but need a price
+	w, created = create(models.CreateSubscriptionRequest{ServiceName: "Kinopoisk", Price: 299})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEqual(t, netflix.ID, created.ServiceID)
+	w, _ = create(models.CreateSubscriptionRequest{ServiceName: "Okko"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// ID and name must agree and the ID must exist
+	w, _ = create(models.CreateSubscriptionRequest{ServiceID: &netflix.ID, ServiceName: "Kinopoisk", Price: 100})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	missing := 999
+	w, _ = create(models.CreateSubscriptionRequest{ServiceID: &missing, Price: 100})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = create(models.CreateSubscriptionRequest{Price: 100})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Filters by service name match any alias of the service
+	postJSON(r, fmt.Sprintf("/api/v1/services/%d/aliases", netflix.ID), models.AddServiceAliasRequest{Alias: "Нетфликс"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/subscriptions?user_id="+userID.String()+"&service_name=%D0%9D%D0%B5%D1%82%D1%84%D0%BB%D0%B8%D0%BA%D1%81", nil))
+	var page models.SubscriptionPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	assert.Len(t, page.Items, 2)
+}
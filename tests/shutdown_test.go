@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/handlers"
+	"subscription-service/logger"
+	"subscription-service/stream"
+	"subscription-service/workers"
+)
+
+func TestWorkerGroupStop(t *testing.T) {
+	group := workers.NewGroup(logger.NewLogger())
+
+	stopped := make(chan struct{})
+	group.Go("ticker", func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+
+	assert.NoError(t, group.Stop(context.Background()))
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("Stop returned before the worker did")
+	}
+
+	// A worker that ignores cancellation is reported once the deadline passes
+	group = workers.NewGroup(logger.NewLogger())
+	release := make(chan struct{})
+	defer close(release)
+	group.Go("stuck", func(ctx context.Context) { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := group.Stop(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "stuck")
+	}
+}
+
+func TestShutdownDrainsRequestsAndEndsStreams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hub := stream.NewHub(10)
+	started := make(chan struct{})
+	r := gin.New()
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+	r.GET("/events", handlers.NewEventStreamHandler(hub, time.Hour, logger.NewLogger()).Stream)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := &http.Server{Handler: r, WriteTimeout: time.Second}
+	server.RegisterOnShutdown(hub.Close)
+	go server.Serve(listener)
+	baseURL := "http://" + listener.Addr().String()
+
+	// An open event stream
+	streamResp, err := http.Get(baseURL + "/events?user_id=" + uuid.NewString())
+	assert.NoError(t, err)
+	defer streamResp.Body.Close()
+
+	// A request still in flight when the shutdown starts
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		slow <- line
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	assert.NoError(t, server.Shutdown(ctx))
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// The in-flight request completed and the stream was closed by the server
+	assert.Equal(t, "done", <-slow)
+	_, err = bufio.NewReader(streamResp.Body).ReadString('\n')
+	assert.Error(t, err)
+}
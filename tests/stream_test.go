@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/handlers"
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/repository"
+	"subscription-service/stream"
+)
+
+// sseEvent is an event read from a stream
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvent reads the next event from a stream, skipping heartbeats
+func readEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return event
+		}
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case line == "" && event.event != "":
+			return event
+		case strings.HasPrefix(line, "id:"):
+			event.id = line[len("id:"):]
+		case strings.HasPrefix(line, "event:"):
+			event.event = line[len("event:"):]
+		case strings.HasPrefix(line, "data:"):
+			event.data = line[len("data:"):]
+		}
+	}
+}
+
+func subscriptionEvent(t *testing.T, id int64, eventType string, userID uuid.UUID) *models.OutboxEvent {
+	payload, err := json.Marshal(models.NewEvent(eventType, &models.Subscription{ID: int(id), UserID: userID}))
+	assert.NoError(t, err)
+
+	return &models.OutboxEvent{
+		ID:            id,
+		AggregateType: models.OutboxAggregateSubscription,
+		AggregateID:   strconv.FormatInt(id, 10),
+		EventType:     eventType,
+		Payload:       payload,
+	}
+}
+
+func TestHubReplay(t *testing.T) {
+	hub := stream.NewHub(3)
+	alice, bob := uuid.New(), uuid.New()
+
+	hub.Publish(subscriptionEvent(t, 1, models.EventSubscriptionCreated, alice))
+	hub.Publish(subscriptionEvent(t, 2, models.EventSubscriptionCreated, bob))
+	hub.Publish(subscriptionEvent(t, 3, models.EventSubscriptionUpdated, alice))
+	hub.Publish(subscriptionEvent(t, 3, models.EventSubscriptionUpdated, alice))
+
+	// Only the events of the user after the given one are replayed, once each
+	subscriber, replay := hub.Subscribe(alice, 1)
+	assert.Len(t, replay, 1)
+	assert.Equal(t, int64(3), replay[0].ID)
+	hub.Unsubscribe(subscriber)
+
+	// The buffer keeps the last three events
+	hub.Publish(subscriptionEvent(t, 4, models.EventSubscriptionDeleted, alice))
+	subscriber, replay = hub.Subscribe(alice, 1)
+	assert.Len(t, replay, 2)
+	assert.Equal(t, int64(3), replay[0].ID)
+	assert.Equal(t, int64(4), replay[1].ID)
+
+	// New events reach the subscriber of their user only
+	hub.Publish(subscriptionEvent(t, 5, models.EventSubscriptionCreated, bob))
+	hub.Publish(subscriptionEvent(t, 6, models.EventSubscriptionRestored, alice))
+	event := <-subscriber.Events
+	assert.Equal(t, int64(6), event.ID)
+	assert.Equal(t, models.EventSubscriptionRestored, event.Type)
+	hub.Unsubscribe(subscriber)
+}
+
+func TestSubscriptionEventStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := repository.NewMockSubscriptionRepository()
+	hub := stream.NewHub(16)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go repo.Listen(ctx, hub.Publish)
+
+	handler := handlers.NewEventStreamHandler(hub, 20*time.Millisecond, logger.NewLogger())
+	r := gin.New()
+	r.GET("/subscriptions/events", handler.Stream)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	userID := uuid.New()
+	create := func(serviceName string) int {
+		id, err := repo.Create(context.Background(), &models.CreateSubscriptionRequest{
+			ServiceName: serviceName,
+			Price:       100,
+			UserID:      userID,
+			StartDate:   "01-2024",
+		}, models.AuditInfo{Actor: "test"})
+		assert.NoError(t, err)
+		return id
+	}
+
+	connect := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/subscriptions/events?user_id="+userID.String(), nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	resp, reader := connect("")
+
+	// The first heartbeat shows that the stream is subscribed
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, ": heartbeat\n", line)
+
+	// Events of other users are not sent
+	createTestSubscription(t, repo, "Spotify")
+	id := create("Netflix")
+
+	event := readEvent(t, reader)
+	assert.Equal(t, models.EventSubscriptionCreated, event.event)
+	var decoded models.Event
+	assert.NoError(t, json.Unmarshal([]byte(event.data), &decoded))
+	assert.Equal(t, id, decoded.Data.ID)
+	resp.Body.Close()
+
+	// Events missed while disconnected are replayed after Last-Event-ID
+	assert.NoError(t, repo.Delete(context.Background(), id, models.AuditInfo{Actor: "test"}))
+	create("Yandex Plus")
+
+	resp, reader = connect(event.id)
+	defer resp.Body.Close()
+	assert.Equal(t, models.EventSubscriptionDeleted, readEvent(t, reader).event)
+	assert.Equal(t, models.EventSubscriptionCreated, readEvent(t, reader).event)
+}
+
+func TestSubscriptionEventStreamRequiresUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := handlers.NewEventStreamHandler(stream.NewHub(16), time.Second, logger.NewLogger())
+	r := gin.New()
+	r.GET("/subscriptions/events", handler.Stream)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/subscriptions/events", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
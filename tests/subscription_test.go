@@ -2,20 +2,25 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
+	"subscription-service/budgets"
 	"subscription-service/config"
 	"subscription-service/handlers"
 	"subscription-service/logger"
+	"subscription-service/middleware"
 	"subscription-service/models"
+	"subscription-service/notify"
 	"subscription-service/repository"
 )
 
@@ -38,12 +43,42 @@ func setupTestRouter() *gin.Engine {
 	// Register routes
 	v1 := r.Group("/api/v1")
 	{
-		v1.POST("/subscriptions", handler.CreateSubscription)
-		v1.GET("/subscriptions/:id", handler.GetSubscription)
-		v1.GET("/subscriptions", handler.ListSubscriptions)
-		v1.PUT("/subscriptions/:id", handler.UpdateSubscription)
-		v1.DELETE("/subscriptions/:id", handler.DeleteSubscription)
-		v1.GET("/subscriptions/cost", handler.CalculateTotalCost)
+		v1.POST("/subscriptions", middleware.Idempotency(repository.NewMockIdempotencyRepository(), time.Hour, log), handler.Create)
+		v1.GET("/subscriptions/:id", handler.Get)
+		v1.GET("/subscriptions", handler.List)
+		v1.PUT("/subscriptions/:id", handler.Update)
+		v1.PATCH("/subscriptions/:id", handler.Patch)
+		v1.DELETE("/subscriptions/:id", handler.Delete)
+		v1.POST("/subscriptions/:id/restore", handler.Restore)
+		v1.GET("/subscriptions/calculate", handler.CalculateTotalCost)
+		v1.GET("/subscriptions/search", handler.Search)
+		v1.GET("/admin/subscriptions/deleted", handler.ListDeleted)
+		v1.GET("/audit", handlers.NewAuditHandler(repo, log).List)
+
+		services := handlers.NewServiceHandler(repo, log)
+		v1.POST("/services", services.Create)
+		v1.GET("/services", services.List)
+		v1.GET("/services/:id", services.Get)
+		v1.POST("/services/:id/aliases", services.AddAlias)
+
+		tags := handlers.NewTagHandler(repo, log)
+		v1.POST("/tags", tags.Create)
+		v1.GET("/tags", tags.List)
+		v1.GET("/tags/:id", tags.Get)
+		v1.PUT("/tags/:id", tags.Rename)
+		v1.DELETE("/tags/:id", tags.Delete)
+		v1.GET("/subscriptions/:id/tags", tags.ListSubscriptionTags)
+		v1.PUT("/subscriptions/:id/tags/:tag_id", tags.TagSubscription)
+		v1.DELETE("/subscriptions/:id/tags/:tag_id", tags.UntagSubscription)
+
+		evaluator := budgets.NewEvaluator(repo, notify.NewLogNotifier(log), config.BudgetsConfig{Thresholds: []int{80, 100}}, log)
+		budgetHandler := handlers.NewBudgetHandler(repo, evaluator, log)
+		v1.POST("/budgets", budgetHandler.Create)
+		v1.GET("/budgets", budgetHandler.List)
+		v1.GET("/budgets/:id", budgetHandler.Get)
+		v1.PUT("/budgets/:id", budgetHandler.Update)
+		v1.DELETE("/budgets/:id", budgetHandler.Delete)
+		v1.GET("/budgets/:id/status", budgetHandler.Status)
 	}
 
 	return r
@@ -75,14 +110,14 @@ func TestCreateSubscription(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, w.Code)
 
 	// Parse the response
-	var response models.SubscriptionResponse
+	var response models.Subscription
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 
 	// Check the response
 	assert.Equal(t, subscription.ServiceName, response.ServiceName)
 	assert.Equal(t, subscription.Price, response.Price)
-	assert.Equal(t, subscription.UserID.String(), response.UserID)
+	assert.Equal(t, subscription.UserID, response.UserID)
 	assert.Equal(t, subscription.StartDate, response.StartDate)
 }
 
@@ -105,11 +140,11 @@ func TestGetSubscription(t *testing.T) {
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
-	var createResponse models.SubscriptionResponse
+	var createResponse models.Subscription
 	json.Unmarshal(w.Body.Bytes(), &createResponse)
 
 	// Now get the subscription
-	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/v1/subscriptions/%s", createResponse.ID), nil)
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/v1/subscriptions/%d", createResponse.ID), nil)
 	w = httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -117,7 +152,7 @@ func TestGetSubscription(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	// Parse the response
-	var getResponse models.SubscriptionResponse
+	var getResponse models.Subscription
 	err := json.Unmarshal(w.Body.Bytes(), &getResponse)
 	assert.NoError(t, err)
 
@@ -125,7 +160,7 @@ func TestGetSubscription(t *testing.T) {
 	assert.Equal(t, createResponse.ID, getResponse.ID)
 	assert.Equal(t, subscription.ServiceName, getResponse.ServiceName)
 	assert.Equal(t, subscription.Price, getResponse.Price)
-	assert.Equal(t, subscription.UserID.String(), getResponse.UserID)
+	assert.Equal(t, subscription.UserID, getResponse.UserID)
 	assert.Equal(t, subscription.StartDate, getResponse.StartDate)
 }
 
@@ -167,12 +202,87 @@ func TestListSubscriptions(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	// Parse the response
-	var listResponse []models.SubscriptionResponse
+	var listResponse models.SubscriptionPage
 	err := json.Unmarshal(w.Body.Bytes(), &listResponse)
 	assert.NoError(t, err)
 
 	// Check that we have at least the number of subscriptions we created
-	assert.GreaterOrEqual(t, len(listResponse), len(subscriptions))
+	assert.GreaterOrEqual(t, len(listResponse.Items), len(subscriptions))
+}
+
+func TestListSubscriptionsPagesAndFilters(t *testing.T) {
+	r := setupTestRouter()
+
+	userID := uuid.New()
+	endDate := "06-2024"
+	for _, sub := range []models.CreateSubscriptionRequest{
+		{ServiceName: "Netflix", Price: 700, UserID: userID, StartDate: "01-2024"},
+		{ServiceName: "netflix Kids", Price: 300, UserID: userID, StartDate: "11-2023", EndDate: &endDate},
+		{ServiceName: "Spotify", Price: 199, UserID: userID, StartDate: "02-2025"},
+		{ServiceName: "Net_Radio", Price: 300, UserID: userID, StartDate: "03-2024"},
+	} {
+		jsonValue, _ := json.Marshal(sub)
+		req, _ := http.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	list := func(query string) (models.SubscriptionPage, int) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/subscriptions?user_id="+userID.String()+"&"+query, nil))
+		var page models.SubscriptionPage
+		json.Unmarshal(w.Body.Bytes(), &page)
+		return page, w.Code
+	}
+	names := func(page models.SubscriptionPage) []string {
+		result := []string{}
+		for _, sub := range page.Items {
+			result = append(result, sub.ServiceName)
+		}
+		return result
+	}
+
+	// Following the cursor visits every subscription once; ties are broken by
+	// ID in the same direction
+	page, code := list("sort=price&order=desc&limit=3&include_total=true")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"Netflix", "Net_Radio", "netflix Kids"}, names(page))
+	if assert.NotNil(t, page.Total) {
+		assert.Equal(t, 4, *page.Total)
+	}
+	assert.NotEmpty(t, page.NextCursor)
+
+	page, code = list("sort=price&order=desc&limit=3&cursor=" + page.NextCursor)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"Spotify"}, names(page))
+	assert.Empty(t, page.NextCursor)
+	assert.Nil(t, page.Total)
+
+	// Start dates sort by time, not as text
+	page, _ = list("sort=start_date")
+	assert.Equal(t, []string{"netflix Kids", "Netflix", "Net_Radio", "Spotify"}, names(page))
+
+	// The prefix ignores case and matches wildcards literally
+	page, _ = list("service_prefix=NETFLIX")
+	assert.Equal(t, []string{"Netflix", "netflix Kids"}, names(page))
+	page, _ = list("service_prefix=net_")
+	assert.Equal(t, []string{"Net_Radio"}, names(page))
+
+	page, _ = list("min_price=200&max_price=300&sort=service_name")
+	assert.Equal(t, []string{"Net_Radio", "netflix Kids"}, names(page))
+
+	page, _ = list("active_in=05-2024&has_end_date=false")
+	assert.Equal(t, []string{"Netflix", "Net_Radio"}, names(page))
+
+	// A cursor is only valid for the order it was issued for
+	page, _ = list("sort=price&limit=1")
+	_, code = list("sort=service_name&limit=1&cursor=" + page.NextCursor)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	for _, query := range []string{"sort=id", "order=up", "limit=0", "min_price=5&max_price=1", "active_in=2024-05", "cursor=garbage"} {
+		_, code = list(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
 }
 
 func TestCalculateTotalCost(t *testing.T) {
@@ -213,7 +323,7 @@ func TestCalculateTotalCost(t *testing.T) {
 	}
 
 	// Calculate total cost for userID1
-	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/subscriptions/cost?user_id=%s&start_period=01-2024&end_period=12-2024", userID1.String()), nil)
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/subscriptions/calculate?user_id=%s&start_period=01-2024&end_period=12-2024", userID1.String()), nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -221,10 +331,350 @@ func TestCalculateTotalCost(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	// Parse the response
-	var costResponse models.CalculateTotalCostResponse
+	var costResponse models.CalculateCostResponse
 	err := json.Unmarshal(w.Body.Bytes(), &costResponse)
 	assert.NoError(t, err)
 
-	// Check the total cost (700 + 199) * 12 = 10788
-	assert.Equal(t, 10788, costResponse.TotalCost)
-}
\ No newline at end of file
+	// Check the total cost 700 * 12 + 199 * 11 = 10589
+	assert.Equal(t, 10589, costResponse.TotalCost)
+}
+
+func TestCalculateTotalCostAcrossYears(t *testing.T) {
+	r := setupTestRouter()
+
+	userID := uuid.New()
+	endDate := func(month string) *string { return &month }
+	for _, sub := range []models.CreateSubscriptionRequest{
+		{ServiceName: "Netflix", Price: 100, StartDate: "11-2023", EndDate: endDate("02-2024")},
+		{ServiceName: "Spotify", Price: 10, StartDate: "02-2024"},
+		{ServiceName: "Okko", Price: 1, StartDate: "06-2023", EndDate: endDate("01-2024")},
+		{ServiceName: "Kinopoisk", Price: 1000, StartDate: "03-2023", EndDate: endDate("11-2023")},
+		{ServiceName: "Ivi", Price: 5000, StartDate: "04-2024"},
+	} {
+		sub.UserID = userID
+		assert.Equal(t, http.StatusCreated, postJSON(r, "/api/v1/subscriptions", sub).Code)
+	}
+
+	// Every subscription costs its price for each month of the period it is
+	// active in, counting its start and end months
+	w := sendRequest(r, "GET", "/api/v1/subscriptions/calculate?start_period=12-2023&end_period=03-2024&user_id="+userID.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+	var cost models.CalculateCostResponse
+	json.Unmarshal(w.Body.Bytes(), &cost)
+	assert.Equal(t, 100*3+10*2+1*2, cost.TotalCost)
+}
+
+func TestDeleteAndRestoreSubscription(t *testing.T) {
+	r := setupTestRouter()
+
+	// Create a subscription to delete
+	subscription := models.CreateSubscriptionRequest{
+		ServiceName: "Kinopoisk",
+		Price:       269,
+		UserID:      uuid.New(),
+		StartDate:   "05-2024",
+	}
+
+	jsonValue, _ := json.Marshal(subscription)
+	req, _ := http.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var created models.Subscription
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	// Delete it
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/v1/subscriptions/%d", created.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Deleted subscriptions are hidden from the default queries
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/v1/subscriptions/%d", created.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// ...but show up in the admin listing
+	req, _ = http.NewRequest("GET", "/api/v1/admin/subscriptions/deleted", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var deleted []models.Subscription
+	err := json.Unmarshal(w.Body.Bytes(), &deleted)
+	assert.NoError(t, err)
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, created.ID, deleted[0].ID)
+		assert.NotNil(t, deleted[0].DeletedAt)
+	}
+
+	// Restore it
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/v1/subscriptions/%d/restore", created.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var restored models.Subscription
+	err = json.Unmarshal(w.Body.Bytes(), &restored)
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, restored.ID)
+	assert.Nil(t, restored.DeletedAt)
+
+	// Restoring a live subscription is a not found
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/v1/subscriptions/%d/restore", created.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPurgeDeletedSubscriptions(t *testing.T) {
+	repo := repository.NewMockSubscriptionRepository()
+
+	id, err := repo.Create(context.Background(), &models.CreateSubscriptionRequest{
+		ServiceName: "Spotify",
+		Price:       199,
+		UserID:      uuid.New(),
+		StartDate:   "01-2024",
+	}, models.AuditInfo{})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Delete(context.Background(), id, models.AuditInfo{}))
+
+	// Rows inside the retention window are kept
+	purged, err := repo.PurgeDeleted(context.Background(), time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	// Rows older than the retention window are removed for good
+	purged, err = repo.PurgeDeleted(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	assert.ErrorIs(t, repo.Restore(context.Background(), id, models.AuditInfo{}), repository.ErrNotFound)
+}
+
+func TestConditionalRequests(t *testing.T) {
+	r := setupTestRouter()
+
+	subscription := models.CreateSubscriptionRequest{
+		ServiceName: "Okko",
+		Price:       399,
+		UserID:      uuid.New(),
+		StartDate:   "06-2024",
+	}
+
+	jsonValue, _ := json.Marshal(subscription)
+	req, _ := http.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	var created models.Subscription
+	json.Unmarshal(w.Body.Bytes(), &created)
+	url := fmt.Sprintf("/api/v1/subscriptions/%d", created.ID)
+
+	// A cached copy that is still current is not sent again
+	req, _ = http.NewRequest("GET", url, nil)
+	req.Header.Set("If-None-Match", `"1"`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// An update against the current version succeeds and bumps the ETag
+	subscription.Price = 499
+	jsonValue, _ = json.Marshal(subscription)
+	req, _ = http.NewRequest("PUT", url, bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// A second client still holding version 1 is rejected
+	subscription.Price = 599
+	jsonValue, _ = json.Marshal(subscription)
+	req, _ = http.NewRequest("PUT", url, bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Only quoted strong entity tags match the current version
+	for _, ifMatch := range []string{`2`, `"2`, `2"`, `W/"2"`, `"+2"`, `"02"`} {
+		req, _ = http.NewRequest("PUT", url, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, ifMatch)
+	}
+
+	// The stale cached copy is now sent again
+	req, _ = http.NewRequest("GET", url, nil)
+	req.Header.Set("If-None-Match", `"1"`)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var current models.Subscription
+	json.Unmarshal(w.Body.Bytes(), &current)
+	assert.Equal(t, 499, current.Price)
+	assert.Equal(t, 2, current.Version)
+}
+
+// racingRepository changes subscription 1 just before each of its next races
+// units of work, as a concurrent request would
+type racingRepository struct {
+	repository.Repository
+	races int
+}
+
+func (r *racingRepository) WithTx(ctx context.Context, fn func(tx repository.Repository) error) error {
+	if r.races > 0 {
+		r.races--
+		subscription, err := r.GetByID(ctx, 1)
+		if err != nil {
+			return err
+		}
+		update := models.NewUpdateSubscriptionRequest(subscription)
+		update.Price++
+		if err := r.Repository.Update(ctx, 1, update, nil, models.AuditInfo{}); err != nil {
+			return err
+		}
+	}
+
+	return r.Repository.WithTx(ctx, fn)
+}
+
+func TestPatchSubscriptionConcurrently(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := &racingRepository{Repository: repository.NewMockSubscriptionRepository()}
+	_, err := repo.Create(context.Background(), &models.CreateSubscriptionRequest{
+		ServiceName: "Ivi", Price: 299, UserID: uuid.New(), StartDate: "01-2024",
+	}, models.AuditInfo{})
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.PATCH("/api/v1/subscriptions/:id", handlers.NewSubscriptionHandler(repo, logger.NewLogger()).Patch)
+
+	patchSubscription := func(ifMatch string) (*httptest.ResponseRecorder, models.Subscription) {
+		req, _ := http.NewRequest("PATCH", "/api/v1/subscriptions/1", bytes.NewBufferString(`{"end_date": "12-2024"}`))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var patched models.Subscription
+		json.Unmarshal(w.Body.Bytes(), &patched)
+		return w, patched
+	}
+
+	// Without If-Match the patch is applied on top of the concurrent change
+	repo.races = 1
+	w, patched := patchSubscription("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 300, patched.Price)
+	if assert.NotNil(t, patched.EndDate) {
+		assert.Equal(t, "12-2024", *patched.EndDate)
+	}
+
+	// A subscription that keeps changing is a conflict, not a failed precondition
+	repo.races = 10
+	w, _ = patchSubscription("")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// With If-Match a concurrent change fails the precondition
+	current, err := repo.GetByID(context.Background(), 1)
+	assert.NoError(t, err)
+	repo.races = 1
+	w, _ = patchSubscription(fmt.Sprintf(`"%d"`, current.Version))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestPatchSubscription(t *testing.T) {
+	r := setupTestRouter()
+
+	endDate := "12-2024"
+	subscription := models.CreateSubscriptionRequest{
+		ServiceName: "Ivi",
+		Price:       299,
+		UserID:      uuid.New(),
+		StartDate:   "01-2024",
+		EndDate:     &endDate,
+	}
+
+	jsonValue, _ := json.Marshal(subscription)
+	req, _ := http.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var created models.Subscription
+	json.Unmarshal(w.Body.Bytes(), &created)
+	url := fmt.Sprintf("/api/v1/subscriptions/%d", created.ID)
+
+	patchSubscription := func(contentType, body string) (*httptest.ResponseRecorder, models.Subscription) {
+		req, _ := http.NewRequest("PATCH", url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var patched models.Subscription
+		json.Unmarshal(w.Body.Bytes(), &patched)
+		return w, patched
+	}
+
+	// Absent fields are left alone
+	w, patched := patchSubscription("application/merge-patch+json", `{"price": 349}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 349, patched.Price)
+	if assert.NotNil(t, patched.EndDate) {
+		assert.Equal(t, endDate, *patched.EndDate)
+	}
+
+	// null clears a field
+	w, patched = patchSubscription("application/merge-patch+json", `{"end_date": null}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, patched.EndDate)
+	assert.Equal(t, 349, patched.Price)
+
+	// Required fields cannot be cleared and read-only fields cannot be set
+	w, _ = patchSubscription("application/merge-patch+json", `{"service_name": null}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = patchSubscription("application/merge-patch+json", `{"id": 42}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// JSON Patch operations apply in order
+	w, patched = patchSubscription("application/json-patch+json",
+		`[{"op": "test", "path": "/price", "value": 349}, {"op": "replace", "path": "/price", "value": 399}, {"op": "add", "path": "/end_date", "value": "06-2025"}]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 399, patched.Price)
+	if assert.NotNil(t, patched.EndDate) {
+		assert.Equal(t, "06-2025", *patched.EndDate)
+	}
+
+	// A failed test operation leaves the subscription untouched
+	w, _ = patchSubscription("application/json-patch+json", `[{"op": "test", "path": "/price", "value": 1}, {"op": "remove", "path": "/end_date"}]`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w, _ = patchSubscription("text/plain", `price=1`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	// PUT is a full replacement and requires every mandatory field
+	req, _ = http.NewRequest("PUT", url, bytes.NewBufferString(`{"price": 100}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/models"
+)
+
+func sendRequest(r *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func createTag(t *testing.T, r *gin.Engine, userID uuid.UUID, name string) models.Tag {
+	w := postJSON(r, "/api/v1/tags", models.CreateTagRequest{UserID: userID, Name: name})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var tag models.Tag
+	json.Unmarshal(w.Body.Bytes(), &tag)
+	return tag
+}
+
+func TestTags(t *testing.T) {
+	r := setupTestRouter()
+
+	userID, otherUserID := uuid.New(), uuid.New()
+	work := createTag(t, r, userID, " work ")
+	assert.Equal(t, "work", work.Name)
+	family := createTag(t, r, userID, "Family")
+	createTag(t, r, otherUserID, "work")
+
+	// Names are unique per user regardless of case
+	w := postJSON(r, "/api/v1/tags", models.CreateTagRequest{UserID: userID, Name: "WORK"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = postJSON(r, "/api/v1/tags", models.CreateTagRequest{UserID: userID, Name: " "})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendRequest(r, "GET", "/api/v1/tags?user_id="+userID.String())
+	var tags []models.Tag
+	json.Unmarshal(w.Body.Bytes(), &tags)
+	if assert.Len(t, tags, 2) {
+		assert.Equal(t, "Family", tags[0].Name)
+		assert.Equal(t, "work", tags[1].Name)
+	}
+
+	// Renaming keeps names unique
+	w = putJSON(r, fmt.Sprintf("/api/v1/tags/%d", family.ID), models.RenameTagRequest{Name: "Work"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = putJSON(r, fmt.Sprintf("/api/v1/tags/%d", family.ID), models.RenameTagRequest{Name: "Home"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendRequest(r, "GET", fmt.Sprintf("/api/v1/tags/%d", family.ID))
+	var renamed models.Tag
+	json.Unmarshal(w.Body.Bytes(), &renamed)
+	assert.Equal(t, "Home", renamed.Name)
+
+	assert.Equal(t, http.StatusNoContent, sendRequest(r, "DELETE", fmt.Sprintf("/api/v1/tags/%d", family.ID)).Code)
+	assert.Equal(t, http.StatusNotFound, sendRequest(r, "GET", fmt.Sprintf("/api/v1/tags/%d", family.ID)).Code)
+	assert.Equal(t, http.StatusNotFound, sendRequest(r, "DELETE", fmt.Sprintf("/api/v1/tags/%d", family.ID)).Code)
+	assert.Equal(t, http.StatusBadRequest, sendRequest(r, "GET", "/api/v1/tags/abc").Code)
+}
+
+func TestTagSubscriptions(t *testing.T) {
+	r := setupTestRouter()
+
+	userID := uuid.New()
+	work := createTag(t, r, userID, "work")
+	streaming := createTag(t, r, userID, "streaming")
+	otherTag := createTag(t, r, uuid.New(), "family")
+
+	ids := map[string]int{}
+	for _, sub := range []models.CreateSubscriptionRequest{
+		{ServiceName: "Slack", Price: 100},
+		{ServiceName: "Netflix", Price: 500},
+		{ServiceName: "Spotify", Price: 200},
+	} {
+		sub.UserID, sub.StartDate = userID, "01-2024"
+		w := postJSON(r, "/api/v1/subscriptions", sub)
+		var created models.Subscription
+		json.Unmarshal(w.Body.Bytes(), &created)
+		ids[sub.ServiceName] = created.ID
+	}
+
+	tag := func(service string, tagID int) int {
+		return sendRequest(r, "PUT", fmt.Sprintf("/api/v1/subscriptions/%d/tags/%d", ids[service], tagID)).Code
+	}
+	assert.Equal(t, http.StatusNoContent, tag("Slack", work.ID))
+	assert.Equal(t, http.StatusNoContent, tag("Netflix", streaming.ID))
+	assert.Equal(t, http.StatusNoContent, tag("Netflix", work.ID))
+	assert.Equal(t, http.StatusNoContent, tag("Netflix", work.ID))
+	assert.Equal(t, http.StatusBadRequest, tag("Spotify", otherTag.ID))
+	assert.Equal(t, http.StatusNotFound, tag("Spotify", 999))
+	assert.Equal(t, http.StatusNotFound, sendRequest(r, "PUT", fmt.Sprintf("/api/v1/subscriptions/999/tags/%d", work.ID)).Code)
+
+	w := sendRequest(r, "GET", fmt.Sprintf("/api/v1/subscriptions/%d/tags", ids["Netflix"]))
+	var tags []models.Tag
+	json.Unmarshal(w.Body.Bytes(), &tags)
+	if assert.Len(t, tags, 2) {
+		assert.Equal(t, "streaming", tags[0].Name)
+		assert.Equal(t, "work", tags[1].Name)
+	}
+
+	list := func(query string) []string {
+		w := sendRequest(r, "GET", "/api/v1/subscriptions?user_id="+userID.String()+query)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var page models.SubscriptionPage
+		json.Unmarshal(w.Body.Bytes(), &page)
+		names := []string{}
+		for _, sub := range page.Items {
+			names = append(names, sub.ServiceName)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"Slack", "Netflix"}, list(fmt.Sprintf("&tag_id=%d", work.ID)))
+	assert.Equal(t, []string{"Netflix"}, list(fmt.Sprintf("&tag_id=%d", streaming.ID)))
+	assert.Equal(t, []string{"Slack", "Netflix"}, list(fmt.Sprintf("&tag_id=%d&tag_id=%d", work.ID, streaming.ID)))
+	assert.Equal(t, http.StatusBadRequest, sendRequest(r, "GET", "/api/v1/subscriptions?tag_id=0").Code)
+
+	calculate := func(query string) models.CalculateCostResponse {
+		w := sendRequest(r, "GET", "/api/v1/subscriptions/calculate?start_period=01-2024&end_period=02-2024&user_id="+userID.String()+query)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var cost models.CalculateCostResponse
+		json.Unmarshal(w.Body.Bytes(), &cost)
+		return cost
+	}
+
+	// A subscription with several tags counts toward each
+	cost := calculate("")
+	assert.Equal(t, 1600, cost.TotalCost)
+	assert.Equal(t, []models.TagCost{
+		{TagID: streaming.ID, Name: "streaming", TotalCost: 1000},
+		{TagID: work.ID, Name: "work", TotalCost: 1200},
+	}, cost.ByTag)
+
+	cost = calculate(fmt.Sprintf("&tag_id=%d", streaming.ID))
+	assert.Equal(t, 1000, cost.TotalCost)
+	assert.Equal(t, []models.TagCost{{TagID: streaming.ID, Name: "streaming", TotalCost: 1000}}, cost.ByTag)
+
+	// Untagging and deleting tags shrink the breakdown
+	assert.Equal(t, http.StatusNoContent, sendRequest(r, "DELETE", fmt.Sprintf("/api/v1/subscriptions/%d/tags/%d", ids["Netflix"], work.ID)).Code)
+	assert.Equal(t, http.StatusNoContent, sendRequest(r, "DELETE", fmt.Sprintf("/api/v1/tags/%d", streaming.ID)).Code)
+	cost = calculate("")
+	assert.Equal(t, []models.TagCost{{TagID: work.ID, Name: "work", TotalCost: 200}}, cost.ByTag)
+}
+
+func TestCostByTagAcrossYears(t *testing.T) {
+	r := setupTestRouter()
+
+	userID := uuid.New()
+	video := createTag(t, r, userID, "video")
+
+	end := "02-2024"
+	for _, sub := range []models.CreateSubscriptionRequest{
+		{ServiceName: "Netflix", Price: 100, StartDate: "11-2023", EndDate: &end},
+		{ServiceName: "Okko", Price: 10, StartDate: "02-2024"},
+	} {
+		sub.UserID = userID
+		var created models.Subscription
+		json.Unmarshal(postJSON(r, "/api/v1/subscriptions", sub).Body.Bytes(), &created)
+		assert.Equal(t, http.StatusNoContent, sendRequest(r, "PUT", fmt.Sprintf("/api/v1/subscriptions/%d/tags/%d", created.ID, video.ID)).Code)
+	}
+
+	// The breakdown counts the months of the period like the total
+	w := sendRequest(r, "GET", "/api/v1/subscriptions/calculate?start_period=12-2023&end_period=03-2024&user_id="+userID.String())
+	var cost models.CalculateCostResponse
+	json.Unmarshal(w.Body.Bytes(), &cost)
+	assert.Equal(t, 320, cost.TotalCost)
+	assert.Equal(t, []models.TagCost{{TagID: video.ID, Name: "video", TotalCost: 320}}, cost.ByTag)
+}
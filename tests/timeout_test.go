@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/db"
+	"subscription-service/handlers"
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/repository"
+)
+
+// slowRepository fails every lookup the way a query that hit its timeout does
+type slowRepository struct {
+	*repository.MockSubscriptionRepository
+	err error
+}
+
+func (r *slowRepository) GetByID(ctx context.Context, id int) (*models.Subscription, error) {
+	return nil, fmt.Errorf("failed to get subscription: %w", r.err)
+}
+
+func (r *slowRepository) List(ctx context.Context, filter *models.ListSubscriptionsRequest) (*models.SubscriptionPage, error) {
+	return nil, fmt.Errorf("failed to list subscriptions: %w", r.err)
+}
+
+func TestWithTimeout(t *testing.T) {
+	// The driver reports a cancelled statement as a plain error; it is made to
+	// match the reason the context ended
+	ctx, done := db.WithTimeout(context.Background(), time.Millisecond)
+	<-ctx.Done()
+	err := done(errors.New("pq: canceling statement due to user request"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "canceling statement")
+
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, done = db.WithTimeout(parent, time.Minute)
+	cancel()
+	<-ctx.Done()
+	assert.ErrorIs(t, done(errors.New("pq: canceling statement due to user request")), context.Canceled)
+
+	// Errors of an operation that finished in time are left alone
+	ctx, done = db.WithTimeout(context.Background(), time.Minute)
+	assert.Equal(t, repository.ErrNotFound, done(repository.ErrNotFound))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	// A zero timeout adds no deadline
+	ctx, done = db.WithTimeout(context.Background(), 0)
+	_, hasDeadline := ctx.Deadline()
+	assert.False(t, hasDeadline)
+	assert.NoError(t, done(nil))
+}
+
+func TestStorageTimeoutAnswers504(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := &slowRepository{MockSubscriptionRepository: repository.NewMockSubscriptionRepository(), err: context.DeadlineExceeded}
+	handler := handlers.NewSubscriptionHandler(repo, logger.NewLogger())
+	r := gin.New()
+	r.GET("/subscriptions", handler.List)
+	r.GET("/subscriptions/:id", handler.Get)
+
+	for _, path := range []string{"/subscriptions", "/subscriptions/1"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code, path)
+		assert.JSONEq(t, `{"error": "The request timed out"}`, w.Body.String(), path)
+	}
+
+	// Other failures still answer 500, or 404 for a missing subscription
+	repo.err = errors.New("connection refused")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/subscriptions", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	repo.err = repository.ErrNotFound
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/subscriptions/1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"subscription-service/logger"
+	"subscription-service/tracing"
+)
+
+// recordSpans installs a tracer provider keeping finished spans in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+// fakeConnector hands out connections answering every query with no rows
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return fakeRows{}, nil
+}
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string              { return []string{"id"} }
+func (fakeRows) Close() error                   { return nil }
+func (fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+func TestTracingMiddlewareContinuesTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	var handlerSpan trace.SpanContext
+	r := gin.New()
+	r.Use(tracing.Middleware())
+	r.GET("/api/v1/subscriptions/:id", func(c *gin.Context) {
+		handlerSpan = trace.SpanContextFromContext(c.Request.Context())
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest("GET", "/api/v1/subscriptions/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		span := spans[0]
+		assert.Equal(t, "GET /api/v1/subscriptions/:id", span.Name())
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+		assert.Equal(t, "500", spanAttribute(span, "http.response.status_code"))
+		assert.Equal(t, "Error", span.Status().Code.String())
+		assert.Equal(t, span.SpanContext().SpanID(), handlerSpan.SpanID())
+	}
+}
+
+func TestTracingQuerySpans(t *testing.T) {
+	recorder := recordSpans(t)
+
+	db := sql.OpenDB(tracing.WrapConnector(fakeConnector{}))
+	defer db.Close()
+
+	// Queries outside a trace are not recorded
+	rows, err := db.QueryContext(context.Background(), "SELECT id FROM subscriptions")
+	assert.NoError(t, err)
+	rows.Close()
+	assert.Empty(t, recorder.Ended())
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	rows, err = db.QueryContext(ctx, "SELECT id FROM subscriptions\n\tWHERE service_name = 'Netflix' AND price > 100 AND user_id = $1", "user")
+	assert.NoError(t, err)
+	rows.Close()
+	parent.End()
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		query := spans[0]
+		assert.Equal(t, "db SELECT", query.Name())
+		assert.Equal(t, trace.SpanKindClient, query.SpanKind())
+		assert.Equal(t, parent.SpanContext().SpanID(), query.Parent().SpanID())
+		assert.Equal(t, "postgresql", spanAttribute(query, "db.system"))
+		assert.Equal(t, "SELECT id FROM subscriptions WHERE service_name = ? AND price > ? AND user_id = $1", spanAttribute(query, "db.statement"))
+	}
+}
+
+func TestSanitizeSQL(t *testing.T) {
+	assert.Equal(t,
+		"UPDATE subscriptions SET price = ?, service_name = ? WHERE id = $1 AND version = ?",
+		tracing.SanitizeSQL("UPDATE subscriptions\n  SET price = 12.5, service_name = 'It''s'\n  WHERE id = $1 AND version = 3"),
+	)
+}
+
+func TestLoggerAddsTraceIDs(t *testing.T) {
+	recordSpans(t)
+
+	var buf bytes.Buffer
+	log := logger.NewLogger()
+	log.SetOutput(&buf)
+	log.SetFormatter(&logrus.JSONFormatter{})
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	log.WithContext(ctx).Info("traced")
+	assert.Contains(t, buf.String(), `"trace_id":"`+span.SpanContext().TraceID().String()+`"`)
+	assert.Contains(t, buf.String(), `"span_id":"`+span.SpanContext().SpanID().String()+`"`)
+
+	buf.Reset()
+	log.Info("untraced")
+	assert.NotContains(t, buf.String(), "trace_id")
+}
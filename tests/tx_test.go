@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/config"
+	"subscription-service/db"
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/outbox"
+	"subscription-service/repository"
+)
+
+func TestRetryOnSerializationFailure(t *testing.T) {
+	conflict := &pq.Error{Code: "40001", Message: "could not serialize access due to concurrent update"}
+
+	// A transaction that loses a conflict is run again until it succeeds
+	runs := 0
+	err := db.Retry(context.Background(), 3, func() error {
+		runs++
+		if runs < 3 {
+			return conflict
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, runs)
+
+	// ...but only as often as configured
+	runs = 0
+	err = db.Retry(context.Background(), 2, func() error {
+		runs++
+		return conflict
+	})
+	assert.ErrorIs(t, err, conflict)
+	assert.Equal(t, 3, runs)
+
+	// Other errors are returned at once
+	runs = 0
+	err = db.Retry(context.Background(), 3, func() error {
+		runs++
+		return &pq.Error{Code: "23505", Message: "duplicate key value"}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, runs)
+
+	assert.True(t, db.IsRetryable(&pq.Error{Code: "40P01"}))
+	assert.False(t, db.IsRetryable(errors.New("40001")))
+}
+
+func TestMockUnitOfWork(t *testing.T) {
+	repo := repository.NewMockSubscriptionRepository()
+	publishPending := func() int {
+		published, err := outbox.NewRelay(repo, outbox.NewInMemoryPublisher(), config.OutboxConfig{BatchSize: 10}, logger.NewLogger()).RelayPending(context.Background())
+		assert.NoError(t, err)
+		return published
+	}
+
+	request := &models.CreateSubscriptionRequest{ServiceName: "Netflix", Price: 599, UserID: uuid.New(), StartDate: "01-2024"}
+	audit := models.AuditInfo{Actor: "test"}
+
+	// A failed unit of work leaves no trace
+	failure := errors.New("import failed")
+	err := repo.WithTx(context.Background(), func(tx repository.Repository) error {
+		id, err := tx.Create(context.Background(), request, audit)
+		assert.NoError(t, err)
+
+		// The unit of work sees its own changes
+		_, err = tx.GetByID(context.Background(), id)
+		assert.NoError(t, err)
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	listAll := &models.ListSubscriptionsRequest{Sort: models.SortByCreatedAt, Order: models.SortAscending, Limit: 50}
+	page, _ := repo.List(context.Background(), listAll)
+	assert.Empty(t, page.Items)
+	_, total, _ := repo.ListAudit(context.Background(), &models.ListAuditRequest{Limit: 10})
+	assert.Zero(t, total)
+	assert.Zero(t, publishPending())
+
+	// A successful one keeps every change
+	var ids []int
+	err = repo.WithTx(context.Background(), func(tx repository.Repository) error {
+		for i := 0; i < 2; i++ {
+			id, err := tx.Create(context.Background(), request, audit)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	page, _ = repo.List(context.Background(), listAll)
+	subscriptions := page.Items
+	assert.Len(t, subscriptions, 2)
+	_, total, _ = repo.ListAudit(context.Background(), &models.ListAuditRequest{Limit: 10})
+	assert.Equal(t, 2, total)
+	assert.Equal(t, 2, publishPending())
+	assert.Equal(t, ids, []int{subscriptions[0].ID, subscriptions[1].ID})
+}
@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"subscription-service/backoff"
+	"subscription-service/config"
+	"subscription-service/handlers"
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/outbox"
+	"subscription-service/repository"
+	"subscription-service/webhooks"
+)
+
+// webhookReceiver records the requests sent to a test webhook endpoint
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	status   int
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rcv.mutex.Lock()
+	defer rcv.mutex.Unlock()
+
+	rcv.requests = append(rcv.requests, r)
+	rcv.bodies = append(rcv.bodies, body)
+	w.WriteHeader(rcv.status)
+}
+
+func (rcv *webhookReceiver) setStatus(status int) {
+	rcv.mutex.Lock()
+	defer rcv.mutex.Unlock()
+
+	rcv.status = status
+}
+
+func setupWebhookRouter(repo repository.Repository, store repository.WebhookStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	log := logger.NewLogger()
+	subscriptionHandler := handlers.NewSubscriptionHandler(repo, log)
+	webhookHandler := handlers.NewWebhookHandler(store, log)
+
+	r := gin.Default()
+	v1 := r.Group("/api/v1")
+	{
+		v1.POST("/subscriptions", subscriptionHandler.Create)
+		v1.PATCH("/subscriptions/:id", subscriptionHandler.Patch)
+		v1.DELETE("/subscriptions/:id", subscriptionHandler.Delete)
+		v1.POST("/webhooks", webhookHandler.Create)
+		v1.GET("/webhooks", webhookHandler.List)
+		v1.GET("/webhooks/:id", webhookHandler.Get)
+		v1.DELETE("/webhooks/:id", webhookHandler.Delete)
+		v1.GET("/webhooks/deliveries", webhookHandler.ListDeliveries)
+		v1.POST("/webhooks/deliveries/:id/redeliver", webhookHandler.Redeliver)
+	}
+
+	return r
+}
+
+func registerWebhook(t *testing.T, r *gin.Engine, body string) models.WebhookEndpoint {
+	req, _ := http.NewRequest("POST", "/api/v1/webhooks", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var endpoint models.WebhookEndpoint
+	json.Unmarshal(w.Body.Bytes(), &endpoint)
+
+	return endpoint
+}
+
+// relayToWebhooks publishes the outbox of repo to the webhook store
+func relayToWebhooks(t *testing.T, repo repository.OutboxStore, store repository.WebhookStore) {
+	log := logger.NewLogger()
+	relay := outbox.NewRelay(repo, webhooks.NewPublisher(store, log), config.OutboxConfig{BatchSize: 10}, log)
+
+	_, err := relay.RelayPending(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	repo := repository.NewMockSubscriptionRepository()
+	store := repository.NewMockWebhookRepository()
+	r := setupWebhookRouter(repo, store)
+
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	all := registerWebhook(t, r, fmt.Sprintf(`{"url": %q, "secret": "s3cret"}`, server.URL))
+	assert.Equal(t, "s3cret", all.Secret)
+	registerWebhook(t, r, fmt.Sprintf(`{"url": %q, "events": ["subscription.ended"]}`, server.URL+"/ended"))
+
+	// Creating and ending a subscription emits created, updated and ended
+	req, _ := http.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBufferString(
+		`{"service_name": "Netflix", "price": 599, "user_id": "60601fee-2bf1-4721-ae6f-7636e79a0cba", "start_date": "01-2024"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created models.Subscription
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	req, _ = http.NewRequest("PATCH", fmt.Sprintf("/api/v1/subscriptions/%d", created.ID), bytes.NewBufferString(`{"end_date": "12-2024"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	dispatcher := webhooks.NewDispatcher(store, config.WebhookConfig{
+		Timeout:     time.Second,
+		BatchSize:   10,
+		MaxAttempts: 3,
+	}, logger.NewLogger())
+	relayToWebhooks(t, repo, store)
+	assert.NoError(t, dispatcher.DispatchDue(context.Background()))
+
+	// The filtered endpoint only gets the ended event
+	events := map[string][]string{}
+	for i, received := range receiver.requests {
+		events[received.URL.Path] = append(events[received.URL.Path], received.Header.Get(webhooks.EventHeader))
+
+		timestamp, _ := strconv.ParseInt(received.Header.Get(webhooks.TimestampHeader), 10, 64)
+		if received.URL.Path == "/" {
+			assert.True(t, webhooks.Verify("s3cret", timestamp, receiver.bodies[i], received.Header.Get(webhooks.SignatureHeader)))
+		}
+	}
+	assert.Equal(t, []string{models.EventSubscriptionCreated, models.EventSubscriptionUpdated, models.EventSubscriptionEnded}, events["/"])
+	assert.Equal(t, []string{models.EventSubscriptionEnded}, events["/ended"])
+
+	var event models.Event
+	json.Unmarshal(receiver.bodies[0], &event)
+	assert.Equal(t, created.ID, event.Data.ID)
+
+	// Everything was delivered, so nothing is sent again
+	relayToWebhooks(t, repo, store)
+	assert.NoError(t, dispatcher.DispatchDue(context.Background()))
+	assert.Len(t, receiver.requests, 4)
+
+	// Secrets are not listed
+	req, _ = http.NewRequest("GET", "/api/v1/webhooks", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "s3cret")
+}
+
+func TestWebhookRetriesAndDeadLetter(t *testing.T) {
+	repo := repository.NewMockSubscriptionRepository()
+	store := repository.NewMockWebhookRepository()
+	r := setupWebhookRouter(repo, store)
+
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	endpoint := registerWebhook(t, r, fmt.Sprintf(`{"url": %q, "events": ["subscription.created"]}`, server.URL))
+
+	req, _ := http.NewRequest("POST", "/api/v1/subscriptions", bytes.NewBufferString(
+		`{"service_name": "Spotify", "price": 199, "user_id": "60601fee-2bf1-4721-ae6f-7636e79a0cba", "start_date": "01-2024"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	relayToWebhooks(t, repo, store)
+
+	// With no backoff every poll makes another attempt until the limit is reached
+	dispatcher := webhooks.NewDispatcher(store, config.WebhookConfig{
+		Timeout:     time.Second,
+		BatchSize:   10,
+		MaxAttempts: 2,
+	}, logger.NewLogger())
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, dispatcher.DispatchDue(context.Background()))
+	}
+	assert.Len(t, receiver.requests, 2)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/v1/webhooks/deliveries?endpoint_id=%d&status=dead", endpoint.ID), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+
+	var deliveries []models.WebhookDelivery
+	json.Unmarshal(w.Body.Bytes(), &deliveries)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, *deliveries[0].LastStatusCode)
+
+	// A manual redelivery sends it again once the endpoint has recovered
+	receiver.setStatus(http.StatusNoContent)
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/v1/webhooks/deliveries/%d/redeliver", deliveries[0].ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	assert.NoError(t, dispatcher.DispatchDue(context.Background()))
+	assert.Len(t, receiver.requests, 3)
+
+	page, total, err := store.ListDeliveries(context.Background(), &models.ListDeliveriesRequest{Status: models.DeliveryStatusSucceeded, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, 1, page[0].Attempts)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, backoff.Exponential(1, 30*time.Second, time.Hour))
+	assert.Equal(t, 2*time.Minute, backoff.Exponential(3, 30*time.Second, time.Hour))
+	assert.Equal(t, time.Hour, backoff.Exponential(20, 30*time.Second, time.Hour))
+}
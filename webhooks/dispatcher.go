@@ -0,0 +1,124 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"subscription-service/backoff"
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/repository"
+)
+
+// maxErrorBodyLength limits how much of a failed response is kept in the delivery log
+const maxErrorBodyLength = 512
+
+// Dispatcher sends due webhook deliveries and schedules retries
+type Dispatcher struct {
+	store  repository.WebhookStore
+	client *http.Client
+	cfg    config.WebhookConfig
+	logger *logger.Logger
+}
+
+// NewDispatcher creates a new webhook dispatcher
+func NewDispatcher(store repository.WebhookStore, cfg config.WebhookConfig, logger *logger.Logger) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// DispatchDue sends every delivery that is due and records the outcomes
+func (d *Dispatcher) DispatchDue(ctx context.Context) error {
+	// A claimed delivery is not handed out again until the request has had time to finish
+	deliveries, err := d.store.ClaimDueDeliveries(ctx, d.cfg.BatchSize, 2*d.cfg.Timeout)
+	if err != nil {
+		return err
+	}
+
+	endpoints := map[int]*models.WebhookEndpoint{}
+	for _, delivery := range deliveries {
+		endpoint, ok := endpoints[delivery.EndpointID]
+		if !ok {
+			endpoint, err = d.store.GetEndpoint(ctx, delivery.EndpointID)
+			if err != nil {
+				d.logger.Errorf("Failed to get webhook endpoint %d: %v", delivery.EndpointID, err)
+				continue
+			}
+			endpoints[delivery.EndpointID] = endpoint
+		}
+
+		result := d.deliver(ctx, endpoint, delivery)
+		if err := d.store.RecordAttempt(ctx, delivery.ID, result); err != nil {
+			d.logger.Errorf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// deliver makes a single attempt and decides when, if at all, to try again
+func (d *Dispatcher) deliver(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery) models.DeliveryResult {
+	var result models.DeliveryResult
+
+	statusCode, err := d.send(ctx, endpoint, delivery)
+	if statusCode != 0 {
+		result.StatusCode = &statusCode
+	}
+	if err == nil {
+		d.logger.Infof("Delivered webhook %d (%s) to endpoint %d", delivery.ID, delivery.EventType, endpoint.ID)
+		result.Succeeded = true
+		return result
+	}
+
+	result.Error = err.Error()
+
+	attempt := delivery.Attempts + 1
+	if attempt >= d.cfg.MaxAttempts {
+		d.logger.Errorf("Webhook %d to endpoint %d failed %d times, moving it to the dead-letter state: %v", delivery.ID, endpoint.ID, attempt, err)
+		return result
+	}
+
+	next := time.Now().Add(backoff.Exponential(attempt, d.cfg.InitialBackoff, d.cfg.MaxBackoff))
+	result.NextAttemptAt = &next
+	d.logger.Errorf("Webhook %d to endpoint %d failed (attempt %d), retrying at %s: %v", delivery.ID, endpoint.ID, attempt, next.Format(time.RFC3339), err)
+
+	return result
+}
+
+// send posts the signed payload and treats any non-2xx status as a failure
+func (d *Dispatcher) send(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLength))
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,43 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"subscription-service/logger"
+	"subscription-service/models"
+	"subscription-service/repository"
+)
+
+// Publisher turns outbox events into pending deliveries to the webhook endpoints
+// subscribed to them
+type Publisher struct {
+	store  repository.WebhookStore
+	logger *logger.Logger
+}
+
+// NewPublisher creates a new webhook publisher
+func NewPublisher(store repository.WebhookStore, logger *logger.Logger) *Publisher {
+	return &Publisher{store: store, logger: logger}
+}
+
+// Publish queues the event for every subscribed endpoint. Publishing an event
+// again does not create duplicate deliveries.
+func (p *Publisher) Publish(ctx context.Context, outboxEvent *models.OutboxEvent) error {
+	var event models.Event
+	if err := json.Unmarshal(outboxEvent.Payload, &event); err != nil {
+		return fmt.Errorf("failed to decode event %s: %w", outboxEvent.EventID, err)
+	}
+
+	enqueued, err := p.store.EnqueueEvent(ctx, &event)
+	if err != nil {
+		return err
+	}
+
+	if enqueued > 0 {
+		p.logger.Infof("Queued %s event %s for %d webhook endpoints", event.Type, event.ID, enqueued)
+	}
+
+	return nil
+}
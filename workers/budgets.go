@@ -0,0 +1,43 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"subscription-service/budgets"
+	"subscription-service/config"
+	"subscription-service/logger"
+)
+
+// defaultBudgetInterval is used when the configured interval is not positive
+const defaultBudgetInterval = time.Hour
+
+// BudgetWorker periodically evaluates budgets and sends threshold alerts
+type BudgetWorker struct {
+	evaluator *budgets.Evaluator
+	interval  time.Duration
+	logger    *logger.Logger
+}
+
+// NewBudgetWorker creates a new budget worker
+func NewBudgetWorker(evaluator *budgets.Evaluator, cfg config.BudgetsConfig, logger *logger.Logger) *BudgetWorker {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultBudgetInterval
+	}
+
+	return &BudgetWorker{
+		evaluator: evaluator,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Run evaluates budgets on every tick until the context is cancelled
+func (w *BudgetWorker) Run(ctx context.Context) {
+	runEvery(ctx, w.interval, func() {
+		if err := w.evaluator.Run(ctx); err != nil {
+			w.logger.Errorf("Failed to evaluate budgets: %v", err)
+		}
+	})
+}
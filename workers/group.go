@@ -0,0 +1,156 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"subscription-service/backoff"
+	"subscription-service/logger"
+)
+
+const (
+	// initialRestartBackoff is the delay before a worker that returned on its
+	// own is restarted; it doubles for every further restart in a row
+	initialRestartBackoff = time.Second
+	// maxRestartBackoff caps the delay between restarts; a worker that ran at
+	// least this long before returning is restarted after the initial delay again
+	maxRestartBackoff = time.Minute
+)
+
+// Group runs background workers until it is stopped. A worker that returns
+// before Stop is restarted with backoff.
+type Group struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mutex   sync.Mutex
+	running map[string]int // Workers that have not returned for good yet by name
+	exited  map[string]int // Workers waiting to be restarted by name
+	logger  *logger.Logger
+}
+
+// NewGroup creates an empty worker group
+func NewGroup(logger *logger.Logger) *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Group{
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]int),
+		exited:  make(map[string]int),
+		logger:  logger,
+	}
+}
+
+// Go runs a worker in its own goroutine; its context is cancelled by Stop. If
+// it returns before that it is run again after a backoff.
+func (g *Group) Go(name string, run func(ctx context.Context)) {
+	g.mutex.Lock()
+	g.running[name]++
+	g.mutex.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			g.mutex.Lock()
+			g.running[name]--
+			if g.running[name] == 0 {
+				delete(g.running, name)
+			}
+			g.mutex.Unlock()
+		}()
+
+		for attempt := 1; ; attempt++ {
+			started := time.Now()
+			run(g.ctx)
+			if g.ctx.Err() != nil {
+				g.logger.Debugf("Worker %s stopped", name)
+				return
+			}
+
+			if time.Since(started) >= maxRestartBackoff {
+				attempt = 1
+			}
+			delay := backoff.Exponential(attempt, initialRestartBackoff, maxRestartBackoff)
+			g.logger.Errorf("Worker %s stopped unexpectedly, restarting in %s", name, delay)
+
+			if !g.waitToRestart(name, delay) {
+				return
+			}
+		}
+	}()
+}
+
+// waitToRestart marks a worker as exited for the delay before its restart; it
+// reports false if the group is stopped first, leaving the worker marked
+func (g *Group) waitToRestart(name string, delay time.Duration) bool {
+	g.mutex.Lock()
+	g.exited[name]++
+	g.mutex.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-g.ctx.Done():
+		return false
+	case <-timer.C:
+	}
+
+	g.mutex.Lock()
+	g.exited[name]--
+	if g.exited[name] == 0 {
+		delete(g.exited, name)
+	}
+	g.mutex.Unlock()
+
+	return true
+}
+
+// Stop cancels the workers and waits for them to return. It gives up when ctx
+// is done first and reports the workers that are still running.
+func (g *Group) Stop(ctx context.Context) error {
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+
+		names := make([]string, 0, len(g.running))
+		for name := range g.running {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("workers still running: %v", names)
+	}
+}
+
+// Check reports an error while a worker that stopped without being asked to
+// waits to be restarted
+func (g *Group) Check(ctx context.Context) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if len(g.exited) > 0 {
+		names := make([]string, 0, len(g.exited))
+		for name := range g.exited {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("workers stopped unexpectedly: %v", names)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/repository"
+)
+
+// defaultIdempotencyCleanupInterval is used when the configured interval is not positive
+const defaultIdempotencyCleanupInterval = time.Hour
+
+// IdempotencyCleanupWorker periodically removes expired idempotency keys
+type IdempotencyCleanupWorker struct {
+	store    repository.IdempotencyStore
+	interval time.Duration
+	logger   *logger.Logger
+}
+
+// NewIdempotencyCleanupWorker creates a new idempotency key cleanup worker
+func NewIdempotencyCleanupWorker(store repository.IdempotencyStore, cfg config.IdempotencyConfig, logger *logger.Logger) *IdempotencyCleanupWorker {
+	interval := cfg.CleanupInterval
+	if interval <= 0 {
+		interval = defaultIdempotencyCleanupInterval
+	}
+
+	return &IdempotencyCleanupWorker{
+		store:    store,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run removes expired keys on every tick until the context is cancelled
+func (w *IdempotencyCleanupWorker) Run(ctx context.Context) {
+	runEvery(ctx, w.interval, func() { w.cleanup(ctx) })
+}
+
+// cleanup runs a single cleanup pass
+func (w *IdempotencyCleanupWorker) cleanup(ctx context.Context) {
+	purged, err := w.store.PurgeExpired(ctx)
+	if err != nil {
+		w.logger.Errorf("Failed to purge expired idempotency keys: %v", err)
+		return
+	}
+
+	if purged > 0 {
+		w.logger.Infof("Purged %d expired idempotency keys", purged)
+	}
+}
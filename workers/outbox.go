@@ -0,0 +1,72 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/outbox"
+	"subscription-service/repository"
+)
+
+const (
+	// defaultOutboxPollInterval is used when the configured interval is not positive
+	defaultOutboxPollInterval = time.Second
+	// outboxPurgeInterval is how often published events past their retention are removed
+	outboxPurgeInterval = time.Hour
+)
+
+// OutboxRelayWorker periodically publishes new outbox events and removes old ones
+type OutboxRelayWorker struct {
+	relay     *outbox.Relay
+	store     repository.OutboxStore
+	interval  time.Duration
+	retention time.Duration
+	lastPurge time.Time
+	logger    *logger.Logger
+}
+
+// NewOutboxRelayWorker creates a new outbox relay worker
+func NewOutboxRelayWorker(relay *outbox.Relay, store repository.OutboxStore, cfg config.OutboxConfig, logger *logger.Logger) *OutboxRelayWorker {
+	interval := cfg.PollInterval
+	if interval <= 0 {
+		interval = defaultOutboxPollInterval
+	}
+
+	return &OutboxRelayWorker{
+		relay:     relay,
+		store:     store,
+		interval:  interval,
+		retention: cfg.Retention,
+		logger:    logger,
+	}
+}
+
+// Run relays events on every tick until the context is cancelled
+func (w *OutboxRelayWorker) Run(ctx context.Context) {
+	runEvery(ctx, w.interval, func() {
+		if _, err := w.relay.RelayPending(ctx); err != nil {
+			w.logger.Errorf("Failed to relay outbox events: %v", err)
+		}
+
+		if w.retention > 0 && time.Since(w.lastPurge) >= outboxPurgeInterval {
+			w.purge(ctx)
+		}
+	})
+}
+
+// purge runs a single purge pass
+func (w *OutboxRelayWorker) purge(ctx context.Context) {
+	w.lastPurge = time.Now()
+
+	purged, err := w.store.PurgePublished(ctx, w.retention)
+	if err != nil {
+		w.logger.Errorf("Failed to purge published outbox events: %v", err)
+		return
+	}
+
+	if purged > 0 {
+		w.logger.Infof("Purged %d published outbox events", purged)
+	}
+}
@@ -0,0 +1,61 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/repository"
+)
+
+// defaultPurgeInterval is used when the configured interval is not positive
+const defaultPurgeInterval = time.Hour
+
+// PurgeWorker periodically hard-deletes subscriptions that were soft-deleted
+// longer than the retention period ago
+type PurgeWorker struct {
+	repo      repository.Repository
+	retention time.Duration
+	interval  time.Duration
+	logger    *logger.Logger
+}
+
+// NewPurgeWorker creates a new purge worker
+func NewPurgeWorker(repo repository.Repository, cfg config.PurgeConfig, logger *logger.Logger) *PurgeWorker {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultPurgeInterval
+	}
+
+	return &PurgeWorker{
+		repo:      repo,
+		retention: cfg.Retention,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Run purges expired rows on every tick until the context is cancelled
+func (w *PurgeWorker) Run(ctx context.Context) {
+	if w.retention <= 0 {
+		w.logger.Info("Purge of deleted subscriptions is disabled")
+		return
+	}
+
+	w.logger.Infof("Purging deleted subscriptions older than %s every %s", w.retention, w.interval)
+	runEvery(ctx, w.interval, func() { w.purge(ctx) })
+}
+
+// purge runs a single purge pass
+func (w *PurgeWorker) purge(ctx context.Context) {
+	purged, err := w.repo.PurgeDeleted(ctx, w.retention)
+	if err != nil {
+		w.logger.Errorf("Failed to purge deleted subscriptions: %v", err)
+		return
+	}
+
+	if purged > 0 {
+		w.logger.Infof("Purged %d deleted subscriptions", purged)
+	}
+}
@@ -0,0 +1,43 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/reminders"
+)
+
+// defaultReminderInterval is used when the configured interval is not positive
+const defaultReminderInterval = time.Minute
+
+// ReminderWorker periodically plans and sends renewal and end reminders
+type ReminderWorker struct {
+	scheduler *reminders.Scheduler
+	interval  time.Duration
+	logger    *logger.Logger
+}
+
+// NewReminderWorker creates a new reminder worker
+func NewReminderWorker(scheduler *reminders.Scheduler, cfg config.RemindersConfig, logger *logger.Logger) *ReminderWorker {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultReminderInterval
+	}
+
+	return &ReminderWorker{
+		scheduler: scheduler,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Run plans and sends reminders on every tick until the context is cancelled
+func (w *ReminderWorker) Run(ctx context.Context) {
+	runEvery(ctx, w.interval, func() {
+		if err := w.scheduler.Run(ctx); err != nil {
+			w.logger.Errorf("Failed to process reminders: %v", err)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"subscription-service/config"
+	"subscription-service/logger"
+	"subscription-service/webhooks"
+)
+
+// defaultWebhookPollInterval is used when the configured interval is not positive
+const defaultWebhookPollInterval = 5 * time.Second
+
+// WebhookWorker periodically sends due webhook deliveries
+type WebhookWorker struct {
+	dispatcher *webhooks.Dispatcher
+	interval   time.Duration
+	logger     *logger.Logger
+}
+
+// NewWebhookWorker creates a new webhook delivery worker
+func NewWebhookWorker(dispatcher *webhooks.Dispatcher, cfg config.WebhookConfig, logger *logger.Logger) *WebhookWorker {
+	interval := cfg.PollInterval
+	if interval <= 0 {
+		interval = defaultWebhookPollInterval
+	}
+
+	return &WebhookWorker{
+		dispatcher: dispatcher,
+		interval:   interval,
+		logger:     logger,
+	}
+}
+
+// Run sends due deliveries on every tick until the context is cancelled
+func (w *WebhookWorker) Run(ctx context.Context) {
+	runEvery(ctx, w.interval, func() {
+		if err := w.dispatcher.DispatchDue(ctx); err != nil {
+			w.logger.Errorf("Failed to dispatch webhooks: %v", err)
+		}
+	})
+}
@@ -0,0 +1,23 @@
+// Package workers contains background jobs that run alongside the HTTP server.
+package workers
+
+import (
+	"context"
+	"time"
+)
+
+// runEvery calls fn immediately and then on every tick until ctx is cancelled
+func runEvery(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}